@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"tritan.dev/image-uploader/database"
+)
+
+// commands are the subcommands besides serve. Each prints its result as JSON
+// on stdout, errors as JSON on stderr, and returns the exit code.
+var commands = map[string]func(args []string) int{
+	"user":      runUserCommand,
+	"migrate":   runMigrateCommand,
+	"reconcile": runReconcileCommand,
+	"export":    runExportCommand,
+	"import":    runImportCommand,
+	"openapi":   runOpenAPICommand,
+}
+
+// offlineCommands run without connecting to the database.
+var offlineCommands = map[string]bool{"openapi": true}
+
+func runCommand(name string, args []string) int {
+	command, ok := commands[name]
+	if !ok {
+		names := []string{"serve"}
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fail(fmt.Errorf("unknown command %q, expected one of %v", name, names))
+	}
+	if !offlineCommands[name] {
+		if err := database.Connect(); err != nil {
+			return fail(err)
+		}
+	}
+	return command(args)
+}
+
+func printJSON(v interface{}) int {
+	return writeJSON(os.Stdout, v)
+}
+
+func writeJSON(w io.Writer, v interface{}) int {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func fail(err error) int {
+	json.NewEncoder(os.Stderr).Encode(map[string]string{"error": err.Error()})
+	return 1
+}
@@ -4,6 +4,7 @@ import "github.com/gofiber/fiber/v2"
 
 const (
 	StatusOK                  = fiber.StatusOK
+	StatusAccepted            = fiber.StatusAccepted
 	StatusUnauthorized        = fiber.StatusUnauthorized
 	StatusBadRequest          = fiber.StatusBadRequest
 	StatusNotFound            = fiber.StatusNotFound
@@ -11,7 +12,21 @@ const (
 	StatusNoContent           = fiber.StatusNoContent
 	StatusForbidden           = fiber.StatusForbidden
 	StatusConflict            = fiber.StatusConflict
+	StatusUnprocessable       = fiber.StatusUnprocessableEntity
 	StatusRateLimitExceeded   = fiber.StatusTooManyRequests
+	StatusRequestTooLarge     = fiber.StatusRequestEntityTooLarge
+	StatusInsufficientStorage = fiber.StatusInsufficientStorage
+)
+
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+const (
+	UploadTypeFile      = "file"
+	UploadTypeEncrypted = "encrypted"
 )
 
 const (
@@ -28,7 +43,13 @@ const (
 	MessageFailedUpdateSlug      = "Failed to update the slug"
 	MessageFailedFetchUploads    = "Failed to fetch uploads"
 	MessageFileUploaded          = "File uploaded successfully"
+	MessageFileDuplicate         = "File already uploaded"
+	MessageFilesUploaded         = "Files uploaded successfully"
+	MessageTooManyFiles          = "Too many files in one upload"
 	MessageFailedGetDomains      = "Failed to get domains"
+	MessageFailedGetUser         = "Failed to get user"
+	MessageFailedSendConfig      = "Failed to generate the config"
+	MessageInvalidConfigType     = "The query type was invalid"
 	MessageInvalidKey            = "Invalid key"
 	MessageInvalidPayload        = "Invalid request payload"
 	MessageInvalidRequestType    = "Invalid request type"
@@ -44,7 +65,7 @@ const (
 	MessageURLNotFound           = "URL not found"
 	MessageURLRequired           = "URL is required"
 	MessageUploadError           = "Error deleting upload"
-	MessageUploadFailed          = "Failed to upload the fil."
+	MessageUploadFailed          = "Failed to upload the file"
 	MessageUploadNotFound        = "Upload not found"
 	MessageUploadUnauthorized    = "Unauthorized to delete this upload"
 	MessageFailedToCreateSession = "Failed to create S3 session"
@@ -54,10 +75,58 @@ const (
 	MessageUserNotFound          = "User not found"
 	MessageInternalError         = "Internal server error"
 	MessageForbidden             = "Forbidden"
+	MessageCannotDeleteSelf      = "Admins cannot delete their own account from the admin API"
 	MessageInvalidRequestBody    = "Invalid request body"
+	MessageInvalidCursor         = "Invalid or expired cursor"
+	MessageSearchQueryRequired   = "Search query is required"
+	MessageSearchFailed          = "Search failed"
+	MessageMovedToTrash          = "Moved to trash"
+	MessageRestored              = "Restored from trash"
+	MessageNotInTrash            = "Item is not in the trash"
+	MessageTrashExpired          = "Item has passed its trash retention and is being purged"
+	MessageFailedLoadTrash       = "Failed to load trash"
+	MessageFileReplaced          = "File replaced successfully"
+	MessageVersionNotFound       = "Version not found"
+	MessageVersionConflict       = "Upload was changed by another request, try again"
+	MessageVersionTypeMismatch   = "Replacement must have the same file extension"
+	MessageVersionRestored       = "Version restored"
+	MessageInvalidUploadName     = "Names must be 3-64 letters, numbers, dashes or underscores"
+	MessageReservedUploadName    = "That name is reserved"
+	MessageUploadNameTaken       = "That name is already taken"
+	MessageUploadRenamed         = "Upload renamed successfully"
+	MessageNameNeedsSingleFile   = "A custom name can only be given to a single file"
+	MessageInvalidNameStyle      = "Unknown name style"
+	MessageJobQueued             = "Job queued"
+	MessageJobNotFound           = "Job not found"
+	MessageFailedQueueJob        = "Failed to queue job"
+	MessageFailedLoadJobs        = "Failed to load jobs"
+	MessageFailedUpdateNameStyle = "Failed to update name style"
 	MessageMissingUploadID       = "Missing upload ID"
 	MessageUploadDeleted         = "Upload deleted successfully"
 	MessageMissingURLSlug        = "Missing URL slug"
 	MessageMissingURL            = "URL not found"
 	MessageMissingContent        = "Content not found"
+	MessageFailedHashPassword    = "Failed to secure the upload password"
+	MessageUploadLocked          = "This upload is password protected"
+	MessageWrongPassword         = "Incorrect password"
+	MessageInvalidVisibility     = "Visibility must be public, unlisted or private"
+	MessageInvalidUploadDetails  = "Title, description or tags are too long"
+	MessageFailedUpdateUpload    = "Failed to update the upload"
+	MessageInvalidExpiry         = "Invalid share link expiry"
+	MessageInvalidCipher         = "Unsupported cipher for encrypted upload"
+	MessageFailedRotateKeys      = "Failed to rotate storage keys"
+	MessageFileTooLarge          = "File exceeds the maximum upload size"
+	MessageQuotaExceeded         = "Storage quota exceeded"
+	MessageFailedUpdateLimits    = "Failed to update user limits"
+	MessageAlbumNotFound         = "Album not found"
+	MessageAlbumTitleRequired    = "Album title is required"
+	MessageFailedLoadAlbums      = "Failed to load albums"
+	MessageFailedSaveAlbum       = "Failed to save the album"
+	MessageInvalidAlbumCover     = "Album cover must be one of the album's uploads"
+	MessageInvalidAlbumOrder     = "Order must list every upload in the album exactly once"
+	MessageRateLimited           = "Too many requests, please wait before trying again"
+	MessageInvalidIdempotencyKey = "Idempotency-Key must be 1 to 255 printable characters"
+	MessageIdempotencyKeyReused  = "Idempotency-Key was already used for a different request"
+	MessageIdempotencyInProgress = "A request with this Idempotency-Key is still being processed"
+	MessageFailedIdempotency     = "Failed to check the Idempotency-Key"
 )
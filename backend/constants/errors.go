@@ -0,0 +1,245 @@
+package constants
+
+// Error codes for the /api/v1 error envelope. Handlers pass one with every
+// error response, so clients can branch on the code while the message stays
+// free to change.
+const (
+	CodeAPIKeyRequired        = "api_key_required"
+	CodeInvalidKey            = "invalid_key"
+	CodeForbidden             = "forbidden"
+	CodeCannotDeleteSelf      = "cannot_delete_self"
+	CodeUserNotFound          = "user_not_found"
+	CodeFailedCreateUser      = "create_user_failed"
+	CodeFailedDelete          = "delete_account_failed"
+	CodeFailedLoadUsers       = "load_users_failed"
+	CodeFailedGetUser         = "load_user_failed"
+	CodeFailedRegenToken      = "regenerate_key_failed"
+	CodeFailedUpdateDomain    = "update_domain_failed"
+	CodeFailedUpdateName      = "update_display_name_failed"
+	CodeFailedUpdateNameStyle = "update_name_style_failed"
+	CodeFailedUpdateLimits    = "update_limits_failed"
+	CodeInvalidNameStyle      = "invalid_name_style"
+	CodeInvalidPayload        = "invalid_payload"
+	CodeInvalidRequestBody    = "invalid_request_body"
+	CodeInvalidRequestType    = "invalid_request_type"
+	CodeInvalidRequest        = "invalid_request"
+	CodeMissingFields         = "missing_fields"
+	CodeInvalidCursor         = "invalid_cursor"
+	CodeInternalError         = "internal_error"
+
+	CodeFailedGetDomains  = "load_domains_failed"
+	CodeFailedAddDomain   = "add_domain_failed"
+	CodeInvalidConfigType = "invalid_config_type"
+	CodeFailedSendConfig  = "config_failed"
+
+	CodeFailedSaveURL    = "save_url_failed"
+	CodeFailedToLoadURL  = "load_url_failed"
+	CodeFailedLoadURLs   = "load_urls_failed"
+	CodeURLNotFound      = "url_not_found"
+	CodeURLRequired      = "url_required"
+	CodeMissingURLSlug   = "missing_url_slug"
+	CodeNewSlugRequired  = "new_slug_required"
+	CodeSlugExists       = "slug_taken"
+	CodeSlugFailed       = "update_slug_failed"
+	CodeSlugNotFound     = "slug_not_found"
+	CodeSlugUnauthorized = "slug_forbidden"
+
+	CodeNoFileUploaded        = "no_file"
+	CodeTooManyFiles          = "too_many_files"
+	CodeFailedFetchUploads    = "load_uploads_failed"
+	CodeUploadError           = "delete_upload_failed"
+	CodeUploadFailed          = "upload_failed"
+	CodeUploadNotFound        = "upload_not_found"
+	CodeUploadUnauthorized    = "upload_forbidden"
+	CodeMissingUploadID       = "missing_upload_id"
+	CodeMissingContent        = "content_not_found"
+	CodeFailedToCreateSession = "storage_session_failed"
+	CodeFailedToUploadToS3    = "storage_write_failed"
+	CodeVerifyFailed          = "storage_verify_failed"
+	CodeFailedHashPassword    = "hash_password_failed"
+	CodeUploadLocked          = "upload_locked"
+	CodeWrongPassword         = "wrong_password"
+	CodeInvalidVisibility     = "invalid_visibility"
+	CodeInvalidUploadDetails  = "invalid_upload_details"
+	CodeFailedUpdateUpload    = "update_upload_failed"
+	CodeInvalidExpiry         = "invalid_expiry"
+	CodeInvalidCipher         = "invalid_cipher"
+	CodeFileTooLarge          = "file_too_large"
+	CodeQuotaExceeded         = "quota_exceeded"
+	CodeInvalidUploadName     = "invalid_upload_name"
+	CodeReservedUploadName    = "reserved_upload_name"
+	CodeUploadNameTaken       = "upload_name_taken"
+	CodeNameNeedsSingleFile   = "name_needs_single_file"
+
+	CodeVersionNotFound     = "version_not_found"
+	CodeVersionConflict     = "version_conflict"
+	CodeVersionTypeMismatch = "version_type_mismatch"
+
+	CodeSearchQueryRequired = "search_query_required"
+	CodeSearchFailed        = "search_failed"
+	CodeNotInTrash          = "not_in_trash"
+	CodeTrashExpired        = "trash_expired"
+	CodeFailedLoadTrash     = "load_trash_failed"
+	CodeFailedRotateKeys    = "rotate_keys_failed"
+
+	CodeJobNotFound    = "job_not_found"
+	CodeFailedQueueJob = "queue_job_failed"
+	CodeFailedLoadJobs = "load_jobs_failed"
+
+	CodeAlbumNotFound      = "album_not_found"
+	CodeAlbumTitleRequired = "album_title_required"
+	CodeFailedLoadAlbums   = "load_albums_failed"
+	CodeFailedSaveAlbum    = "save_album_failed"
+	CodeInvalidAlbumCover  = "invalid_album_cover"
+	CodeInvalidAlbumOrder  = "invalid_album_order"
+
+	CodeRateLimited           = "rate_limited"
+	CodeInvalidIdempotencyKey = "invalid_idempotency_key"
+	CodeIdempotencyKeyReused  = "idempotency_key_reused"
+	CodeIdempotencyInProgress = "idempotency_key_in_progress"
+	CodeFailedIdempotency     = "idempotency_failed"
+)
+
+// ErrorCodes lists every code above, for checking the code enum of V1Error
+// in openapi.json.
+var ErrorCodes = []string{
+	CodeAPIKeyRequired,
+	CodeInvalidKey,
+	CodeForbidden,
+	CodeCannotDeleteSelf,
+	CodeUserNotFound,
+	CodeFailedCreateUser,
+	CodeFailedDelete,
+	CodeFailedLoadUsers,
+	CodeFailedGetUser,
+	CodeFailedRegenToken,
+	CodeFailedUpdateDomain,
+	CodeFailedUpdateName,
+	CodeFailedUpdateNameStyle,
+	CodeFailedUpdateLimits,
+	CodeInvalidNameStyle,
+	CodeInvalidPayload,
+	CodeInvalidRequestBody,
+	CodeInvalidRequestType,
+	CodeInvalidRequest,
+	CodeMissingFields,
+	CodeInvalidCursor,
+	CodeInternalError,
+
+	CodeFailedGetDomains,
+	CodeFailedAddDomain,
+	CodeInvalidConfigType,
+	CodeFailedSendConfig,
+
+	CodeFailedSaveURL,
+	CodeFailedToLoadURL,
+	CodeFailedLoadURLs,
+	CodeURLNotFound,
+	CodeURLRequired,
+	CodeMissingURLSlug,
+	CodeNewSlugRequired,
+	CodeSlugExists,
+	CodeSlugFailed,
+	CodeSlugNotFound,
+	CodeSlugUnauthorized,
+
+	CodeNoFileUploaded,
+	CodeTooManyFiles,
+	CodeFailedFetchUploads,
+	CodeUploadError,
+	CodeUploadFailed,
+	CodeUploadNotFound,
+	CodeUploadUnauthorized,
+	CodeMissingUploadID,
+	CodeMissingContent,
+	CodeFailedToCreateSession,
+	CodeFailedToUploadToS3,
+	CodeVerifyFailed,
+	CodeFailedHashPassword,
+	CodeUploadLocked,
+	CodeWrongPassword,
+	CodeInvalidVisibility,
+	CodeInvalidUploadDetails,
+	CodeFailedUpdateUpload,
+	CodeInvalidExpiry,
+	CodeInvalidCipher,
+	CodeFileTooLarge,
+	CodeQuotaExceeded,
+	CodeInvalidUploadName,
+	CodeReservedUploadName,
+	CodeUploadNameTaken,
+	CodeNameNeedsSingleFile,
+
+	CodeVersionNotFound,
+	CodeVersionConflict,
+	CodeVersionTypeMismatch,
+
+	CodeSearchQueryRequired,
+	CodeSearchFailed,
+	CodeNotInTrash,
+	CodeTrashExpired,
+	CodeFailedLoadTrash,
+	CodeFailedRotateKeys,
+
+	CodeJobNotFound,
+	CodeFailedQueueJob,
+	CodeFailedLoadJobs,
+
+	CodeAlbumNotFound,
+	CodeAlbumTitleRequired,
+	CodeFailedLoadAlbums,
+	CodeFailedSaveAlbum,
+	CodeInvalidAlbumCover,
+	CodeInvalidAlbumOrder,
+
+	CodeRateLimited,
+	CodeInvalidIdempotencyKey,
+	CodeIdempotencyKeyReused,
+	CodeIdempotencyInProgress,
+	CodeFailedIdempotency,
+}
+
+// StatusErrorCodes are the codes for errors that did not set one, such as
+// those returned to Fiber's error handler.
+var StatusErrorCodes = map[int]string{
+	StatusBadRequest:          "bad_request",
+	StatusUnauthorized:        "unauthorized",
+	StatusForbidden:           "forbidden",
+	StatusNotFound:            "not_found",
+	StatusConflict:            "conflict",
+	StatusUnprocessable:       "unprocessable",
+	StatusRequestTooLarge:     "payload_too_large",
+	StatusRateLimitExceeded:   "rate_limited",
+	StatusInsufficientStorage: "insufficient_storage",
+	StatusInternalServerError: "internal_error",
+}
+
+// Field error codes, for the fields list of a validation error.
+const (
+	FieldRequired = "required"
+	FieldInvalid  = "invalid"
+	FieldTooLong  = "too_long"
+	FieldReserved = "reserved"
+	FieldTaken    = "taken"
+)
+
+// ErrorCodeLocal is the fiber.Ctx local an error response stores its code
+// in, for the /api/v1 envelope to read.
+const ErrorCodeLocal = "error_code"
+
+// APIPrefixLocal is the fiber.Ctx local holding the prefix an API request was
+// routed under, for links handed back to stay on the same API version. It is
+// unset under /api.
+const APIPrefixLocal = "api_prefix"
+
+// ErrorCode returns the code for an error response with the given status
+// that did not set one of its own.
+func ErrorCode(status int) string {
+	if code, ok := StatusErrorCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return "internal_error"
+	}
+	return "error"
+}
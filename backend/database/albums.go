@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Album is an ordered collection of a user's uploads. Files holds upload IDs
+// (hex) in display order; Cover is one of them. IDs rather than file names
+// keep albums pointing at the right upload across renames and domains.
+type Album struct {
+	ID          string    `bson:"album_id" json:"id"`
+	Key         string    `bson:"api_key" json:"key"`
+	Title       string    `bson:"title" json:"title"`
+	Description string    `bson:"description" json:"description"`
+	Cover       string    `bson:"cover,omitempty" json:"cover,omitempty"`
+	Files       []string  `bson:"files" json:"files"`
+	CreatedAt   time.Time `bson:"created_at" json:"createdAt"`
+	UpdatedAt   time.Time `bson:"updated_at" json:"updatedAt"`
+}
+
+func SaveAlbumToDB(album Album) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if album.Files == nil {
+		album.Files = []string{}
+	}
+
+	_, err := getCollection("albums").InsertOne(ctx, album)
+	if err != nil {
+		log.Printf("Error inserting album: %v", err)
+		return err
+	}
+	return nil
+}
+
+func GetAlbumByID(id string) (Album, error) {
+	var album Album
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := findOne(ctx, "albums", bson.M{"album_id": id}, &album)
+	return album, err
+}
+
+func LoadAlbumsByKey(key string) ([]Album, error) {
+	albums := []Album{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}})
+	err := findMany(ctx, "albums", bson.M{"api_key": key}, opts, &albums)
+	if err != nil {
+		return nil, err
+	}
+	return albums, nil
+}
+
+// AlbumDetails is a partial update of an album: nil fields are left as they
+// are, and an empty Cover clears the cover.
+type AlbumDetails struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Cover       *string `json:"cover"`
+}
+
+func UpdateAlbumDetails(id string, details AlbumDetails) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	set := bson.M{"updated_at": time.Now()}
+	update := bson.M{"$set": set}
+	if details.Title != nil {
+		set["title"] = *details.Title
+	}
+	if details.Description != nil {
+		set["description"] = *details.Description
+	}
+	if details.Cover != nil {
+		if *details.Cover == "" {
+			update["$unset"] = bson.M{"cover": ""}
+		} else {
+			set["cover"] = *details.Cover
+		}
+	}
+
+	return updateOne(ctx, "albums", bson.M{"album_id": id}, update)
+}
+
+func AddFilesToAlbum(id string, uploadIDs []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$addToSet": bson.M{"files": bson.M{"$each": uploadIDs}},
+		"$set":      bson.M{"updated_at": time.Now()},
+	}
+
+	if err := updateOne(ctx, "albums", bson.M{"album_id": id}, update); err != nil {
+		return err
+	}
+
+	coverFilter := bson.M{"album_id": id, "cover": bson.M{"$in": []interface{}{nil, ""}}}
+	return updateOne(ctx, "albums", coverFilter, bson.M{"$set": bson.M{"cover": uploadIDs[0]}})
+}
+
+func RemoveFileFromAlbum(id, uploadID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := updateOne(ctx, "albums", bson.M{"album_id": id, "cover": uploadID}, bson.M{"$unset": bson.M{"cover": ""}}); err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$pull": bson.M{"files": uploadID},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+	return updateOne(ctx, "albums", bson.M{"album_id": id}, update)
+}
+
+// RemoveUploadFromAlbums drops a deleted upload from every album that holds it.
+func RemoveUploadFromAlbums(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	uploadID := id.Hex()
+	if err := updateMany(ctx, "albums", bson.M{"cover": uploadID}, bson.M{"$unset": bson.M{"cover": ""}}); err != nil {
+		return err
+	}
+
+	return updateMany(ctx, "albums", bson.M{"files": uploadID}, bson.M{"$pull": bson.M{"files": uploadID}})
+}
+
+func SetAlbumOrder(id string, uploadIDs []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"files": uploadIDs, "updated_at": time.Now()}}
+	return updateOne(ctx, "albums", bson.M{"album_id": id}, update)
+}
+
+func DeleteAlbumFromDB(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return deleteOne(ctx, "albums", bson.M{"album_id": id})
+}
+
+// LoadUploadsByIDs returns the uploads with the given hex IDs, skipping any
+// that are malformed or gone. The result is in no particular order.
+func LoadUploadsByIDs(uploadIDs []string) ([]UploadEntry, error) {
+	var uploads []UploadEntry
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ids := make([]primitive.ObjectID, 0, len(uploadIDs))
+	for _, uploadID := range uploadIDs {
+		if id, err := primitive.ObjectIDFromHex(uploadID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	err := findMany(ctx, "uploads", bson.M{"_id": bson.M{"$in": ids}}, nil, &uploads)
+	if err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ExportedCollections make up a metadata backup. Bucket objects are not part
+// of it; back up the bucket separately.
+var ExportedCollections = []string{
+	"users", "domains", "uploads", "urls", "albums", "objects", "upload_redirects",
+}
+
+// ExportLine is one document of an export, one per line, in canonical
+// Extended JSON so that types like dates and ObjectIDs survive the trip.
+type ExportLine struct {
+	Collection string          `json:"collection"`
+	Document   json.RawMessage `json:"document"`
+}
+
+// Export writes every document of ExportedCollections to w as JSON lines and
+// returns how many it wrote per collection.
+func Export(w io.Writer) (map[string]int, error) {
+	ctx := context.Background()
+	counts := map[string]int{}
+	encoder := json.NewEncoder(w)
+
+	for _, collection := range ExportedCollections {
+		cursor, err := getCollection(collection).Find(ctx, bson.M{})
+		if err != nil {
+			return counts, err
+		}
+
+		for cursor.Next(ctx) {
+			document, err := bson.MarshalExtJSON(cursor.Current, true, false)
+			if err != nil {
+				cursor.Close(ctx)
+				return counts, err
+			}
+			if err := encoder.Encode(ExportLine{Collection: collection, Document: document}); err != nil {
+				cursor.Close(ctx)
+				return counts, err
+			}
+			counts[collection]++
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return counts, err
+		}
+	}
+	return counts, nil
+}
+
+type ImportResult struct {
+	Inserted map[string]int `json:"inserted"`
+	Replaced map[string]int `json:"replaced"`
+	Skipped  map[string]int `json:"skipped"`
+}
+
+// Import reads an export back. Documents that already exist are skipped, or
+// overwritten by _id when replace is set.
+func Import(r io.Reader, replace bool) (ImportResult, error) {
+	ctx := context.Background()
+	result := ImportResult{Inserted: map[string]int{}, Replaced: map[string]int{}, Skipped: map[string]int{}}
+
+	known := map[string]bool{}
+	for _, collection := range ExportedCollections {
+		known[collection] = true
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry ExportLine
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return result, fmt.Errorf("line %d: %w", line, err)
+		}
+		if !known[entry.Collection] {
+			return result, fmt.Errorf("line %d: unknown collection %q", line, entry.Collection)
+		}
+
+		var document bson.D
+		if err := bson.UnmarshalExtJSON(entry.Document, true, &document); err != nil {
+			return result, fmt.Errorf("line %d: %w", line, err)
+		}
+		var id interface{}
+		for _, field := range document {
+			if field.Key == "_id" {
+				id = field.Value
+			}
+		}
+		if id == nil {
+			return result, fmt.Errorf("line %d: document has no _id", line)
+		}
+
+		collection := getCollection(entry.Collection)
+		if replace {
+			res, err := collection.ReplaceOne(ctx, bson.M{"_id": id}, document, options.Replace().SetUpsert(true))
+			if err != nil {
+				return result, fmt.Errorf("line %d: %w", line, err)
+			}
+			if res.UpsertedCount > 0 {
+				result.Inserted[entry.Collection]++
+			} else {
+				result.Replaced[entry.Collection]++
+			}
+			continue
+		}
+
+		if _, err := collection.InsertOne(ctx, document); err != nil {
+			if IsDuplicateKey(err) {
+				result.Skipped[entry.Collection]++
+				continue
+			}
+			return result, fmt.Errorf("line %d: %w", line, err)
+		}
+		result.Inserted[entry.Collection]++
+	}
+	return result, scanner.Err()
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// IdempotentRequest is a request sent with an Idempotency-Key and, once it
+// has finished, the response to replay for retries. Status is 0 while the
+// first request is still running, and ErrorCode is the /api/v1 code of an
+// error response. The TTL index on ExpiresAt removes records whose window has
+// passed, and reservations left behind by a crash.
+type IdempotentRequest struct {
+	APIKey      string    `bson:"api_key"`
+	Key         string    `bson:"idempotency_key"`
+	Fingerprint string    `bson:"fingerprint"`
+	Status      int       `bson:"status"`
+	ErrorCode   string    `bson:"error_code,omitempty"`
+	ContentType string    `bson:"content_type,omitempty"`
+	Body        []byte    `bson:"body,omitempty"`
+	CreatedAt   time.Time `bson:"created_at"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+func idempotencyFilter(apiKey, key string) bson.M {
+	return bson.M{"api_key": apiKey, "idempotency_key": key}
+}
+
+// ReserveIdempotencyKey records that request is starting. If the key is
+// already held it returns the existing record and false instead.
+func ReserveIdempotencyKey(request IdempotentRequest) (IdempotentRequest, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// BSON dates hold milliseconds; truncating keeps CreatedAt equal to what
+	// DeleteIdempotencyKey will match against.
+	request.CreatedAt = request.CreatedAt.Truncate(time.Millisecond)
+	_, err := getCollection("idempotency_keys").InsertOne(ctx, request)
+	if err == nil {
+		return request, true, nil
+	}
+	if !IsDuplicateKey(err) {
+		return IdempotentRequest{}, false, err
+	}
+
+	var existing IdempotentRequest
+	err = findOne(ctx, "idempotency_keys", idempotencyFilter(request.APIKey, request.Key), &existing)
+	return existing, false, err
+}
+
+// CompleteIdempotencyKey stores the response to replay for the key until
+// expiresAt.
+func CompleteIdempotencyKey(apiKey, key string, status int, errorCode, contentType string, body []byte, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"status":       status,
+		"error_code":   errorCode,
+		"content_type": contentType,
+		"body":         body,
+		"expires_at":   expiresAt,
+	}}
+	_, err := getCollection("idempotency_keys").UpdateOne(ctx, idempotencyFilter(apiKey, key), update)
+	return err
+}
+
+// DeleteIdempotencyKey forgets the record created at createdAt, so the key
+// can be used again: after the request failed in a way worth retrying, or
+// once the record has expired but the TTL monitor has not removed it yet.
+// Matching createdAt leaves a newer reservation by another request alone.
+func DeleteIdempotencyKey(apiKey, key string, createdAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := idempotencyFilter(apiKey, key)
+	filter["created_at"] = createdAt
+	_, err := getCollection("idempotency_keys").DeleteOne(ctx, filter)
+	return err
+}
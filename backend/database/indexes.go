@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// uniqueFields are the generated identifiers that must never repeat. The
+// unique indexes turn a collision into a duplicate key error the save paths
+// retry on, instead of two records silently sharing an ID. Upload names are
+// only unique per domain; see EnsureUploadNameIndexes.
+var uniqueFields = map[string]string{
+	"users":  "api_key",
+	"urls":   "slug",
+	"albums": "album_id",
+}
+
+// EnsureUniqueIndexes creates the unique identifier indexes. Each is created
+// on its own so existing duplicates in one collection don't block the rest.
+func EnsureUniqueIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var errs []error
+	for collection, field := range uniqueFields {
+		_, err := getCollection(collection).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: field, Value: 1}},
+			Options: options.Index().SetUnique(true),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s.%s: %w", collection, field, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// IsDuplicateKey reports whether err came from a unique index rejecting a
+// write.
+func IsDuplicateKey(err error) bool {
+	return mongo.IsDuplicateKeyError(err)
+}
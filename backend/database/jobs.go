@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job is a unit of background work. Key is the API key that asked for it and
+// the only non-admin key allowed to read its status, even after the account
+// behind it is gone.
+type Job struct {
+	ID          primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	Type        string                 `bson:"type" json:"type"`
+	Key         string                 `bson:"api_key" json:"-"`
+	Payload     map[string]string      `bson:"payload" json:"payload"`
+	Status      string                 `bson:"status" json:"status"`
+	Attempts    int                    `bson:"attempts" json:"attempts"`
+	MaxAttempts int                    `bson:"max_attempts" json:"maxAttempts"`
+	LastError   string                 `bson:"last_error,omitempty" json:"lastError,omitempty"`
+	Result      map[string]interface{} `bson:"result,omitempty" json:"result,omitempty"`
+	RunAt       time.Time              `bson:"run_at" json:"runAt"`
+	LockedUntil *time.Time             `bson:"locked_until,omitempty" json:"-"`
+	CreatedAt   time.Time              `bson:"created_at" json:"createdAt"`
+	FinishedAt  *time.Time             `bson:"finished_at,omitempty" json:"finishedAt,omitempty"`
+}
+
+func SaveJob(job *Job) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := getCollection("jobs").InsertOne(ctx, job)
+	if err != nil {
+		return err
+	}
+	job.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ClaimJob leases the next due job for lease. A running job whose lease ran
+// out belonged to a worker that died and is picked up again. It returns
+// mongo.ErrNoDocuments when nothing is due.
+func ClaimJob(lease time.Duration) (Job, error) {
+	var job Job
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{"$or": []bson.M{
+		{"status": JobQueued, "run_at": bson.M{"$lte": now}},
+		{"status": JobRunning, "locked_until": bson.M{"$lt": now}},
+	}}
+	update := bson.M{
+		"$set": bson.M{"status": JobRunning, "locked_until": now.Add(lease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "run_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	err := getCollection("jobs").FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	return job, err
+}
+
+func FinishJob(id primitive.ObjectID, result map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set":   bson.M{"status": JobSucceeded, "result": result, "finished_at": time.Now()},
+		"$unset": bson.M{"locked_until": "", "last_error": ""},
+	}
+	return updateOne(ctx, "jobs", bson.M{"_id": id}, update)
+}
+
+// RetryJob puts a failed job back in the queue to run again at runAt.
+func RetryJob(id primitive.ObjectID, cause error, runAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set":   bson.M{"status": JobQueued, "last_error": cause.Error(), "run_at": runAt},
+		"$unset": bson.M{"locked_until": ""},
+	}
+	return updateOne(ctx, "jobs", bson.M{"_id": id}, update)
+}
+
+// FailJob gives up on a job for good.
+func FailJob(id primitive.ObjectID, cause error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set":   bson.M{"status": JobFailed, "last_error": cause.Error(), "finished_at": time.Now()},
+		"$unset": bson.M{"locked_until": ""},
+	}
+	return updateOne(ctx, "jobs", bson.M{"_id": id}, update)
+}
+
+func GetJob(id primitive.ObjectID) (Job, error) {
+	var job Job
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := findOne(ctx, "jobs", bson.M{"_id": id}, &job)
+	return job, err
+}
+
+// LoadJobs returns the newest jobs, optionally only those requested by key
+// or in a given status.
+func LoadJobs(key, status string, limit int64) ([]Job, error) {
+	var jobs []Job
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if key != "" {
+		filter["api_key"] = key
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit)
+
+	if err := findMany(ctx, "jobs", filter, opts, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
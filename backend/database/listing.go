@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListQuery describes one page of a user's uploads or URLs. Filters left at
+// their zero value are not applied, and a zero Limit returns every match.
+type ListQuery struct {
+	Key       string
+	Search    string
+	Domain    string
+	From      time.Time
+	To        time.Time
+	Sort      string
+	Ascending bool
+	Cursor    string
+	Limit     int64
+
+	// Upload-only filters.
+	Type    string
+	Tag     string
+	MinSize int64
+	MaxSize int64
+}
+
+// PageInfo is returned alongside a page. NextCursor is empty on the last page.
+type PageInfo struct {
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// listCursor is the position after the last item of a page: the value of the
+// sort field and the _id that breaks ties between equal values.
+type listCursor struct {
+	Value int64  `json:"v,omitempty"`
+	ID    string `json:"id"`
+}
+
+func encodeCursor(value int64, id primitive.ObjectID) string {
+	raw, _ := json.Marshal(listCursor{Value: value, ID: id.Hex()})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(cursor string) (listCursor, primitive.ObjectID, error) {
+	var decoded listCursor
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || json.Unmarshal(raw, &decoded) != nil {
+		return decoded, primitive.NilObjectID, ErrInvalidCursor
+	}
+	id, err := primitive.ObjectIDFromHex(decoded.ID)
+	if err != nil {
+		return decoded, primitive.NilObjectID, ErrInvalidCursor
+	}
+	return decoded, id, nil
+}
+
+// dateRangeFilter bounds creation time through the _id, which every document
+// has, rather than the per-collection date fields whose types differ.
+func dateRangeFilter(from, to time.Time) bson.M {
+	idRange := bson.M{}
+	if !from.IsZero() {
+		idRange["$gte"] = primitive.NewObjectIDFromTimestamp(from)
+	}
+	if !to.IsZero() {
+		idRange["$lt"] = primitive.NewObjectIDFromTimestamp(to)
+	}
+	if len(idRange) == 0 {
+		return nil
+	}
+	return bson.M{"_id": idRange}
+}
+
+// keysetPage applies the cursor and sort to conditions and fetches one page
+// into out. Sorting on _id alone is used for date order.
+func keysetPage(collection string, conditions []bson.M, sortField string, ascending bool, cursor string, limit int64, out interface{}) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	total, err := getCollection(collection).CountDocuments(ctx, bson.M{"$and": conditions})
+	if err != nil {
+		return 0, err
+	}
+
+	direction, compare := -1, "$lt"
+	if ascending {
+		direction, compare = 1, "$gt"
+	}
+
+	if cursor != "" {
+		position, id, err := decodeCursor(cursor)
+		if err != nil {
+			return 0, err
+		}
+		if sortField == "_id" {
+			conditions = append(conditions, bson.M{"_id": bson.M{compare: id}})
+		} else {
+			conditions = append(conditions, bson.M{"$or": []bson.M{
+				{sortField: bson.M{compare: position.Value}},
+				{sortField: position.Value, "_id": bson.M{compare: id}},
+			}})
+		}
+	}
+
+	sort := bson.D{{Key: "_id", Value: direction}}
+	if sortField != "_id" {
+		sort = bson.D{{Key: sortField, Value: direction}, {Key: "_id", Value: direction}}
+	}
+
+	opts := options.Find().SetSort(sort)
+	if limit > 0 {
+		// One extra document tells us whether another page exists.
+		opts.SetLimit(limit + 1)
+	}
+
+	return total, findMany(ctx, collection, bson.M{"$and": conditions}, opts, out)
+}
+
+var uploadSortFields = map[string]string{
+	"date":  "_id",
+	"size":  "metadata.file_size",
+	"views": "metadata.views",
+}
+
+var urlSortFields = map[string]string{
+	"date":   "_id",
+	"clicks": "clicks",
+}
+
+func ValidUploadSort(sort string) bool {
+	_, ok := uploadSortFields[sort]
+	return ok
+}
+
+func ValidURLSort(sort string) bool {
+	_, ok := urlSortFields[sort]
+	return ok
+}
+
+func ListUploads(query ListQuery) ([]UploadEntry, PageInfo, error) {
+	var uploads []UploadEntry
+
+	conditions := []bson.M{{"api_key": query.Key}, notTrashed()}
+	if query.Search != "" {
+		conditions = append(conditions, bson.M{"$or": uploadTextFilters(query.Search)})
+	}
+	if query.Tag != "" {
+		conditions = append(conditions, bson.M{"tags": query.Tag})
+	}
+	if query.Domain != "" {
+		conditions = append(conditions, bson.M{"domain": query.Domain})
+	}
+	if query.Type != "" {
+		// Uploads from before upload types existed have no type and are files.
+		if query.Type == "file" {
+			conditions = append(conditions, bson.M{"type": bson.M{"$in": []interface{}{"file", "", nil}}})
+		} else {
+			conditions = append(conditions, bson.M{"type": query.Type})
+		}
+	}
+	if dates := dateRangeFilter(query.From, query.To); dates != nil {
+		conditions = append(conditions, dates)
+	}
+	size := bson.M{}
+	if query.MinSize > 0 {
+		size["$gte"] = query.MinSize
+	}
+	if query.MaxSize > 0 {
+		size["$lte"] = query.MaxSize
+	}
+	if len(size) > 0 {
+		conditions = append(conditions, bson.M{"metadata.file_size": size})
+	}
+
+	sortField, ok := uploadSortFields[query.Sort]
+	if !ok {
+		sortField = "_id"
+	}
+
+	total, err := keysetPage("uploads", conditions, sortField, query.Ascending, query.Cursor, query.Limit, &uploads)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	info := PageInfo{Total: total}
+	if query.Limit > 0 && int64(len(uploads)) > query.Limit {
+		uploads = uploads[:query.Limit]
+		last := uploads[len(uploads)-1]
+		value := int64(0)
+		switch sortField {
+		case "metadata.file_size":
+			value = last.Metadata.FileSize
+		case "metadata.views":
+			value = int64(last.Metadata.Views)
+		}
+		info.HasMore = true
+		info.NextCursor = encodeCursor(value, last.ID)
+	}
+
+	return uploads, info, nil
+}
+
+func ListURLs(query ListQuery) ([]URL, PageInfo, error) {
+	var urls []URL
+
+	conditions := []bson.M{{"api_key": query.Key}, notTrashed()}
+	if query.Search != "" {
+		conditions = append(conditions, bson.M{"$or": []bson.M{
+			{"slug": containsFilter(query.Search)},
+			{"url": containsFilter(query.Search)},
+		}})
+	}
+	if query.Domain != "" {
+		conditions = append(conditions, bson.M{"domain": query.Domain})
+	}
+	if dates := dateRangeFilter(query.From, query.To); dates != nil {
+		conditions = append(conditions, dates)
+	}
+
+	sortField, ok := urlSortFields[query.Sort]
+	if !ok {
+		sortField = "_id"
+	}
+
+	total, err := keysetPage("urls", conditions, sortField, query.Ascending, query.Cursor, query.Limit, &urls)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	info := PageInfo{Total: total}
+	if query.Limit > 0 && int64(len(urls)) > query.Limit {
+		urls = urls[:query.Limit]
+		last := urls[len(urls)-1]
+		value := int64(0)
+		if sortField == "clicks" {
+			value = int64(last.Clicks)
+		}
+		info.HasMore = true
+		info.NextCursor = encodeCursor(value, last.ID)
+	}
+
+	return urls, info, nil
+}
@@ -0,0 +1,398 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is one versioned schema change. Up must be safe to run twice: an
+// instance that dies between applying and recording it runs it again on the
+// next start, and two instances starting together may both run it.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context) error
+}
+
+// AppliedMigration is the record kept in schema_migrations for each migration
+// that has run.
+type AppliedMigration struct {
+	Version     int       `bson:"version" json:"version"`
+	Description string    `bson:"description" json:"description"`
+	AppliedAt   time.Time `bson:"applied_at" json:"appliedAt"`
+}
+
+// MigrationState pairs a known migration with when it was applied, if ever.
+type MigrationState struct {
+	Version     int        `json:"version"`
+	Description string     `json:"description"`
+	AppliedAt   *time.Time `json:"appliedAt,omitempty"`
+}
+
+const migrationTimeout = 10 * time.Minute
+
+// migrations are applied in Version order. Never renumber or edit one that
+// has shipped; add a new one instead.
+var migrations = []Migration{
+	{1, "store user and URL creation dates as BSON dates", convertCreatedAtDates},
+	{2, "unique identifier indexes", func(context.Context) error { return EnsureUniqueIndexes() }},
+	{3, "lookup indexes", createLookupIndexes},
+	{4, "search text indexes", func(context.Context) error { return EnsureSearchIndexes() }},
+	{5, "rename redirect indexes", func(context.Context) error { return EnsureRedirectIndexes() }},
+	{6, "storage outbox index", createOutboxIndex},
+	{7, "job queue indexes", createJobIndexes},
+	{8, "idempotency key indexes", createIdempotencyIndexes},
+	{9, "storage usage of existing users", recalculateAllUsage},
+	{10, "upload names unique per domain", uniqueUploadNamesPerDomain},
+	{11, "identify uploads by ID rather than file name", identifyUploadsByID},
+}
+
+// RunMigrations applies every migration not yet recorded in schema_migrations
+// and returns the ones it applied. It stops at the first failure, leaving the
+// later ones pending.
+func RunMigrations() ([]AppliedMigration, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []AppliedMigration
+	for _, migration := range sortedMigrations() {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		log.Printf("Applying migration %d: %s", migration.Version, migration.Description)
+		if err := runMigration(migration); err != nil {
+			return ran, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+		}
+
+		record := AppliedMigration{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now(),
+		}
+		if err := recordMigration(record); err != nil {
+			return ran, err
+		}
+		ran = append(ran, record)
+	}
+	return ran, nil
+}
+
+// MigrationStatus lists every known migration and when it was applied.
+func MigrationStatus() ([]MigrationState, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	for _, migration := range sortedMigrations() {
+		state := MigrationState{Version: migration.Version, Description: migration.Description}
+		if record, ok := applied[migration.Version]; ok {
+			state.AppliedAt = &record.AppliedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+func sortedMigrations() []Migration {
+	sorted := append([]Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return sorted
+}
+
+func runMigration(migration Migration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+	return migration.Up(ctx)
+}
+
+func appliedMigrations() (map[int]AppliedMigration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	collection := getCollection("schema_migrations")
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []AppliedMigration
+	if err := findMany(ctx, "schema_migrations", bson.M{}, nil, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]AppliedMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// recordMigration saves a migration as applied. Another instance recording
+// the same migration first is not an error.
+func recordMigration(record AppliedMigration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := getCollection("schema_migrations").InsertOne(ctx, record)
+	if IsDuplicateKey(err) {
+		return nil
+	}
+	return err
+}
+
+// convertCreatedAtDates turns the RFC3339 strings users and URLs used to be
+// saved with into dates. Strings that don't parse fall back to the time in
+// the document's ObjectID, which is when it was inserted.
+func convertCreatedAtDates(ctx context.Context) error {
+	fallback := bson.M{"$toDate": "$_id"}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"created_at": bson.M{"$convert": bson.M{
+			"input":   "$created_at",
+			"to":      "date",
+			"onError": fallback,
+			"onNull":  fallback,
+		}},
+	}}}}
+
+	for _, collection := range []string{"users", "urls"} {
+		result, err := getCollection(collection).UpdateMany(ctx, bson.M{"created_at": bson.M{"$type": "string"}}, update)
+		if err != nil {
+			return fmt.Errorf("%s: %w", collection, err)
+		}
+		log.Printf("Converted created_at on %d %s", result.ModifiedCount, collection)
+	}
+	return nil
+}
+
+// createLookupIndexes covers the filters the handlers run on every request:
+// listings by owner, dedup by content hash, trash purges and shared objects.
+func createLookupIndexes(ctx context.Context) error {
+	indexes := map[string][]mongo.IndexModel{
+		"uploads": {
+			{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "_id", Value: -1}}},
+			{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "sha256", Value: 1}}},
+			{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+		},
+		"urls": {
+			{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "_id", Value: -1}}},
+			{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+		},
+		"albums": {
+			{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "_id", Value: -1}}},
+			{Keys: bson.D{{Key: "files", Value: 1}}},
+		},
+		"domains": {
+			{Keys: bson.D{{Key: "name", Value: 1}}},
+		},
+		"objects": {
+			{Keys: bson.D{{Key: "storage_key", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "sha256", Value: 1}, {Key: "public", Value: 1}}},
+		},
+	}
+
+	for collection, models := range indexes {
+		if _, err := getCollection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("%s: %w", collection, err)
+		}
+	}
+	return nil
+}
+
+func createOutboxIndex(ctx context.Context) error {
+	_, err := getCollection("storage_outbox").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "next_attempt_at", Value: 1}},
+	})
+	return err
+}
+
+func createJobIndexes(ctx context.Context) error {
+	_, err := getCollection("jobs").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "run_at", Value: 1}}},
+		{Keys: bson.D{{Key: "api_key", Value: 1}, {Key: "_id", Value: -1}}},
+	})
+	return err
+}
+
+func createIdempotencyIndexes(ctx context.Context) error {
+	_, err := getCollection("idempotency_keys").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "api_key", Value: 1}, {Key: "idempotency_key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+// recalculateAllUsage fills in the usage counters of users who uploaded before
+// quotas were tracked, whose counters would otherwise start from zero.
+func recalculateAllUsage(ctx context.Context) error {
+	cursor, err := getCollection("users").Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"api_key": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	updated := 0
+	for cursor.Next(ctx) {
+		var user struct {
+			Key string `bson:"api_key"`
+		}
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+		if _, err := RecalculateUsage(user.Key); err != nil {
+			return fmt.Errorf("after %d users: %w", updated, err)
+		}
+		updated++
+	}
+	log.Printf("Recalculated usage for %d users", updated)
+	return cursor.Err()
+}
+
+// uniqueUploadNamesPerDomain gives every upload a name field holding its file
+// name without the extension, and redirects the domain of their upload, so
+// names can be unique per domain. Uploads that would share a name with an
+// older one on the same domain keep their full file name as the name.
+func uniqueUploadNamesPerDomain(ctx context.Context) error {
+	found := bson.M{"$regexFind": bson.M{"input": "$file_name", "regex": `^(.+)\.[^.]*$`}}
+	baseName := bson.M{"$let": bson.M{
+		"vars": bson.M{"found": found},
+		"in":   bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$$found.captures", 0}}, "$file_name"}},
+	}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{"name": baseName}}}}
+	if _, err := getCollection("uploads").UpdateMany(ctx, bson.M{"name": bson.M{"$exists": false}}, update); err != nil {
+		return err
+	}
+
+	cursor, err := getCollection("uploads").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        bson.M{"name": "$name", "domain": "$domain"},
+			"file_names": bson.M{"$push": "$file_name"},
+		}}},
+		{{Key: "$match", Value: bson.M{"file_names.1": bson.M{"$exists": true}}}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var group struct {
+			FileNames []string `bson:"file_names"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return err
+		}
+		for _, fileName := range group.FileNames[1:] {
+			if err := updateOne(ctx, "uploads", bson.M{"file_name": fileName}, bson.M{"$set": bson.M{"name": fileName}}); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	var redirects []UploadRedirect
+	if err := findMany(ctx, "upload_redirects", bson.M{"domain": bson.M{"$exists": false}}, nil, &redirects); err != nil {
+		return err
+	}
+	for _, redirect := range redirects {
+		var upload UploadEntry
+		if err := findOne(ctx, "uploads", bson.M{"file_name": redirect.FileName}, &upload); err != nil || upload.Domain == "" {
+			continue
+		}
+		filter := bson.M{"name": redirect.Name, "file_name": redirect.FileName}
+		if err := updateOne(ctx, "upload_redirects", filter, bson.M{"$set": bson.M{"domain": upload.Domain}}); err != nil {
+			return err
+		}
+	}
+
+	return EnsureUploadNameIndexes(ctx)
+}
+
+// identifyUploadsByID drops the global unique file name index, which kept the
+// same name from being used on two domains, and moves the references that
+// relied on it to upload IDs: redirects gain the ID of their upload, and album
+// files and covers are rewritten from file names to IDs.
+func identifyUploadsByID(ctx context.Context) error {
+	uploads := getCollection("uploads")
+	if _, err := uploads.Indexes().DropOne(ctx, "file_name_1"); err != nil && !isIndexNotFound(err) {
+		return fmt.Errorf("uploads: %w", err)
+	}
+	if _, err := uploads.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "file_name", Value: 1}}}); err != nil {
+		return fmt.Errorf("uploads: %w", err)
+	}
+
+	var redirects []UploadRedirect
+	if err := findMany(ctx, "upload_redirects", bson.M{"upload_id": bson.M{"$exists": false}}, nil, &redirects); err != nil {
+		return err
+	}
+	for _, redirect := range redirects {
+		var upload UploadEntry
+		filter := bson.M{"file_name": redirect.FileName, "domain": domainFilter(redirect.Domain)}
+		if err := findOne(ctx, "uploads", filter, &upload); err != nil {
+			continue
+		}
+		filter = bson.M{"name": redirect.Name, "domain": domainFilter(redirect.Domain)}
+		if err := updateOne(ctx, "upload_redirects", filter, bson.M{"$set": bson.M{"upload_id": upload.ID}}); err != nil {
+			return err
+		}
+	}
+
+	var albums []Album
+	if err := findMany(ctx, "albums", bson.M{}, nil, &albums); err != nil {
+		return err
+	}
+	for _, album := range albums {
+		toID := func(file string) string {
+			if _, err := primitive.ObjectIDFromHex(file); err == nil {
+				return file
+			}
+			var upload UploadEntry
+			if err := findOne(ctx, "uploads", bson.M{"file_name": file, "api_key": album.Key}, &upload); err != nil {
+				return ""
+			}
+			return upload.ID.Hex()
+		}
+
+		files := make([]string, 0, len(album.Files))
+		for _, file := range album.Files {
+			if id := toID(file); id != "" {
+				files = append(files, id)
+			}
+		}
+		set := bson.M{"files": files}
+		update := bson.M{"$set": set}
+		if cover := toID(album.Cover); cover != "" {
+			set["cover"] = cover
+		} else if album.Cover != "" {
+			update["$unset"] = bson.M{"cover": ""}
+		}
+		if err := updateOne(ctx, "albums", bson.M{"album_id": album.ID}, update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,36 +4,51 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"path"
 	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/constants"
 )
 
 var client *mongo.Client
 var db *mongo.Database
 
-func init() {
-	var err error
-	client, err = mongo.Connect(context.Background(), options.Client().ApplyURI(config.AppConfigInstance.MongoDB_URI))
+const databaseName = "ShareX-Uploader"
+
+// Connect dials MongoDB at the configured URI and checks that it answers. It
+// must be called before anything else in the package is used.
+func Connect() error {
+	c, err := mongo.Connect(context.Background(), options.Client().ApplyURI(config.AppConfigInstance.MongoDB_URI))
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		return fmt.Errorf("connecting to MongoDB: %w", err)
 	}
 
 	// Test the connection
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	if err = client.Ping(ctx, nil); err != nil {
-		log.Fatalf("Failed to ping MongoDB: %v", err)
+	if err := c.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("pinging MongoDB: %w", err)
 	}
 
-	db = client.Database("ShareX-Uploader")
-
+	Use(c)
 	log.Println("Successfully connected to MongoDB!")
+	return nil
+}
+
+// Use points the package at a client that is already connected, such as a
+// mock deployment in tests.
+func Use(c *mongo.Client) {
+	client = c
+	db = c.Database(databaseName)
 }
 
 // Helper function to get a collection
@@ -108,21 +123,44 @@ func containsFilter(query string) bson.M {
 }
 
 type User struct {
-	Key         string `bson:"api_key" json:"key"`
-	Admin       bool   `bson:"admin" json:"admin"`
-	DisplayName string `bson:"display_name" json:"displayName"`
-	CreatedAt   string `bson:"created_at" json:"createdAt"`
-	IP          string `bson:"ip" json:"ip"`
-	Domain      string `bson:"domain" json:"domain"`
+	Key         string      `bson:"api_key" json:"key"`
+	Admin       bool        `bson:"admin" json:"admin"`
+	DisplayName string      `bson:"display_name" json:"displayName"`
+	CreatedAt   time.Time   `bson:"created_at" json:"createdAt"`
+	IP          string      `bson:"ip" json:"ip"`
+	Domain      string      `bson:"domain" json:"domain"`
+	Usage       Usage       `bson:"usage" json:"usage"`
+	Limits      *UserLimits `bson:"limits,omitempty" json:"limits,omitempty"`
+	NameStyle   string      `bson:"name_style,omitempty" json:"nameStyle,omitempty"`
+
+	// Quota holds the limits that actually apply to the user once defaults
+	// are merged in. It is filled in for responses and never stored.
+	Quota *UserLimits `bson:"-" json:"quota,omitempty"`
+}
+
+type Usage struct {
+	Bytes int64 `bson:"bytes" json:"bytes"`
+	Files int64 `bson:"files" json:"files"`
+}
+
+// UserLimits caps what a user may store. In a per-user override a zero field
+// inherits the configured default and -1 lifts the limit entirely.
+type UserLimits struct {
+	MaxBytes    int64 `bson:"max_bytes" json:"maxBytes"`
+	MaxFiles    int64 `bson:"max_files" json:"maxFiles"`
+	MaxFileSize int64 `bson:"max_file_size" json:"maxFileSize"`
 }
 
 type URL struct {
-	Key       string `bson:"api_key" json:"key"`
-	URL       string `bson:"url" json:"url"`
-	CreatedAt string `bson:"created_at" json:"createdAt"`
-	IP        string `bson:"ip" json:"ip"`
-	Slug      string `bson:"slug" json:"slug"`
-	Clicks    int    `bson:"clicks" json:"clicks"`
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Key       string             `bson:"api_key" json:"key"`
+	URL       string             `bson:"url" json:"url"`
+	CreatedAt time.Time          `bson:"created_at" json:"createdAt"`
+	IP        string             `bson:"ip" json:"ip"`
+	Slug      string             `bson:"slug" json:"slug"`
+	Clicks    int                `bson:"clicks" json:"clicks"`
+	Domain    string             `bson:"domain,omitempty" json:"domain,omitempty"`
+	DeletedAt *time.Time         `bson:"deleted_at,omitempty" json:"deletedAt,omitempty"`
 }
 
 type Metadata struct {
@@ -132,12 +170,106 @@ type Metadata struct {
 	Views      int       `bson:"views" json:"views"`
 }
 
+// ObjectEncryption describes how a stored object was sealed. WrappedKey is the
+// object's data key encrypted under the master key named by KeyID. Objects
+// are sealed in chunks of ChunkSize plaintext bytes; 0 means the object was
+// sealed in one piece, as before chunking.
+type ObjectEncryption struct {
+	KeyID      string `bson:"key_id"`
+	WrappedKey []byte `bson:"wrapped_key"`
+	Nonce      []byte `bson:"nonce"`
+	ChunkSize  int    `bson:"chunk_size,omitempty"`
+}
+
 type UploadEntry struct {
-	IP          string   `bson:"ip" json:"ip"`
-	Key         string   `bson:"api_key" json:"key"`
-	DisplayName string   `bson:"display_name" json:"displayName"`
-	FileName    string   `bson:"file_name" json:"fileName"`
-	Metadata    Metadata `bson:"metadata" json:"metadata"`
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	IP           string             `bson:"ip" json:"ip"`
+	Key          string             `bson:"api_key" json:"key"`
+	DisplayName  string             `bson:"display_name" json:"displayName"`
+	FileName     string             `bson:"file_name" json:"fileName"`
+	Name         string             `bson:"name,omitempty" json:"-"`
+	Domain       string             `bson:"domain,omitempty" json:"domain,omitempty"`
+	Metadata     Metadata           `bson:"metadata" json:"metadata"`
+	Type         string             `bson:"type,omitempty" json:"type"`
+	Cipher       string             `bson:"cipher,omitempty" json:"cipher,omitempty"`
+	Visibility   string             `bson:"visibility,omitempty" json:"visibility"`
+	Protected    bool               `bson:"protected" json:"protected"`
+	PasswordHash string             `bson:"password_hash,omitempty" json:"-"`
+	Hash         string             `bson:"sha256,omitempty" json:"sha256,omitempty"`
+	StorageKey   string             `bson:"storage_key,omitempty" json:"-"`
+
+	OriginalName string   `bson:"original_name,omitempty" json:"originalName,omitempty"`
+	Title        string   `bson:"title,omitempty" json:"title,omitempty"`
+	Description  string   `bson:"description,omitempty" json:"description,omitempty"`
+	Tags         []string `bson:"tags,omitempty" json:"tags,omitempty"`
+
+	Version     int             `bson:"version,omitempty" json:"version,omitempty"`
+	VersionedAt *time.Time      `bson:"versioned_at,omitempty" json:"versionedAt,omitempty"`
+	Versions    []UploadVersion `bson:"versions,omitempty" json:"-"`
+
+	// ShownVersion is set by AtVersion when the entry describes an earlier
+	// version rather than the current content.
+	ShownVersion int `bson:"-" json:"-"`
+
+	DeletedAt  *time.Time        `bson:"deleted_at,omitempty" json:"deletedAt,omitempty"`
+	Encryption *ObjectEncryption `bson:"encryption,omitempty" json:"-"`
+
+	// MissingAt is set by the storage reconciler when the object behind the
+	// upload could not be found in the bucket.
+	MissingAt *time.Time `bson:"missing_at,omitempty" json:"missingAt,omitempty"`
+}
+
+// UploadDetails are the user-editable descriptive fields of an upload. Nil
+// fields are left unchanged by UpdateUploadDetails.
+type UploadDetails struct {
+	OriginalName *string   `json:"originalName"`
+	Title        *string   `json:"title"`
+	Description  *string   `json:"description"`
+	Tags         *[]string `json:"tags"`
+}
+
+// DownloadName is the filename offered when the upload is saved, falling back
+// to the generated name for uploads that predate original names.
+func (u UploadEntry) DownloadName() string {
+	if u.OriginalName != "" {
+		return u.OriginalName
+	}
+	return u.FileName
+}
+
+// ObjectKey is the bucket key holding the upload's bytes. It only differs from
+// FileName when the upload shares a deduplicated object.
+func (u UploadEntry) ObjectKey() string {
+	if u.StorageKey != "" {
+		return u.StorageKey
+	}
+	return u.FileName
+}
+
+// IsEncrypted reports whether the object is client-side ciphertext. The server
+// never inspects, transforms or derives anything from these bytes.
+func (u UploadEntry) IsEncrypted() bool {
+	return u.Type == constants.UploadTypeEncrypted
+}
+
+// StoredPrivately reports whether the object lacks a public ACL and can only
+// be read through the /i/:file/raw proxy.
+func (u UploadEntry) StoredPrivately() bool {
+	return u.Protected || u.Visibility == constants.VisibilityPrivate || u.Encryption != nil || u.Trashed() || u.ShownVersion != 0
+}
+
+// EffectiveVisibility is the upload's visibility, reading the empty value of
+// uploads saved before visibility existed as public.
+func (u UploadEntry) EffectiveVisibility() string {
+	if u.Visibility == "" {
+		return constants.VisibilityPublic
+	}
+	return u.Visibility
+}
+
+// Trashed reports whether the upload is in its owner's trash awaiting purge.
+func (u UploadEntry) Trashed() bool {
+	return u.DeletedAt != nil
 }
 
 type Domain struct {
@@ -248,29 +380,38 @@ func UpdateUserDisplayName(key, displayName string) error {
 	return err
 }
 
+// DeleteUserByKey removes a user and everything they own. Uploads go first, in
+// batches, and the user record with the rest in one final transaction, so a
+// failure part way leaves the user in place and running it again resumes.
+// Their stored objects are queued in the storage outbox rather than deleted
+// here, so the bytes only go once the records are gone for good.
 func DeleteUserByKey(key string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	filter := bson.M{"api_key": key}
-	if err := deleteOne(ctx, "users", filter); err != nil {
-		return err
-	}
-
-	uploadFilter := bson.M{"api_key": key}
-	if _, err := getCollection("uploads").DeleteMany(ctx, uploadFilter); err != nil {
+	if _, err := deleteUserUploads(key); err != nil {
 		log.Printf("Error deleting uploads for user: %v", err)
 		return err
 	}
 
-	domainFilter := bson.M{"allowed": key}
-	domainUpdate := bson.M{"$pull": bson.M{"allowed": key}}
-	if _, err := getCollection("domains").UpdateMany(ctx, domainFilter, domainUpdate); err != nil {
-		log.Printf("Error removing user key from domains: %v", err)
-		return err
-	}
+	return withTransaction(time.Minute, func(ctx context.Context) error {
+		if err := deleteOne(ctx, "users", bson.M{"api_key": key}); err != nil {
+			return err
+		}
 
-	return nil
+		for _, collection := range []string{"urls", "albums"} {
+			if _, err := getCollection(collection).DeleteMany(ctx, bson.M{"api_key": key}); err != nil {
+				log.Printf("Error deleting %s for user: %v", collection, err)
+				return err
+			}
+		}
+
+		allowedFilter := bson.M{"allowed": key}
+		domainUpdate := bson.M{"$pull": bson.M{"allowed": key}}
+		if _, err := getCollection("domains").UpdateMany(ctx, allowedFilter, domainUpdate); err != nil {
+			log.Printf("Error removing user key from domains: %v", err)
+			return err
+		}
+
+		return nil
+	})
 }
 
 func SaveURLToDB(url URL) error {
@@ -301,6 +442,16 @@ func LoadUploadsFromDB(key string) ([]UploadEntry, error) {
 	return logs, nil
 }
 
+func uploadTextFilters(query string) []bson.M {
+	return []bson.M{
+		{"file_name": containsFilter(query)},
+		{"original_name": containsFilter(query)},
+		{"title": containsFilter(query)},
+		{"description": containsFilter(query)},
+		{"tags": containsFilter(query)},
+	}
+}
+
 func LoadUploadsByKeyPaginated(key string, page, limit int64, query string) ([]UploadEntry, int64, error) {
 	var logs []UploadEntry
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -319,11 +470,10 @@ func LoadUploadsByKeyPaginated(key string, page, limit int64, query string) ([]U
 			"$and": []bson.M{
 				{"api_key": key},
 				{
-					"$or": []bson.M{
-						{"file_name": containsFilter(query)},
-						{"display_name": containsFilter(query)},
-						{"ip": containsFilter(query)},
-					},
+					"$or": append(uploadTextFilters(query),
+						bson.M{"display_name": containsFilter(query)},
+						bson.M{"ip": containsFilter(query)},
+					),
 				},
 			},
 		}
@@ -347,6 +497,10 @@ func SaveUploadToDB(log UploadEntry) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if log.Name == "" {
+		log.Name = strings.TrimSuffix(log.FileName, path.Ext(log.FileName))
+	}
+
 	collection := getCollection("uploads")
 	_, err := collection.InsertOne(ctx, log)
 	if err != nil {
@@ -356,31 +510,6 @@ func SaveUploadToDB(log UploadEntry) error {
 	return nil
 }
 
-func DeleteUploadFromDB(key, fileName string) (UploadEntry, error) {
-	var logEntry UploadEntry
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	filter := bson.M{
-		"api_key":   key,
-		"file_name": bson.M{"$regex": "^" + fileName + "\\..*$"},
-	}
-
-	err := findOne(ctx, "uploads", filter, &logEntry)
-	if err != nil {
-		return logEntry, err
-	}
-
-	if logEntry.Key != key {
-		return logEntry, fmt.Errorf("unauthorized: key mismatch")
-	}
-
-	collection := getCollection("uploads")
-	err = collection.FindOneAndDelete(ctx, filter).Decode(&logEntry)
-
-	return logEntry, err
-}
-
 func LoadURLsFromDB() ([]URL, error) {
 	var urls []URL
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -420,24 +549,12 @@ func GetURLBySlug(slug string) (*URL, error) {
 	return &url, nil
 }
 
-func GetDisplayNameByFileName(fileName string) (string, error) {
+func GetUploadByID(id primitive.ObjectID) (UploadEntry, error) {
 	var uploadEntry UploadEntry
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := findOne(ctx, "uploads", bson.M{"file_name": fileName}, &uploadEntry)
-	if err != nil {
-		return "", err
-	}
-	return uploadEntry.DisplayName, nil
-}
-
-func GetUploadEntryByFileName(fileName string) (UploadEntry, error) {
-	var uploadEntry UploadEntry
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	err := findOne(ctx, "uploads", bson.M{"file_name": fileName}, &uploadEntry)
+	err := findOne(ctx, "uploads", bson.M{"_id": id}, &uploadEntry)
 	return uploadEntry, err
 }
 
@@ -494,31 +611,76 @@ func LoadRecentUploadsPaginated(page, limit int64, query string) ([]UploadEntry,
 	return logs, total, nil
 }
 
-func DeleteUploadByFileName(fileName string) (UploadEntry, error) {
-	var entry UploadEntry
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	filter := bson.M{"file_name": fileName}
-	err := findOne(ctx, "uploads", filter, &entry)
+// DeleteUploadsByUserKey removes every upload a user has and queues their
+// objects in the storage outbox. Albums are kept but emptied.
+func DeleteUploadsByUserKey(key string) (int64, error) {
+	deleted, err := deleteUserUploads(key)
 	if err != nil {
-		return entry, err
+		return deleted, err
 	}
 
-	err = getCollection("uploads").FindOneAndDelete(ctx, filter).Decode(&entry)
-	return entry, err
-}
-
-func DeleteUploadsByUserKey(key string) (int64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	result, err := getCollection("uploads").DeleteMany(ctx, bson.M{"api_key": key})
-	if err != nil {
-		return 0, err
+	update := bson.M{
+		"$set":   bson.M{"files": []string{}, "updated_at": time.Now()},
+		"$unset": bson.M{"cover": ""},
 	}
+	return deleted, updateMany(ctx, "albums", bson.M{"api_key": key}, update)
+}
 
-	return result.DeletedCount, nil
+// userUploadBatch is how many uploads each transaction of a bulk delete
+// covers, keeping every transaction small and quick whatever the user has.
+const userUploadBatch = 100
+
+// deleteUserUploads deletes the uploads of key and their redirects in
+// batches, one transaction each, releasing their objects and queueing them
+// in the storage outbox. A failure keeps the batches already committed, so
+// running it again carries on with what is left.
+func deleteUserUploads(key string) (int64, error) {
+	var deleted int64
+	for {
+		var found int
+		var batch int64
+		err := withTransaction(time.Minute, func(ctx context.Context) error {
+			var uploads []UploadEntry
+			opts := options.Find().SetLimit(userUploadBatch)
+			if err := findMany(ctx, "uploads", bson.M{"api_key": key}, opts, &uploads); err != nil {
+				return err
+			}
+
+			found, batch = len(uploads), 0
+			if found == 0 {
+				return nil
+			}
+
+			ids := make([]primitive.ObjectID, 0, len(uploads))
+			for _, upload := range uploads {
+				if err := releaseAndQueue(ctx, upload); err != nil {
+					log.Printf("Error releasing objects of %s: %v", upload.FileName, err)
+					return err
+				}
+				ids = append(ids, upload.ID)
+			}
+
+			result, err := getCollection("uploads").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+			if err != nil {
+				return err
+			}
+			batch = result.DeletedCount
+
+			_, err = getCollection("upload_redirects").DeleteMany(ctx, bson.M{"upload_id": bson.M{"$in": ids}})
+			return err
+		})
+		if err != nil {
+			return deleted, err
+		}
+
+		deleted += batch
+		if found < userUploadBatch {
+			return deleted, nil
+		}
+	}
 }
 
 func DeleteURLFromDB(key, slug string) (URL, error) {
@@ -551,40 +713,129 @@ func UpdateURLSlugInDB(oldSlug, newSlug string) error {
 	return updateOne(ctx, "urls", filter, update)
 }
 
-func IncrementViewCount(fileName string) error {
+func IncrementViewCount(id primitive.ObjectID) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	filter := bson.M{"file_name": fileName}
+	filter := bson.M{"_id": id}
 	update := bson.M{"$inc": bson.M{"metadata.views": 1}}
 
 	return updateOne(ctx, "uploads", filter, update)
 }
 
-func IncrementClickCount(slug string) error {
+func UpdateUploadVisibility(id primitive.ObjectID, visibility string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	filter := bson.M{"slug": slug}
-	update := bson.M{"$inc": bson.M{"clicks": 1}}
+	filter := bson.M{"_id": id}
+	update := bson.M{"$set": bson.M{"visibility": visibility}}
 
-	return updateOne(ctx, "urls", filter, update)
+	return updateOne(ctx, "uploads", filter, update)
 }
 
-func GetUploadBySlug(slug string) (UploadEntry, error) {
+func UpdateUploadDetails(id primitive.ObjectID, details UploadDetails) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	set := bson.M{}
+	if details.OriginalName != nil {
+		set["original_name"] = *details.OriginalName
+	}
+	if details.Title != nil {
+		set["title"] = *details.Title
+	}
+	if details.Description != nil {
+		set["description"] = *details.Description
+	}
+	if details.Tags != nil {
+		set["tags"] = *details.Tags
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	filter := bson.M{"_id": id}
+	return updateOne(ctx, "uploads", filter, bson.M{"$set": set})
+}
+
+func LoadUploadsForRewrap(activeKeyID string, limit int64) ([]UploadEntry, error) {
+	var uploads []UploadEntry
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stale := bson.M{
+		"encryption":        bson.M{"$exists": true},
+		"encryption.key_id": bson.M{"$ne": activeKeyID},
+	}
+	filter := bson.M{"$or": []bson.M{stale, {"versions": bson.M{"$elemMatch": stale}}}}
+	opts := options.Find().SetLimit(limit)
+
+	err := findMany(ctx, "uploads", filter, opts, &uploads)
+	if err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+// UpdateObjectEncryption stores a re-wrapped data key on every record that
+// points at the object, including the shared object entry itself.
+func UpdateObjectEncryption(objectKey string, encryption *ObjectEncryption) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"$or": []bson.M{
+			{"storage_key": objectKey},
+			{"file_name": objectKey, "storage_key": bson.M{"$exists": false}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"encryption": encryption}}
+
+	if err := updateMany(ctx, "uploads", filter, update); err != nil {
+		return err
+	}
+
+	versionUpdate := bson.M{"$set": bson.M{"versions.$[v].encryption": encryption}}
+	versionOpts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"v.storage_key": objectKey}},
+	})
+	_, err := getCollection("uploads").UpdateMany(ctx, bson.M{"versions.storage_key": objectKey}, versionUpdate, versionOpts)
+	if err != nil {
+		return err
+	}
+
+	return updateOne(ctx, "objects", bson.M{"storage_key": objectKey}, update)
+}
+
+func FindUploadByHash(key, hash string) (UploadEntry, error) {
 	var uploadEntry UploadEntry
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	filter := bson.M{"file_name": bson.M{"$regex": "^" + slug + "\\..*$"}}
-	opts := options.FindOne()
-	err := getCollection("uploads").FindOne(ctx, filter, opts).Decode(&uploadEntry)
+
+	filter := bson.M{"api_key": key, "sha256": hash, "deleted_at": bson.M{"$exists": false}}
+	err := findOne(ctx, "uploads", filter, &uploadEntry)
 	return uploadEntry, err
 }
 
-func UpdateUserKey(oldKey, newKey string) error {
+func IncrementClickCount(slug string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	filter := bson.M{"slug": slug}
+	update := bson.M{"$inc": bson.M{"clicks": 1}}
+
+	return updateOne(ctx, "urls", filter, update)
+}
+
+// UpdateUserKey moves a user and everything they own to a new API key in one
+// transaction, so a failure part way never leaves records on the old key.
+func UpdateUserKey(oldKey, newKey string) error {
+	return withTransaction(30*time.Second, func(ctx context.Context) error {
+		return updateUserKey(ctx, oldKey, newKey)
+	})
+}
+
+func updateUserKey(ctx context.Context, oldKey, newKey string) error {
 	filter := bson.M{"api_key": oldKey}
 	update := bson.M{"$set": bson.M{"api_key": newKey}}
 
@@ -609,13 +860,106 @@ func UpdateUserKey(oldKey, newKey string) error {
 		return err
 	}
 
-	domainFilter := bson.M{"allowed": oldKey}
+	err = updateMany(ctx, "albums", bson.M{"api_key": oldKey}, bson.M{"$set": bson.M{"api_key": newKey}})
+	if err != nil {
+		return err
+	}
+
+	allowedFilter := bson.M{"allowed": oldKey}
 	domainUpdate := bson.M{"$set": bson.M{"allowed.$": newKey}}
 
-	_, err = getCollection("domains").UpdateMany(ctx, domainFilter, domainUpdate)
+	_, err = getCollection("domains").UpdateMany(ctx, allowedFilter, domainUpdate)
 	return err
 }
 
+// ReserveUsage adds one file of the given size to the user's usage, but only
+// if that keeps them within maxBytes and maxFiles (zero or less means no cap).
+// Checking and incrementing in one update keeps concurrent uploads honest.
+func ReserveUsage(key string, bytes, maxBytes, maxFiles int64) (bool, error) {
+	return reserveUsage(key, bytes, 1, maxBytes, maxFiles)
+}
+
+// ReserveBytes is ReserveUsage for content that does not add a file, such as
+// a new version of an existing upload.
+func ReserveBytes(key string, bytes, maxBytes int64) (bool, error) {
+	return reserveUsage(key, bytes, 0, maxBytes, 0)
+}
+
+func reserveUsage(key string, bytes, files, maxBytes, maxFiles int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"api_key": key}
+	if maxBytes > 0 {
+		filter["usage.bytes"] = bson.M{"$not": bson.M{"$gt": maxBytes - bytes}}
+	}
+	if maxFiles > 0 {
+		filter["usage.files"] = bson.M{"$not": bson.M{"$gt": maxFiles - files}}
+	}
+	update := bson.M{"$inc": bson.M{"usage.bytes": bytes, "usage.files": files}}
+
+	result, err := getCollection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Printf("Error reserving usage: %v", err)
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+func AdjustUsage(key string, bytes, files int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"api_key": key}
+	update := bson.M{"$inc": bson.M{"usage.bytes": bytes, "usage.files": files}}
+
+	return updateOne(ctx, "users", filter, update)
+}
+
+// RecalculateUsage rebuilds a user's usage counters from their uploads.
+func RecalculateUsage(key string) (Usage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"api_key": key}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   nil,
+			"bytes": bson.M{"$sum": bson.M{"$add": bson.A{"$metadata.file_size", bson.M{"$sum": "$versions.file_size"}}}},
+			"files": bson.M{"$sum": 1},
+		}}},
+	}
+
+	cursor, err := getCollection("uploads").Aggregate(ctx, pipeline)
+	if err != nil {
+		return Usage{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var usage Usage
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&usage); err != nil {
+			return Usage{}, err
+		}
+	}
+
+	err = updateOne(ctx, "users", bson.M{"api_key": key}, bson.M{"$set": bson.M{"usage": usage}})
+	return usage, err
+}
+
+func UpdateUserLimits(key string, limits *UserLimits) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"api_key": key}
+	update := bson.M{"$set": bson.M{"limits": limits}}
+	if limits == nil {
+		update = bson.M{"$unset": bson.M{"limits": ""}}
+	}
+
+	return updateOne(ctx, "users", filter, update)
+}
+
 func UpdateUserDomain(apiKey, domain string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -631,13 +975,29 @@ func UpdateUserDomain(apiKey, domain string) error {
 	return updateOne(ctx, "users", userFilter, userUpdate)
 }
 
-func contains(slice []string, key string) bool {
-	for _, v := range slice {
-		if v == key {
-			return true
-		}
+// SetUserAdmin grants or revokes admin rights. It returns
+// mongo.ErrNoDocuments when there is no user with that key.
+func SetUserAdmin(key string, admin bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := getCollection("users").UpdateOne(ctx, bson.M{"api_key": key}, bson.M{"$set": bson.M{"admin": admin}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
 	}
-	return false
+	return nil
+}
+
+func UpdateUserNameStyle(apiKey, style string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"api_key": apiKey}
+	update := bson.M{"$set": bson.M{"name_style": style}}
+	return updateOne(ctx, "users", filter, update)
 }
 
 func GetEligibleDomainsFromDB(apiKey string) ([]string, error) {
@@ -652,7 +1012,7 @@ func GetEligibleDomainsFromDB(apiKey string) ([]string, error) {
 
 	eligible := []string{}
 	for _, d := range domains {
-		if contains(d.Allowed, "*") || contains(d.Allowed, apiKey) {
+		if slices.Contains(d.Allowed, "*") || slices.Contains(d.Allowed, apiKey) {
 			eligible = append(eligible, d.Name)
 		}
 	}
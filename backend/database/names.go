@@ -0,0 +1,202 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UploadRedirect sends requests for a renamed upload's old name to its new
+// one until ExpiresAt, when the TTL index removes it and frees the name.
+type UploadRedirect struct {
+	Name      string             `bson:"name"`
+	Domain    string             `bson:"domain,omitempty"`
+	UploadID  primitive.ObjectID `bson:"upload_id"`
+	FileName  string             `bson:"file_name"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+}
+
+// EnsureRedirectIndexes creates the unique name index and the TTL index that
+// expires redirects.
+func EnsureRedirectIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := getCollection("upload_redirects").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "name", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+// EnsureUploadNameIndexes makes upload names, and the old names redirects
+// hold, unique per domain rather than across every domain.
+func EnsureUploadNameIndexes(ctx context.Context) error {
+	model := mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}, {Key: "domain", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := getCollection("uploads").Indexes().CreateOne(ctx, model); err != nil {
+		return fmt.Errorf("uploads: %w", err)
+	}
+
+	redirects := getCollection("upload_redirects")
+	if _, err := redirects.Indexes().DropOne(ctx, "name_1"); err != nil && !isIndexNotFound(err) {
+		return fmt.Errorf("upload_redirects: %w", err)
+	}
+	if _, err := redirects.Indexes().CreateOne(ctx, model); err != nil {
+		return fmt.Errorf("upload_redirects: %w", err)
+	}
+	return nil
+}
+
+func isIndexNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound")
+}
+
+// domainFilter matches records on domain, counting records saved without one
+// as being on the empty domain.
+func domainFilter(domain string) interface{} {
+	if domain == "" {
+		return bson.M{"$in": []interface{}{nil, ""}}
+	}
+	return domain
+}
+
+// UploadNameTaken reports whether name is used on domain by an upload or held
+// there by an unexpired redirect, other than one belonging to the upload
+// except. Pass primitive.NilObjectID when there is no such upload.
+func UploadNameTaken(domain, name string, except primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	uploads, err := getCollection("uploads").CountDocuments(ctx, bson.M{
+		"name":   name,
+		"domain": domainFilter(domain),
+		"_id":    bson.M{"$ne": except},
+	})
+	if err != nil || uploads > 0 {
+		return uploads > 0, err
+	}
+
+	redirects, err := getCollection("upload_redirects").CountDocuments(ctx, bson.M{
+		"name":       name,
+		"domain":     domainFilter(domain),
+		"upload_id":  bson.M{"$ne": except},
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	return redirects > 0, err
+}
+
+// GetUploadByName returns the upload called name. Names are only unique per
+// domain, so when several uploads share one, the one owned by key is
+// preferred, then the one on domain; either may be empty.
+func GetUploadByName(name, key, domain string) (UploadEntry, error) {
+	var uploads []UploadEntry
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := findMany(ctx, "uploads", bson.M{"name": name}, nil, &uploads); err != nil {
+		return UploadEntry{}, err
+	}
+	if len(uploads) == 0 {
+		return UploadEntry{}, mongo.ErrNoDocuments
+	}
+
+	for _, upload := range uploads {
+		if key != "" && upload.Key == key {
+			return upload, nil
+		}
+	}
+	for _, upload := range uploads {
+		if upload.Domain == domain {
+			return upload, nil
+		}
+	}
+	return uploads[0], nil
+}
+
+// RenameUpload moves an upload to newFileName, points its existing redirects
+// at the new name and adds one from the old name. Albums hold upload IDs, so
+// they need no update. The object key is pinned first so the bytes never move.
+func RenameUpload(upload UploadEntry, newFileName, oldName string, redirectUntil time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": upload.ID}
+	newName := strings.TrimSuffix(newFileName, path.Ext(newFileName))
+	update := bson.M{"$set": bson.M{"file_name": newFileName, "name": newName, "storage_key": upload.ObjectKey()}}
+	result, err := getCollection("uploads").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	redirects := getCollection("upload_redirects")
+	if _, err := redirects.UpdateMany(ctx, bson.M{"upload_id": upload.ID}, bson.M{"$set": bson.M{"file_name": newFileName}}); err != nil {
+		return err
+	}
+
+	// Taking back a name this upload used before drops its redirect.
+	if _, err := redirects.DeleteOne(ctx, bson.M{"name": newName, "domain": domainFilter(upload.Domain)}); err != nil {
+		return err
+	}
+
+	if redirectUntil.IsZero() {
+		return nil
+	}
+	_, err = redirects.UpdateOne(ctx,
+		bson.M{"name": oldName, "domain": domainFilter(upload.Domain)},
+		bson.M{"$set": bson.M{"upload_id": upload.ID, "file_name": newFileName, "domain": upload.Domain, "expires_at": redirectUntil}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// GetUploadRedirect returns the unexpired redirect for an old upload name,
+// preferring the one on domain when the name was used on several.
+func GetUploadRedirect(name, domain string) (UploadRedirect, error) {
+	var redirects []UploadRedirect
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"name": name, "expires_at": bson.M{"$gt": time.Now()}}
+	if err := findMany(ctx, "upload_redirects", filter, nil, &redirects); err != nil {
+		return UploadRedirect{}, err
+	}
+	if len(redirects) == 0 {
+		return UploadRedirect{}, mongo.ErrNoDocuments
+	}
+
+	for _, redirect := range redirects {
+		if redirect.Domain == domain {
+			return redirect, nil
+		}
+	}
+	return redirects[0], nil
+}
+
+func DeleteUploadRedirects(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := getCollection("upload_redirects").DeleteMany(ctx, bson.M{"upload_id": id})
+	return err
+}
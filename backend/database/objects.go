@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StoredObject is a bucket object shared by every upload with the same content
+// hash and ACL. Refs counts the uploads still pointing at it.
+type StoredObject struct {
+	StorageKey string            `bson:"storage_key"`
+	Hash       string            `bson:"sha256"`
+	Public     bool              `bson:"public"`
+	Size       int64             `bson:"size"`
+	Refs       int               `bson:"refs"`
+	Encryption *ObjectEncryption `bson:"encryption,omitempty"`
+	CreatedAt  time.Time         `bson:"created_at"`
+}
+
+// AcquireObject takes a reference on an existing object with the given content
+// hash and ACL. It returns mongo.ErrNoDocuments when there is none to share.
+func AcquireObject(hash string, public bool) (StoredObject, error) {
+	var object StoredObject
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"sha256": hash, "public": public, "refs": bson.M{"$gt": 0}}
+	update := bson.M{"$inc": bson.M{"refs": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := getCollection("objects").FindOneAndUpdate(ctx, filter, update, opts).Decode(&object)
+	return object, err
+}
+
+func RegisterObject(object StoredObject) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	object.Refs = 1
+	object.CreatedAt = time.Now()
+
+	_, err := getCollection("objects").InsertOne(ctx, object)
+	return err
+}
+
+// ReleaseObject drops one reference from the object stored under storageKey.
+// It reports whether the object is tracked at all and, if so, whether this
+// was the last reference and the bytes can be deleted.
+func ReleaseObject(storageKey string) (tracked bool, last bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return releaseObject(ctx, storageKey)
+}
+
+func releaseObject(ctx context.Context, storageKey string) (tracked bool, last bool, err error) {
+	var object StoredObject
+	filter := bson.M{"storage_key": storageKey}
+	update := bson.M{"$inc": bson.M{"refs": -1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err = getCollection("objects").FindOneAndUpdate(ctx, filter, update, opts).Decode(&object)
+	if err == mongo.ErrNoDocuments {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	if object.Refs > 0 {
+		return true, false, nil
+	}
+
+	return true, true, deleteOne(ctx, "objects", filter)
+}
+
+func GetObject(storageKey string) (StoredObject, error) {
+	var object StoredObject
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := findOne(ctx, "objects", bson.M{"storage_key": storageKey}, &object)
+	return object, err
+}
+
+func SetObjectPublic(storageKey string, public bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return updateOne(ctx, "objects", bson.M{"storage_key": storageKey}, bson.M{"$set": bson.M{"public": public}})
+}
+
+// UpdateUploadObject repoints an upload at a different stored object, as when
+// a visibility change moves it out of a shared object.
+func UpdateUploadObject(id primitive.ObjectID, storageKey string, encryption *ObjectEncryption) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	set := bson.M{"storage_key": storageKey}
+	unset := bson.M{}
+	if encryption != nil {
+		set["encryption"] = encryption
+	} else {
+		unset["encryption"] = ""
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	return updateOne(ctx, "uploads", bson.M{"_id": id}, update)
+}
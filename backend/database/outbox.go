@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OutboxEntry is a bucket object waiting to be deleted. Entries are written in
+// the same transaction that drops the last reference to the object, so the
+// bytes are only removed once that change has committed.
+type OutboxEntry struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	StorageKey    string             `bson:"storage_key"`
+	Attempts      int                `bson:"attempts"`
+	LastError     string             `bson:"last_error,omitempty"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at"`
+	CreatedAt     time.Time          `bson:"created_at"`
+}
+
+func queueObjectDeletion(ctx context.Context, storageKey string) error {
+	now := time.Now()
+	_, err := getCollection("storage_outbox").InsertOne(ctx, OutboxEntry{
+		StorageKey:    storageKey,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	})
+	return err
+}
+
+// ClaimOutboxEntry leases the oldest due entry so no other worker picks it up
+// until lease has passed. It returns mongo.ErrNoDocuments when nothing is due.
+func ClaimOutboxEntry(lease time.Duration) (OutboxEntry, error) {
+	var entry OutboxEntry
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{"next_attempt_at": bson.M{"$lte": now}}
+	update := bson.M{
+		"$set": bson.M{"next_attempt_at": now.Add(lease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	err := getCollection("storage_outbox").FindOneAndUpdate(ctx, filter, update, opts).Decode(&entry)
+	return entry, err
+}
+
+func CompleteOutboxEntry(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return deleteOne(ctx, "storage_outbox", bson.M{"_id": id})
+}
+
+// RetryOutboxEntry records why an entry failed and when to try it again.
+func RetryOutboxEntry(id primitive.ObjectID, cause error, retryAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"last_error": cause.Error(), "next_attempt_at": retryAt}}
+	return updateOne(ctx, "storage_outbox", bson.M{"_id": id}, update)
+}
+
+// ObjectReferenced reports whether any upload, kept version or shared object
+// record still points at storageKey. The outbox worker checks this before
+// deleting, as a guard against entries queued without a transaction.
+func ObjectReferenced(storageKey string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	uploads, err := getCollection("uploads").CountDocuments(ctx, bson.M{"$or": []bson.M{
+		{"storage_key": storageKey},
+		{"storage_key": bson.M{"$in": []interface{}{nil, ""}}, "file_name": storageKey},
+		{"versions.storage_key": storageKey},
+	}})
+	if err != nil || uploads > 0 {
+		return uploads > 0, err
+	}
+
+	objects, err := getCollection("objects").CountDocuments(ctx, bson.M{"storage_key": storageKey, "refs": bson.M{"$gt": 0}})
+	return objects > 0, err
+}
+
+// releaseAndQueue drops the upload's references to its objects and queues the
+// ones nobody else holds for deletion.
+func releaseAndQueue(ctx context.Context, upload UploadEntry) error {
+	keys := []string{upload.ObjectKey()}
+	for _, version := range upload.Versions {
+		keys = append(keys, version.StorageKey)
+	}
+
+	for _, key := range keys {
+		tracked, last, err := releaseObject(ctx, key)
+		if err != nil {
+			return err
+		}
+		if tracked && !last {
+			continue
+		}
+		if err := queueObjectDeletion(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EachUploadObject calls fn for every upload, trashed ones included, with
+// only the fields needed to tell which objects it holds.
+func EachUploadObject(fn func(upload UploadEntry) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	opts := options.Find().SetProjection(bson.M{
+		"api_key":     1,
+		"file_name":   1,
+		"storage_key": 1,
+		"metadata":    1,
+		"encryption":  1,
+		"versions":    1,
+	})
+	cursor, err := getCollection("uploads").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var upload UploadEntry
+		if err := cursor.Decode(&upload); err != nil {
+			return err
+		}
+		if err := fn(upload); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// PendingObjectDeletions returns the storage keys waiting in the outbox.
+func PendingObjectDeletions() (map[string]bool, error) {
+	var entries []OutboxEntry
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := findMany(ctx, "storage_outbox", bson.M{}, nil, &entries); err != nil {
+		return nil, err
+	}
+
+	pending := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		pending[entry.StorageKey] = true
+	}
+	return pending, nil
+}
+
+// QueueObjectDeletion adds a storage key to the outbox on its own, for
+// objects no record refers to at all.
+func QueueObjectDeletion(storageKey string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return queueObjectDeletion(ctx, storageKey)
+}
+
+// MarkUploadMissing flags an upload whose stored object is gone.
+func MarkUploadMissing(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return updateOne(ctx, "uploads", bson.M{"_id": id}, bson.M{"$set": bson.M{"missing_at": time.Now()}})
+}
+
+// DropUploadVersion forgets a kept version of an upload.
+func DropUploadVersion(id primitive.ObjectID, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$pull": bson.M{"versions": bson.M{"version": version}}}
+	return updateOne(ctx, "uploads", bson.M{"_id": id}, update)
+}
+
+// SetStoredSize corrects the recorded size of an upload's current content, or
+// of one of its kept versions when version is not 0.
+func SetStoredSize(id primitive.ObjectID, version int, size int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id}
+	if version == 0 {
+		return updateOne(ctx, "uploads", filter, bson.M{"$set": bson.M{"metadata.file_size": size}})
+	}
+
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"v.version": version}},
+	})
+	_, err := getCollection("uploads").UpdateOne(ctx, filter, bson.M{"$set": bson.M{"versions.$[v].file_size": size}}, opts)
+	return err
+}
@@ -0,0 +1,252 @@
+package database
+
+import (
+	"context"
+	"html"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	SearchKindUpload = "upload"
+	SearchKindURL    = "url"
+	SearchKindUser   = "user"
+)
+
+// searchIndexes are the text indexes behind Search. Mongo allows one text
+// index per collection, so each covers every searchable field with a weight.
+var searchIndexes = map[string]bson.D{
+	"uploads": {
+		{Key: "title", Value: 10},
+		{Key: "original_name", Value: 8},
+		{Key: "tags", Value: 6},
+		{Key: "file_name", Value: 4},
+		{Key: "description", Value: 2},
+		{Key: "display_name", Value: 1},
+	},
+	"urls": {
+		{Key: "slug", Value: 6},
+		{Key: "url", Value: 3},
+	},
+	"users": {
+		{Key: "display_name", Value: 1},
+	},
+}
+
+// EnsureSearchIndexes creates the text indexes used by Search. It is safe to
+// call repeatedly; existing indexes with the same definition are left alone.
+func EnsureSearchIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for collection, weights := range searchIndexes {
+		keys := bson.D{}
+		for _, field := range weights {
+			keys = append(keys, bson.E{Key: field.Key, Value: "text"})
+		}
+
+		model := mongo.IndexModel{
+			Keys: keys,
+			Options: options.Index().
+				SetName("search_text").
+				SetWeights(weights).
+				SetDefaultLanguage("none"),
+		}
+		if _, err := getCollection(collection).Indexes().CreateOne(ctx, model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type SearchHighlight struct {
+	Field   string `json:"field"`
+	Snippet string `json:"snippet"`
+}
+
+type SearchHit struct {
+	Kind       string            `json:"kind"`
+	Score      float64           `json:"score"`
+	Highlights []SearchHighlight `json:"highlights"`
+	Upload     *UploadEntry      `json:"upload,omitempty"`
+	URL        *URL              `json:"url,omitempty"`
+	User       *User             `json:"user,omitempty"`
+}
+
+// Search runs a ranked text search over the given kinds. A non-empty key
+// limits uploads and URLs to that user; users are only searched without one.
+func Search(query, key string, kinds []string, limit int64) ([]SearchHit, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	terms := searchTerms(query)
+	hits := []SearchHit{}
+
+	for _, kind := range kinds {
+		filter := bson.M{"$text": bson.M{"$search": query}, "deleted_at": bson.M{"$exists": false}}
+		if key != "" {
+			filter["api_key"] = key
+		}
+
+		switch kind {
+		case SearchKindUpload:
+			var results []struct {
+				UploadEntry `bson:",inline"`
+				Score       float64 `bson:"score"`
+			}
+			if err := textSearch(ctx, "uploads", filter, limit, &results); err != nil {
+				return nil, err
+			}
+			for i := range results {
+				upload := results[i].UploadEntry
+				hits = append(hits, SearchHit{
+					Kind:  kind,
+					Score: results[i].Score,
+					Highlights: highlightFields(terms, map[string]string{
+						"title":         upload.Title,
+						"original_name": upload.OriginalName,
+						"tags":          strings.Join(upload.Tags, ", "),
+						"file_name":     upload.FileName,
+						"description":   upload.Description,
+						"display_name":  upload.DisplayName,
+					}),
+					Upload: &upload,
+				})
+			}
+
+		case SearchKindURL:
+			var results []struct {
+				URL   `bson:",inline"`
+				Score float64 `bson:"score"`
+			}
+			if err := textSearch(ctx, "urls", filter, limit, &results); err != nil {
+				return nil, err
+			}
+			for i := range results {
+				url := results[i].URL
+				hits = append(hits, SearchHit{
+					Kind:  kind,
+					Score: results[i].Score,
+					Highlights: highlightFields(terms, map[string]string{
+						"slug": url.Slug,
+						"url":  url.URL,
+					}),
+					URL: &url,
+				})
+			}
+
+		case SearchKindUser:
+			if key != "" {
+				continue
+			}
+			var results []struct {
+				User  `bson:",inline"`
+				Score float64 `bson:"score"`
+			}
+			if err := textSearch(ctx, "users", filter, limit, &results); err != nil {
+				return nil, err
+			}
+			for i := range results {
+				user := results[i].User
+				hits = append(hits, SearchHit{
+					Kind:       kind,
+					Score:      results[i].Score,
+					Highlights: highlightFields(terms, map[string]string{"display_name": user.DisplayName}),
+					User:       &user,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if limit > 0 && int64(len(hits)) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+func textSearch(ctx context.Context, collection string, filter bson.M, limit int64, results interface{}) error {
+	score := bson.M{"score": bson.M{"$meta": "textScore"}}
+	opts := options.Find().SetProjection(score).SetSort(score).SetLimit(limit)
+
+	if err := findMany(ctx, collection, filter, opts, results); err != nil {
+		log.Printf("Error searching %s: %v", collection, err)
+		return err
+	}
+	return nil
+}
+
+// searchTerms splits a query the way the text index does closely enough for
+// highlighting: lowercased words, ignoring negations and quotes.
+func searchTerms(query string) []string {
+	terms := []string{}
+	for _, field := range strings.Fields(strings.ToLower(query)) {
+		if strings.HasPrefix(field, "-") {
+			continue
+		}
+		for _, word := range strings.FieldsFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		}) {
+			if !slices.Contains(terms, word) {
+				terms = append(terms, word)
+			}
+		}
+	}
+	return terms
+}
+
+// highlightFields returns an HTML-escaped snippet for each field that contains
+// a search term, with the matches wrapped in <mark>.
+func highlightFields(terms []string, fields map[string]string) []SearchHighlight {
+	highlights := []SearchHighlight{}
+	for field, value := range fields {
+		if snippet, ok := highlight(value, terms); ok {
+			highlights = append(highlights, SearchHighlight{Field: field, Snippet: snippet})
+		}
+	}
+	sort.Slice(highlights, func(i, j int) bool { return highlights[i].Field < highlights[j].Field })
+	return highlights
+}
+
+func highlight(value string, terms []string) (string, bool) {
+	// Lowercasing can change how many bytes a rune takes, so fold rune by
+	// rune and remember where each folded rune starts in value.
+	var folding strings.Builder
+	offsets := map[int]int{}
+	for i, r := range value {
+		offsets[folding.Len()] = i
+		folding.WriteRune(unicode.ToLower(r))
+	}
+	offsets[folding.Len()] = len(value)
+	lower := folding.String()
+
+	var builder strings.Builder
+	matched := false
+	for i := 0; i < len(lower); {
+		end := 0
+		for _, term := range terms {
+			if strings.HasPrefix(lower[i:], term) && len(term) > end {
+				end = len(term)
+			}
+		}
+		if end == 0 {
+			_, size := utf8.DecodeRuneInString(lower[i:])
+			builder.WriteString(html.EscapeString(value[offsets[i]:offsets[i+size]]))
+			i += size
+			continue
+		}
+		matched = true
+		builder.WriteString("<mark>" + html.EscapeString(value[offsets[i]:offsets[i+end]]) + "</mark>")
+		i += end
+	}
+	return builder.String(), matched
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	transactionsOnce      sync.Once
+	transactionsAvailable bool
+)
+
+// transactionsSupported reports whether the server is a replica set member or
+// a mongos. Standalone servers reject transactions outright.
+func transactionsSupported() bool {
+	transactionsOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var hello bson.M
+		if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+			log.Printf("Error checking transaction support: %v", err)
+			return
+		}
+
+		_, replicaSet := hello["setName"]
+		transactionsAvailable = replicaSet || hello["msg"] == "isdbgrid"
+		if !transactionsAvailable {
+			log.Println("MongoDB is standalone; multi-collection writes run without transactions")
+		}
+	})
+	return transactionsAvailable
+}
+
+// withTransaction runs fn inside a transaction where the server supports one
+// and directly otherwise. The driver retries fn on transient errors, so it
+// must not touch anything outside the database; queue that in the outbox.
+func withTransaction(timeout time.Duration, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if !transactionsSupported() {
+		return fn(ctx)
+	}
+
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
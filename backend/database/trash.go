@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// notTrashed matches uploads and URLs that have not been moved to the trash.
+func notTrashed() bson.M {
+	return bson.M{"deleted_at": bson.M{"$exists": false}}
+}
+
+func TrashUpload(id primitive.ObjectID, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id}
+	return updateOne(ctx, "uploads", filter, bson.M{"$set": bson.M{"deleted_at": at}})
+}
+
+func RestoreUpload(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id}
+	return updateOne(ctx, "uploads", filter, bson.M{"$unset": bson.M{"deleted_at": ""}})
+}
+
+// PurgeUpload deletes an upload record and, in the same transaction, releases
+// its objects and queues the ones nobody else holds in the storage outbox.
+func PurgeUpload(id primitive.ObjectID) (UploadEntry, error) {
+	var entry UploadEntry
+	err := withTransaction(30*time.Second, func(ctx context.Context) error {
+		if err := getCollection("uploads").FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&entry); err != nil {
+			return err
+		}
+		return releaseAndQueue(ctx, entry)
+	})
+	return entry, err
+}
+
+func TrashURL(slug string, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"slug": slug}
+	return updateOne(ctx, "urls", filter, bson.M{"$set": bson.M{"deleted_at": at}})
+}
+
+func RestoreURL(slug string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"slug": slug}
+	return updateOne(ctx, "urls", filter, bson.M{"$unset": bson.M{"deleted_at": ""}})
+}
+
+func LoadTrashedUploads(key string) ([]UploadEntry, error) {
+	uploads := []UploadEntry{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"api_key": key, "deleted_at": bson.M{"$exists": true}}
+	opts := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: -1}})
+
+	err := findMany(ctx, "uploads", filter, opts, &uploads)
+	return uploads, err
+}
+
+func LoadTrashedURLs(key string) ([]URL, error) {
+	urls := []URL{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"api_key": key, "deleted_at": bson.M{"$exists": true}}
+	opts := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: -1}})
+
+	err := findMany(ctx, "urls", filter, opts, &urls)
+	return urls, err
+}
+
+// LoadExpiredTrash returns uploads trashed before cutoff, oldest first.
+func LoadExpiredTrash(cutoff time.Time, limit int64) ([]UploadEntry, error) {
+	var uploads []UploadEntry
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"deleted_at": bson.M{"$lt": cutoff}}
+	opts := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: 1}}).SetLimit(limit)
+
+	err := findMany(ctx, "uploads", filter, opts, &uploads)
+	return uploads, err
+}
+
+func DeleteExpiredTrashedURLs(cutoff time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := getCollection("urls").DeleteMany(ctx, bson.M{"deleted_at": bson.M{"$lt": cutoff}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
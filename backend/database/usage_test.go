@@ -0,0 +1,136 @@
+package database
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// updated is the reply to an update command that matched n documents.
+func updated(n int) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+}
+
+// sentUpdate returns the filter and update of the first statement of the
+// next update command the client sent.
+func sentUpdate(mt *mtest.T) (bson.Raw, bson.Raw) {
+	mt.Helper()
+	started := mt.GetStartedEvent()
+	if started == nil || started.CommandName != "update" {
+		mt.Fatalf("expected an update command, got %v", started)
+	}
+	statement := started.Command.Lookup("updates", "0").Document()
+	return statement.Lookup("q").Document(), statement.Lookup("u").Document()
+}
+
+// int64At reads a number from doc at the given path, or reports it missing.
+func int64At(doc bson.Raw, path ...string) (int64, bool) {
+	value, err := doc.LookupErr(path...)
+	if err != nil {
+		return 0, false
+	}
+	return value.AsInt64OK()
+}
+
+func TestReserveUsage(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name     string
+		reserve  func() (bool, error)
+		matched  int
+		want     bool
+		maxBytes int64 // the usage.bytes ceiling the filter should hold, or 0 for none
+		maxFiles int64
+		bytes    int64
+		files    int64
+	}{
+		{
+			name:    "no limits",
+			reserve: func() (bool, error) { return ReserveUsage("k", 100, 0, 0) },
+			matched: 1, want: true, bytes: 100, files: 1,
+		},
+		{
+			name:    "within both limits",
+			reserve: func() (bool, error) { return ReserveUsage("k", 100, 1000, 10) },
+			matched: 1, want: true, maxBytes: 900, maxFiles: 9, bytes: 100, files: 1,
+		},
+		{
+			name:    "over a limit",
+			reserve: func() (bool, error) { return ReserveUsage("k", 100, 1000, 10) },
+			matched: 0, want: false, maxBytes: 900, maxFiles: 9, bytes: 100, files: 1,
+		},
+		{
+			name:    "bytes only for a new version",
+			reserve: func() (bool, error) { return ReserveBytes("k", 50, 1000) },
+			matched: 1, want: true, maxBytes: 950, bytes: 50, files: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			Use(mt.Client)
+			mt.AddMockResponses(updated(tt.matched))
+
+			got, err := tt.reserve()
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if got != tt.want {
+				mt.Errorf("reserved = %v, want %v", got, tt.want)
+			}
+
+			filter, update := sentUpdate(mt)
+			if key := filter.Lookup("api_key").StringValue(); key != "k" {
+				mt.Errorf("filter api_key = %q", key)
+			}
+
+			// The limit is checked in the same update that counts the usage,
+			// so concurrent uploads cannot both pass a check and overshoot.
+			ceiling, ok := int64At(filter, "usage.bytes", "$not", "$gt")
+			if tt.maxBytes == 0 && ok {
+				mt.Errorf("filter limits bytes to %d without a limit", ceiling)
+			} else if tt.maxBytes != 0 && ceiling != tt.maxBytes {
+				mt.Errorf("filter limits bytes to %d, want %d", ceiling, tt.maxBytes)
+			}
+			ceiling, ok = int64At(filter, "usage.files", "$not", "$gt")
+			if tt.maxFiles == 0 && ok {
+				mt.Errorf("filter limits files to %d without a limit", ceiling)
+			} else if tt.maxFiles != 0 && ceiling != tt.maxFiles {
+				mt.Errorf("filter limits files to %d, want %d", ceiling, tt.maxFiles)
+			}
+
+			if bytes, _ := int64At(update, "$inc", "usage.bytes"); bytes != tt.bytes {
+				mt.Errorf("update adds %d bytes, want %d", bytes, tt.bytes)
+			}
+			if files, _ := int64At(update, "$inc", "usage.files"); files != tt.files {
+				mt.Errorf("update adds %d files, want %d", files, tt.files)
+			}
+		})
+	}
+}
+
+func TestAdjustUsageReleases(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("release", func(mt *mtest.T) {
+		Use(mt.Client)
+		mt.AddMockResponses(updated(1))
+
+		if err := AdjustUsage("k", -100, -1); err != nil {
+			mt.Fatal(err)
+		}
+
+		filter, update := sentUpdate(mt)
+		if _, err := filter.LookupErr("usage.bytes"); err == nil {
+			mt.Error("releasing usage must not be conditional on a limit")
+		}
+		if bytes, _ := int64At(update, "$inc", "usage.bytes"); bytes != -100 {
+			mt.Errorf("update adds %d bytes, want -100", bytes)
+		}
+		if files, _ := int64At(update, "$inc", "usage.files"); files != -1 {
+			mt.Errorf("update adds %d files, want -1", files)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var ErrVersionConflict = errors.New("upload was changed concurrently")
+
+// UploadVersion is an earlier content of an upload, kept after it was
+// replaced so it stays retrievable with ?v= and can be rolled back to.
+type UploadVersion struct {
+	Version      int               `bson:"version" json:"version"`
+	StorageKey   string            `bson:"storage_key" json:"-"`
+	Hash         string            `bson:"sha256,omitempty" json:"sha256,omitempty"`
+	FileSize     int64             `bson:"file_size" json:"fileSize"`
+	OriginalName string            `bson:"original_name,omitempty" json:"originalName,omitempty"`
+	Encryption   *ObjectEncryption `bson:"encryption,omitempty" json:"-"`
+	CreatedAt    time.Time         `bson:"created_at" json:"createdAt"`
+}
+
+// CurrentVersion is the number of the content the upload serves by default.
+// Uploads that were never replaced are version 1.
+func (u UploadEntry) CurrentVersion() int {
+	if u.Version < 1 {
+		return 1
+	}
+	return u.Version
+}
+
+// CurrentVersionInfo describes the upload's current content as a version.
+func (u UploadEntry) CurrentVersionInfo() UploadVersion {
+	createdAt := u.Metadata.UploadDate
+	if u.VersionedAt != nil {
+		createdAt = *u.VersionedAt
+	}
+	return UploadVersion{
+		Version:      u.CurrentVersion(),
+		StorageKey:   u.ObjectKey(),
+		Hash:         u.Hash,
+		FileSize:     u.Metadata.FileSize,
+		OriginalName: u.OriginalName,
+		Encryption:   u.Encryption,
+		CreatedAt:    createdAt,
+	}
+}
+
+// AtVersion returns the upload as it was at version, with the storage fields
+// swapped for that version's. Earlier versions are always stored privately.
+func (u UploadEntry) AtVersion(version int) (UploadEntry, bool) {
+	if version == u.CurrentVersion() {
+		return u, true
+	}
+
+	for _, v := range u.Versions {
+		if v.Version != version {
+			continue
+		}
+		u.StorageKey = v.StorageKey
+		u.Hash = v.Hash
+		u.Metadata.FileSize = v.FileSize
+		u.OriginalName = v.OriginalName
+		u.Encryption = v.Encryption
+		u.ShownVersion = v.Version
+		return u, true
+	}
+	return u, false
+}
+
+// StoredBytes counts the current content and every kept version, which is
+// what the upload costs against its owner's quota.
+func (u UploadEntry) StoredBytes() int64 {
+	total := u.Metadata.FileSize
+	for _, v := range u.Versions {
+		total += v.FileSize
+	}
+	return total
+}
+
+// SetUploadContent saves the storage fields and version history of upload.
+// It only applies if the stored upload is still at previousVersion, so two
+// concurrent replacements cannot silently drop one another.
+func SetUploadContent(upload UploadEntry, previousVersion int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": upload.ID, "version": previousVersion}
+	if previousVersion <= 1 {
+		filter["version"] = bson.M{"$in": []interface{}{nil, 0, 1}}
+	}
+
+	set := bson.M{
+		"storage_key":        upload.StorageKey,
+		"sha256":             upload.Hash,
+		"metadata.file_size": upload.Metadata.FileSize,
+		"original_name":      upload.OriginalName,
+		"version":            upload.Version,
+		"versioned_at":       upload.VersionedAt,
+		"versions":           upload.Versions,
+	}
+	update := bson.M{"$set": set}
+	if upload.Encryption != nil {
+		set["encryption"] = upload.Encryption
+	} else {
+		update["$unset"] = bson.M{"encryption": ""}
+	}
+
+	result, err := getCollection("uploads").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
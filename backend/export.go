@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"tritan.dev/image-uploader/database"
+)
+
+// runExportCommand writes a metadata backup as JSON lines to -out, or stdout
+// when -out is not given; the per-collection counts then go to stderr so the
+// two don't mix.
+func runExportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := flags.String("out", "", "file to write to instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return fail(err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	counts, err := database.Export(w)
+	if err != nil {
+		return fail(err)
+	}
+	summary := map[string]interface{}{"exported": counts}
+	if *out == "" {
+		return writeJSON(os.Stderr, summary)
+	}
+	return printJSON(summary)
+}
+
+// runImportCommand reads a backup written by export from -in or stdin.
+func runImportCommand(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	in := flags.String("in", "", "file to read instead of stdin")
+	replace := flags.Bool("replace", false, "overwrite documents that already exist")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return fail(err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	result, err := database.Import(r, *replace)
+	if err != nil {
+		printJSON(result)
+		return fail(err)
+	}
+	return printJSON(result)
+}
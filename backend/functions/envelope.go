@@ -0,0 +1,359 @@
+package functions
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/database"
+)
+
+var errUnknownMasterKey = errors.New("unknown storage master key")
+
+func masterKey(keyID string) ([]byte, error) {
+	encoded, ok := config.AppConfigInstance.Storage_MasterKeys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errUnknownMasterKey, keyID)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding master key %q: %w", keyID, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key %q must be 32 bytes, got %d", keyID, len(key))
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// wrapDataKey seals a data key under the given master key. The key ID is bound
+// as additional data so a wrapped key cannot be replayed under another master.
+func wrapDataKey(dataKey []byte, keyID string) ([]byte, error) {
+	key, err := masterKey(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomBytes(gcm.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, dataKey, []byte(keyID)), nil
+}
+
+func unwrapDataKey(encryption *database.ObjectEncryption) ([]byte, error) {
+	key, err := masterKey(encryption.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(encryption.WrappedKey) < gcm.NonceSize() {
+		return nil, errors.New("wrapped data key is too short")
+	}
+
+	nonce, sealed := encryption.WrappedKey[:gcm.NonceSize()], encryption.WrappedKey[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, []byte(encryption.KeyID))
+}
+
+// sealedChunkSize is how much plaintext each sealed chunk of an object holds.
+// Chunking lets objects be encrypted and decrypted as streams, holding one
+// chunk in memory rather than the whole file.
+const sealedChunkSize = 64 * 1024
+
+// newDataKey returns a fresh per-object data key and its encryption record,
+// with the data key wrapped by the active master key from config.
+func newDataKey() ([]byte, *database.ObjectEncryption, error) {
+	dataKey, err := randomBytes(32)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce, err := randomBytes(12)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyID := config.AppConfigInstance.Storage_MasterKeyID
+	wrapped, err := wrapDataKey(dataKey, keyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dataKey, &database.ObjectEncryption{
+		KeyID:      keyID,
+		WrappedKey: wrapped,
+		Nonce:      nonce,
+		ChunkSize:  sealedChunkSize,
+	}, nil
+}
+
+// chunkNonce and chunkData give every chunk its own nonce and bind its
+// position, and whether it is the last, into the tag. Chunks can then be
+// neither reordered nor dropped from the end without Open failing.
+func chunkNonce(base []byte, index int64) []byte {
+	nonce := append([]byte(nil), base...)
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(index))
+	for i := range counter {
+		nonce[len(nonce)-8+i] ^= counter[i]
+	}
+	return nonce
+}
+
+func chunkData(index int64, last bool) []byte {
+	data := make([]byte, 9)
+	binary.BigEndian.PutUint64(data, uint64(index))
+	if last {
+		data[8] = 1
+	}
+	return data
+}
+
+// sealedChunks returns how many chunks a plaintext of size bytes is sealed
+// into. An empty plaintext still gets one chunk, to carry the final flag.
+func sealedChunks(size, chunkSize int64) int64 {
+	if size == 0 {
+		return 1
+	}
+	return (size + chunkSize - 1) / chunkSize
+}
+
+// SealedReader encrypts a plaintext ReadSeeker chunk by chunk as it is read.
+// It is itself seekable, so the S3 client can sign and retry the upload.
+type SealedReader struct {
+	plain     io.ReadSeeker
+	gcm       cipher.AEAD
+	nonce     []byte
+	chunkSize int64
+	size      int64
+	chunks    int64
+	offset    int64
+	index     int64
+	buffer    []byte
+	sealed    []byte
+}
+
+// SealObject returns a reader of body's ciphertext under a fresh data key,
+// and the encryption record to store with the object.
+func SealObject(body io.ReadSeeker) (*SealedReader, *database.ObjectEncryption, error) {
+	size, err := body.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataKey, encryption, err := newDataKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &SealedReader{
+		plain:     body,
+		gcm:       gcm,
+		nonce:     encryption.Nonce,
+		chunkSize: int64(encryption.ChunkSize),
+		size:      size,
+		chunks:    sealedChunks(size, int64(encryption.ChunkSize)),
+		index:     -1,
+	}, encryption, nil
+}
+
+// Len is the length of the ciphertext.
+func (r *SealedReader) Len() int64 {
+	return r.size + r.chunks*int64(r.gcm.Overhead())
+}
+
+func (r *SealedReader) Read(p []byte) (int, error) {
+	if r.offset >= r.Len() {
+		return 0, io.EOF
+	}
+
+	sealedSize := r.chunkSize + int64(r.gcm.Overhead())
+	index := r.offset / sealedSize
+	if index != r.index {
+		if err := r.seal(index); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.sealed[r.offset-index*sealedSize:])
+	r.offset += int64(n)
+	return n, nil
+}
+
+func (r *SealedReader) seal(index int64) error {
+	start := index * r.chunkSize
+	length := min(r.chunkSize, r.size-start)
+	if _, err := r.plain.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+
+	if int64(cap(r.buffer)) < length {
+		r.buffer = make([]byte, r.chunkSize)
+	}
+	plaintext := r.buffer[:length]
+	if _, err := io.ReadFull(r.plain, plaintext); err != nil {
+		return err
+	}
+
+	last := index == r.chunks-1
+	r.sealed = r.gcm.Seal(r.sealed[:0], chunkNonce(r.nonce, index), plaintext, chunkData(index, last))
+	r.index = index
+	return nil
+}
+
+func (r *SealedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.Len()
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before the start of the object")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// openedReader decrypts a chunked object as it is read.
+type openedReader struct {
+	sealed io.ReadCloser
+	gcm    cipher.AEAD
+	nonce  []byte
+	chunks int64
+	index  int64
+	buffer []byte
+	plain  []byte
+}
+
+// OpenSealed returns a reader of the plaintext of a chunked object whose
+// ciphertext is sealedSize bytes long, and the plaintext length.
+func OpenSealed(sealed io.ReadCloser, sealedSize int64, encryption *database.ObjectEncryption) (io.ReadCloser, int64, error) {
+	dataKey, err := unwrapDataKey(encryption)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	chunkBytes := int64(encryption.ChunkSize + gcm.Overhead())
+	chunks := (sealedSize + chunkBytes - 1) / chunkBytes
+	size := sealedSize - chunks*int64(gcm.Overhead())
+	if chunks < 1 || size < 0 {
+		return nil, 0, errors.New("sealed object is too short")
+	}
+
+	return &openedReader{
+		sealed: sealed,
+		gcm:    gcm,
+		nonce:  encryption.Nonce,
+		chunks: chunks,
+		buffer: make([]byte, chunkBytes),
+	}, size, nil
+}
+
+func (r *openedReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.index == r.chunks {
+			return 0, io.EOF
+		}
+
+		n, err := io.ReadFull(r.sealed, r.buffer)
+		if err != nil && !(err == io.ErrUnexpectedEOF && r.index == r.chunks-1) {
+			return 0, err
+		}
+
+		last := r.index == r.chunks-1
+		r.plain, err = r.gcm.Open(r.buffer[:0], chunkNonce(r.nonce, r.index), r.buffer[:n], chunkData(r.index, last))
+		if err != nil {
+			return 0, err
+		}
+		r.index++
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *openedReader) Close() error {
+	return r.sealed.Close()
+}
+
+// DecryptObject opens an object sealed in one piece, before chunking.
+func DecryptObject(ciphertext []byte, encryption *database.ObjectEncryption) ([]byte, error) {
+	dataKey, err := unwrapDataKey(encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Open(nil, encryption.Nonce, ciphertext, nil)
+}
+
+// RewrapDataKey moves an object's data key under the active master key. The
+// object itself is untouched, so rotation never has to re-upload anything.
+func RewrapDataKey(encryption *database.ObjectEncryption) (*database.ObjectEncryption, error) {
+	dataKey, err := unwrapDataKey(encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID := config.AppConfigInstance.Storage_MasterKeyID
+	wrapped, err := wrapDataKey(dataKey, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.ObjectEncryption{
+		KeyID:      keyID,
+		WrappedKey: wrapped,
+		Nonce:      encryption.Nonce,
+		ChunkSize:  encryption.ChunkSize,
+	}, nil
+}
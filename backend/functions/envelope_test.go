@@ -0,0 +1,188 @@
+package functions
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"testing"
+
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/database"
+)
+
+// useTestMasterKeys installs master keys for the test and puts the old
+// configuration back afterwards.
+func useTestMasterKeys(t *testing.T, active string, ids ...string) {
+	t.Helper()
+	previousID, previousKeys := config.AppConfigInstance.Storage_MasterKeyID, config.AppConfigInstance.Storage_MasterKeys
+	t.Cleanup(func() {
+		config.AppConfigInstance.Storage_MasterKeyID = previousID
+		config.AppConfigInstance.Storage_MasterKeys = previousKeys
+	})
+
+	keys := map[string]string{}
+	for i, id := range ids {
+		keys[id] = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{byte(i + 1)}, 32))
+	}
+	config.AppConfigInstance.Storage_MasterKeyID = active
+	config.AppConfigInstance.Storage_MasterKeys = keys
+}
+
+func testPlaintext(size int) []byte {
+	plain := make([]byte, size)
+	for i := range plain {
+		plain[i] = byte(i * 7)
+	}
+	return plain
+}
+
+func seal(t *testing.T, plain []byte) ([]byte, *database.ObjectEncryption) {
+	t.Helper()
+	reader, encryption, err := SealObject(bytes.NewReader(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(sealed)) != reader.Len() {
+		t.Fatalf("sealed %d bytes, Len reported %d", len(sealed), reader.Len())
+	}
+	return sealed, encryption
+}
+
+func open(sealed []byte, encryption *database.ObjectEncryption) ([]byte, int64, error) {
+	reader, size, err := OpenSealed(io.NopCloser(bytes.NewReader(sealed)), int64(len(sealed)), encryption)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer reader.Close()
+	plain, err := io.ReadAll(reader)
+	return plain, size, err
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	useTestMasterKeys(t, "k1", "k1")
+
+	for _, size := range []int{0, 1, sealedChunkSize - 1, sealedChunkSize, sealedChunkSize + 1, 3*sealedChunkSize + 17} {
+		plain := testPlaintext(size)
+		sealed, encryption := seal(t, plain)
+
+		opened, openedSize, err := open(sealed, encryption)
+		if err != nil {
+			t.Errorf("size %d: %v", size, err)
+			continue
+		}
+		if openedSize != int64(size) {
+			t.Errorf("size %d: OpenSealed reported %d", size, openedSize)
+		}
+		if !bytes.Equal(opened, plain) {
+			t.Errorf("size %d: opened plaintext differs", size)
+		}
+	}
+}
+
+func TestSealedReaderSeek(t *testing.T) {
+	useTestMasterKeys(t, "k1", "k1")
+
+	reader, _, err := SealObject(bytes.NewReader(testPlaintext(2*sealedChunkSize + 5)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The S3 client rewinds the body to retry; the retry must send the same bytes.
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	again, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, again) {
+		t.Error("ciphertext changed after seeking back to the start")
+	}
+
+	if _, err := reader.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	tail, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tail, first[len(first)-10:]) {
+		t.Error("reading from the end does not match the full ciphertext")
+	}
+}
+
+func TestOpenSealedRejectsTampering(t *testing.T) {
+	useTestMasterKeys(t, "k1", "k1")
+
+	plain := testPlaintext(3*sealedChunkSize + 17)
+	sealed, encryption := seal(t, plain)
+	chunk := sealedChunkSize + 16
+
+	tests := []struct {
+		name   string
+		tamper func([]byte) []byte
+	}{
+		{"last chunk dropped", func(b []byte) []byte { return b[:3*chunk] }},
+		{"last two chunks dropped", func(b []byte) []byte { return b[:2*chunk] }},
+		{"truncated mid-chunk", func(b []byte) []byte { return b[:len(b)-5] }},
+		{"first chunks swapped", func(b []byte) []byte {
+			swapped := append([]byte(nil), b[chunk:2*chunk]...)
+			swapped = append(swapped, b[:chunk]...)
+			return append(swapped, b[2*chunk:]...)
+		}},
+		{"chunk repeated", func(b []byte) []byte {
+			repeated := append([]byte(nil), b[:chunk]...)
+			return append(repeated, b[:len(b)-chunk]...)
+		}},
+		{"byte flipped", func(b []byte) []byte {
+			b[chunk+3] ^= 0x01
+			return b
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := tt.tamper(append([]byte(nil), sealed...))
+			opened, _, err := open(tampered, encryption)
+			if err == nil {
+				t.Fatalf("opened %d bytes without an error", len(opened))
+			}
+		})
+	}
+}
+
+func TestRewrapDataKey(t *testing.T) {
+	useTestMasterKeys(t, "old", "old", "new")
+
+	plain := testPlaintext(sealedChunkSize + 1)
+	sealed, encryption := seal(t, plain)
+
+	config.AppConfigInstance.Storage_MasterKeyID = "new"
+	rewrapped, err := RewrapDataKey(encryption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewrapped.KeyID != "new" {
+		t.Errorf("rewrapped under %q, want new", rewrapped.KeyID)
+	}
+
+	delete(config.AppConfigInstance.Storage_MasterKeys, "old")
+	opened, _, err := open(sealed, rewrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plain) {
+		t.Error("opened plaintext differs after rewrapping")
+	}
+	if _, _, err := open(sealed, encryption); err == nil {
+		t.Error("opened with a data key wrapped by a retired master key")
+	}
+}
@@ -0,0 +1,172 @@
+package functions
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/database"
+)
+
+const (
+	JobDeleteAccount     = "delete_account"
+	JobDeleteUserUploads = "delete_user_uploads"
+	JobReconcileStorage  = "reconcile_storage"
+)
+
+const (
+	jobPollInterval = 10 * time.Second
+	jobLease        = 10 * time.Minute
+	jobMaxDelay     = 30 * time.Minute
+)
+
+// jobHandlers run one job each. They may run again after a crash or a failed
+// attempt, so every one of them has to be idempotent.
+var jobHandlers = map[string]func(payload map[string]string) (map[string]interface{}, error){
+	JobDeleteAccount: func(payload map[string]string) (map[string]interface{}, error) {
+		return nil, DeleteAccount(payload["key"])
+	},
+	JobDeleteUserUploads: func(payload map[string]string) (map[string]interface{}, error) {
+		key := payload["key"]
+		deleted, err := database.DeleteUploadsByUserKey(key)
+		if err != nil {
+			return nil, err
+		}
+		KickOutbox()
+
+		if _, err := database.RecalculateUsage(key); err != nil {
+			log.Printf("Error recalculating usage for %s: %v", key, err)
+		}
+		return map[string]interface{}{"deleted_count": deleted}, nil
+	},
+	JobReconcileStorage: func(payload map[string]string) (map[string]interface{}, error) {
+		opts, err := ParseReconcileOptions(payload)
+		if err != nil {
+			return nil, err
+		}
+		report, err := Reconcile(opts)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"report": report}, nil
+	},
+}
+
+var jobKick = make(chan struct{}, 1)
+
+// EnqueueJob saves a job for the workers and wakes one of them up.
+func EnqueueJob(jobType, key string, payload map[string]string) (database.Job, error) {
+	if _, ok := jobHandlers[jobType]; !ok {
+		return database.Job{}, fmt.Errorf("unknown job type %q", jobType)
+	}
+
+	now := time.Now()
+	job := database.Job{
+		Type:        jobType,
+		Key:         key,
+		Payload:     payload,
+		Status:      database.JobQueued,
+		MaxAttempts: jobMaxAttempts(),
+		RunAt:       now,
+		CreatedAt:   now,
+	}
+	if err := database.SaveJob(&job); err != nil {
+		return database.Job{}, err
+	}
+
+	select {
+	case jobKick <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+func jobMaxAttempts() int {
+	if attempts := config.AppConfigInstance.Jobs_MaxAttempts; attempts > 0 {
+		return attempts
+	}
+	return 5
+}
+
+// runNextJob claims and runs one due job. It reports false when there was
+// nothing to do.
+func runNextJob() (bool, error) {
+	job, err := database.ClaimJob(jobLease)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	handler, ok := jobHandlers[job.Type]
+	if !ok {
+		return true, database.FailJob(job.ID, fmt.Errorf("unknown job type %q", job.Type))
+	}
+
+	result, err := runJobHandler(handler, job.Payload)
+	if err == nil {
+		return true, database.FinishJob(job.ID, result)
+	}
+
+	log.Printf("Job %s (%s) failed on attempt %d: %v", job.ID.Hex(), job.Type, job.Attempts, err)
+	if job.Attempts >= job.MaxAttempts {
+		return true, database.FailJob(job.ID, err)
+	}
+	return true, database.RetryJob(job.ID, err, time.Now().Add(jobBackoff(job.Attempts)))
+}
+
+// runJobHandler turns a panicking handler into a failed attempt instead of a
+// dead worker.
+func runJobHandler(handler func(map[string]string) (map[string]interface{}, error), payload map[string]string) (result map[string]interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(payload)
+}
+
+func jobBackoff(attempts int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempts && delay < jobMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > jobMaxDelay {
+		return jobMaxDelay
+	}
+	return delay
+}
+
+// StartJobWorkers runs Jobs_Workers workers that process the job queue until
+// the process exits.
+func StartJobWorkers() {
+	workers := config.AppConfigInstance.Jobs_Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			ticker := time.NewTicker(jobPollInterval)
+			defer ticker.Stop()
+
+			for {
+				ran, err := runNextJob()
+				if err != nil {
+					log.Printf("Error running job: %v", err)
+				}
+				if ran && err == nil {
+					continue
+				}
+
+				select {
+				case <-ticker.C:
+				case <-jobKick:
+				}
+			}
+		}()
+	}
+}
@@ -1,32 +1,102 @@
 package functions
 
 import (
-	"math/rand"
-	"time"
+	"crypto/rand"
+	"log"
+	"math/big"
+	"unicode/utf8"
 
+	"tritan.dev/image-uploader/config"
 	"tritan.dev/image-uploader/database"
 )
 
-func GenerateRandomKey(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	randomSource := rand.NewSource(time.Now().UnixNano())
-	random := rand.New(randomSource)
+// IDKind names a kind of identifier, each with its own alphabet and length.
+type IDKind string
 
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[random.Intn(len(charset))]
+const (
+	IDUpload  IDKind = "upload"
+	IDURL     IDKind = "url"
+	IDAlbum   IDKind = "album"
+	IDAPIKey  IDKind = "api_key"
+	IDStorage IDKind = "storage"
+)
+
+const alphanumeric = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+const apiKeyPrefix = "trtn_"
+
+// idAttempts bounds how often a save is retried with a fresh identifier after
+// hitting a unique index.
+const idAttempts = 5
+
+var defaultIDFormats = map[IDKind]config.IDFormat{
+	IDUpload:  {Alphabet: alphanumeric, Length: 10},
+	IDURL:     {Alphabet: alphanumeric, Length: 10},
+	IDAlbum:   {Alphabet: alphanumeric, Length: 8},
+	IDAPIKey:  {Alphabet: alphanumeric, Length: 32},
+	IDStorage: {Alphabet: alphanumeric, Length: 20},
+}
+
+// idFormat merges the configured format for kind over its default; empty
+// fields keep the default.
+func idFormat(kind IDKind) config.IDFormat {
+	format := defaultIDFormats[kind]
+	override := config.AppConfigInstance.ID_Formats[string(kind)]
+	if utf8.RuneCountInString(override.Alphabet) >= 2 {
+		format.Alphabet = override.Alphabet
+	} else if override.Alphabet != "" {
+		log.Printf("Ignoring ID alphabet for %s: it needs at least two characters\n", kind)
 	}
-	return string(b)
+	if override.Length > 0 {
+		format.Length = override.Length
+	}
+	return format
+}
+
+// NewID returns a fresh identifier of the given kind. API keys carry the
+// trtn_ prefix on top of the random part.
+func NewID(kind IDKind) string {
+	format := idFormat(kind)
+	id := randomString(format.Alphabet, format.Length)
+	if kind == IDAPIKey {
+		return apiKeyPrefix + id
+	}
+	return id
 }
 
-func GenerateAPIKey(totalLength int) string {
-	const prefix = "trtn_"
-	if totalLength <= len(prefix) {
-		return prefix
+// WithUniqueID calls save with fresh identifiers of kind until one does not
+// collide with a unique index, and returns the identifier that was saved.
+func WithUniqueID(kind IDKind, save func(id string) error) (string, error) {
+	var err error
+	for attempt := 0; attempt < idAttempts; attempt++ {
+		id := NewID(kind)
+		if err = save(id); !database.IsDuplicateKey(err) {
+			return id, err
+		}
+		log.Printf("Generated %s ID %s is taken, retrying\n", kind, id)
 	}
+	return "", err
+}
+
+// GenerateRandomKey returns length characters drawn uniformly from the
+// alphanumeric alphabet using crypto/rand.
+func GenerateRandomKey(length int) string {
+	return randomString(alphanumeric, length)
+}
+
+func randomString(alphabet string, length int) string {
+	runes := []rune(alphabet)
+	max := big.NewInt(int64(len(runes)))
 
-	randomLength := totalLength - len(prefix)
-	return prefix + GenerateRandomKey(randomLength)
+	b := make([]rune, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = runes[n.Int64()]
+	}
+	return string(b)
 }
 
 func IsValidKey(key string, validUsers []database.User) bool {
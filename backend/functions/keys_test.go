@@ -0,0 +1,103 @@
+package functions
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/database"
+)
+
+// duplicateKey is what the driver returns when a unique index rejects a write.
+var duplicateKey = mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key error"}}}
+
+func isNil(err error) bool { return err == nil }
+
+func TestWithUniqueID(t *testing.T) {
+	failed := errors.New("connection reset")
+
+	tests := []struct {
+		name     string
+		results  []error // what each save returns, in order
+		attempts int
+		err      func(error) bool
+	}{
+		{"saved first time", []error{nil}, 1, isNil},
+		{"retried after collisions", []error{duplicateKey, duplicateKey, nil}, 3, isNil},
+		{"other errors are not retried", []error{failed}, 1, func(err error) bool { return errors.Is(err, failed) }},
+		{"gives up", []error{duplicateKey, duplicateKey, duplicateKey, duplicateKey, duplicateKey}, idAttempts, database.IsDuplicateKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tried []string
+			id, err := WithUniqueID(IDURL, func(id string) error {
+				tried = append(tried, id)
+				return tt.results[len(tried)-1]
+			})
+
+			if len(tried) != tt.attempts {
+				t.Fatalf("saved %d times, want %d", len(tried), tt.attempts)
+			}
+			if !tt.err(err) {
+				t.Errorf("unexpected err %v", err)
+			}
+			for i := 1; i < len(tried); i++ {
+				if tried[i] == tried[i-1] {
+					t.Errorf("attempt %d reused the colliding ID %q", i+1, tried[i])
+				}
+			}
+
+			switch {
+			case err == nil && id != tried[len(tried)-1]:
+				t.Errorf("returned %q, but %q was saved", id, tried[len(tried)-1])
+			case database.IsDuplicateKey(err) && id != "":
+				t.Errorf("returned %q although nothing was saved", id)
+			}
+		})
+	}
+}
+
+func TestNewID(t *testing.T) {
+	previous := config.AppConfigInstance.ID_Formats
+	t.Cleanup(func() { config.AppConfigInstance.ID_Formats = previous })
+
+	tests := []struct {
+		name     string
+		kind     IDKind
+		formats  map[string]config.IDFormat
+		prefix   string
+		alphabet string
+		length   int
+	}{
+		{"default", IDUpload, nil, "", alphanumeric, 10},
+		{"api keys are prefixed", IDAPIKey, nil, apiKeyPrefix, alphanumeric, 32},
+		{"configured length", IDAlbum, map[string]config.IDFormat{"album": {Length: 4}}, "", alphanumeric, 4},
+		{"configured alphabet", IDURL, map[string]config.IDFormat{"url": {Alphabet: "ab"}}, "", "ab", 10},
+		{"one-letter alphabet ignored", IDURL, map[string]config.IDFormat{"url": {Alphabet: "a", Length: 6}}, "", alphanumeric, 6},
+		{"unicode alphabet", IDUpload, map[string]config.IDFormat{"upload": {Alphabet: "αβγ", Length: 5}}, "", "αβγ", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AppConfigInstance.ID_Formats = tt.formats
+			id := NewID(tt.kind)
+
+			if !strings.HasPrefix(id, tt.prefix) {
+				t.Fatalf("NewID = %q, want prefix %q", id, tt.prefix)
+			}
+			random := strings.TrimPrefix(id, tt.prefix)
+			if utf8.RuneCountInString(random) != tt.length {
+				t.Errorf("NewID = %q, want %d characters", id, tt.length)
+			}
+			for _, r := range random {
+				if !strings.ContainsRune(tt.alphabet, r) {
+					t.Errorf("NewID = %q uses %q outside %q", id, r, tt.alphabet)
+				}
+			}
+		})
+	}
+}
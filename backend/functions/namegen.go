@@ -0,0 +1,215 @@
+package functions
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/database"
+)
+
+const (
+	NameStyleRandom    = "random"
+	NameStyleUUID      = "uuid"
+	NameStyleWords     = "words"
+	NameStyleEmoji     = "emoji"
+	NameStyleInvisible = "invisible"
+	NameStyleTimestamp = "timestamp"
+	NameStyleOriginal  = "original"
+)
+
+// nameAttempts bounds how often a colliding name is regenerated before the
+// upload is given up on.
+const nameAttempts = 8
+
+// claimedNames holds names handed out but maybe not saved yet, so that files
+// in the same batch cannot be given one name (timestamps especially). Claims
+// lapse after nameClaimTTL, by which time the upload is in the database.
+var (
+	claimedNames   = map[string]time.Time{}
+	claimedNamesMu sync.Mutex
+)
+
+const nameClaimTTL = time.Minute
+
+func claimName(name string) bool {
+	claimedNamesMu.Lock()
+	defer claimedNamesMu.Unlock()
+
+	now := time.Now()
+	for claimed, at := range claimedNames {
+		if now.Sub(at) > nameClaimTTL {
+			delete(claimedNames, claimed)
+		}
+	}
+	if _, ok := claimedNames[name]; ok {
+		return false
+	}
+	claimedNames[name] = now
+	return true
+}
+
+// nameGenerators produce upload names from the client's original filename.
+// Styles that can repeat themselves get a random suffix on collision.
+var nameGenerators = map[string]func(original string) string{
+	NameStyleRandom: func(string) string {
+		return NewID(IDUpload)
+	},
+	NameStyleUUID: func(string) string {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		b[6] = (b[6] & 0x0f) | 0x40
+		b[8] = (b[8] & 0x3f) | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	},
+	NameStyleWords: func(string) string {
+		return pick(nameAdjectives) + "-" + pick(nameColors) + "-" + pick(nameAnimals)
+	},
+	NameStyleEmoji: func(string) string {
+		var b strings.Builder
+		for i := 0; i < 5; i++ {
+			b.WriteString(pick(nameEmoji))
+		}
+		return b.String()
+	},
+	NameStyleInvisible: func(string) string {
+		var b strings.Builder
+		for i := 0; i < 24; i++ {
+			b.WriteString(pick(nameInvisible))
+		}
+		return b.String()
+	},
+	NameStyleTimestamp: func(string) string {
+		return time.Now().UTC().Format("20060102-150405")
+	},
+	NameStyleOriginal: slugifyOriginal,
+}
+
+// ValidNameStyle reports whether style names a known generator.
+func ValidNameStyle(style string) bool {
+	_, ok := nameGenerators[style]
+	return ok
+}
+
+// NameStyles lists the generators users can choose from.
+func NameStyles() []string {
+	return []string{
+		NameStyleRandom, NameStyleUUID, NameStyleWords, NameStyleEmoji,
+		NameStyleInvisible, NameStyleTimestamp, NameStyleOriginal,
+	}
+}
+
+// ResolveNameStyle picks the style for an upload: the per-upload override,
+// then the account's choice, then the configured default.
+func ResolveNameStyle(override string, user database.User) string {
+	for _, style := range []string{override, user.NameStyle, config.AppConfigInstance.Upload_NameStyle} {
+		if ValidNameStyle(style) {
+			return style
+		}
+	}
+	return NameStyleRandom
+}
+
+// GenerateUploadName returns a name in the given style that no upload or
+// rename redirect on domain uses yet.
+func GenerateUploadName(domain, style, original string) (string, error) {
+	generate, ok := nameGenerators[style]
+	if !ok {
+		generate = nameGenerators[NameStyleRandom]
+	}
+
+	base := generate(original)
+	name := base
+	for attempt := 0; attempt < nameAttempts; attempt++ {
+		taken, err := database.UploadNameTaken(domain, name, primitive.NilObjectID)
+		if err != nil {
+			return "", err
+		}
+		if !taken && claimName(name) {
+			return name, nil
+		}
+
+		switch style {
+		case NameStyleTimestamp, NameStyleOriginal:
+			name = base + "-" + GenerateRandomKey(4)
+		default:
+			name = generate(original)
+		}
+	}
+	return "", ErrNameTaken
+}
+
+// slugifyOriginal turns the client's filename into a URL-friendly name,
+// falling back to a random one when nothing usable is left.
+func slugifyOriginal(original string) string {
+	base := strings.TrimSuffix(path.Base(strings.ReplaceAll(original, "\\", "/")), path.Ext(original))
+
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(base) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) || r == '_' {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	slug := strings.TrimSuffix(b.String(), "-")
+	if len(slug) > 64 {
+		slug = strings.TrimSuffix(slug[:64], "-")
+	}
+	if slug == "" || isReservedName(slug) {
+		return NewID(IDUpload)
+	}
+	return slug
+}
+
+func pick(values []string) string {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(len(values))))
+	if err != nil {
+		panic(err)
+	}
+	return values[i.Int64()]
+}
+
+var nameAdjectives = []string{
+	"happy", "brave", "calm", "eager", "fancy", "gentle", "jolly", "kind",
+	"lively", "proud", "silly", "witty", "swift", "quiet", "bold", "clever",
+	"cosmic", "dizzy", "fuzzy", "grumpy", "humble", "lucky", "mellow", "nimble",
+	"plucky", "quirky", "rapid", "shiny", "sleepy", "sneaky", "tiny", "zesty",
+}
+
+var nameColors = []string{
+	"red", "orange", "yellow", "green", "blue", "indigo", "violet", "pink",
+	"teal", "cyan", "amber", "coral", "crimson", "golden", "ivory", "jade",
+	"lilac", "magenta", "maroon", "navy", "olive", "peach", "plum", "ruby",
+	"rust", "sage", "scarlet", "silver", "tan", "topaz", "umber", "white",
+}
+
+var nameAnimals = []string{
+	"otter", "badger", "falcon", "gecko", "heron", "ibis", "jaguar", "koala",
+	"lemur", "marten", "newt", "ocelot", "panda", "quokka", "raven", "seal",
+	"tapir", "urchin", "vole", "walrus", "yak", "zebra", "beaver", "cobra",
+	"dingo", "egret", "ferret", "gibbon", "hyena", "impala", "lynx", "moose",
+}
+
+var nameEmoji = []string{
+	"😀", "😂", "😎", "🤖", "👾", "🎃", "🐶", "🐱", "🦊", "🐼", "🐸", "🐙",
+	"🦄", "🐝", "🌵", "🌈", "🔥", "⭐", "🍕", "🍩", "🍉", "🍒", "🎈", "🎉",
+	"🎸", "🚀", "🛸", "💎", "💡", "📎", "🔑", "🧩",
+}
+
+// nameInvisible are zero-width characters; a name made of them renders as
+// nothing after the slash, which is the point of the style.
+var nameInvisible = []string{"\u200b", "\u200c", "\u200d", "\u2060"}
@@ -0,0 +1,124 @@
+package functions
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/database"
+)
+
+func TestNameGenerators(t *testing.T) {
+	tests := []struct {
+		style string
+		valid func(string) bool
+	}{
+		{NameStyleRandom, regexp.MustCompile(`^[A-Za-z0-9]{10}$`).MatchString},
+		{NameStyleUUID, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString},
+		{NameStyleWords, regexp.MustCompile(`^[a-z]+-[a-z]+-[a-z]+$`).MatchString},
+		{NameStyleEmoji, func(name string) bool { return len([]rune(name)) == 5 }},
+		{NameStyleInvisible, func(name string) bool {
+			return len([]rune(name)) == 24 && strings.Trim(name, strings.Join(nameInvisible, "")) == ""
+		}},
+		{NameStyleTimestamp, regexp.MustCompile(`^\d{8}-\d{6}$`).MatchString},
+		{NameStyleOriginal, func(name string) bool { return name == "holiday-photo" }},
+	}
+
+	if len(tests) != len(NameStyles()) {
+		t.Fatalf("testing %d styles, %d are offered", len(tests), len(NameStyles()))
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.style, func(t *testing.T) {
+			if !ValidNameStyle(tt.style) {
+				t.Fatalf("%s is not a valid style", tt.style)
+			}
+			for i := 0; i < 20; i++ {
+				if name := nameGenerators[tt.style]("Holiday Photo.png"); !tt.valid(name) {
+					t.Fatalf("generated %q", name)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveNameStyle(t *testing.T) {
+	previous := config.AppConfigInstance.Upload_NameStyle
+	t.Cleanup(func() { config.AppConfigInstance.Upload_NameStyle = previous })
+
+	tests := []struct {
+		name     string
+		override string
+		account  string
+		fallback string
+		want     string
+	}{
+		{"override wins", NameStyleEmoji, NameStyleWords, NameStyleUUID, NameStyleEmoji},
+		{"account next", "", NameStyleWords, NameStyleUUID, NameStyleWords},
+		{"configured default", "", "", NameStyleUUID, NameStyleUUID},
+		{"unknown styles skipped", "shouting", "bogus", NameStyleTimestamp, NameStyleTimestamp},
+		{"nothing valid", "", "", "bogus", NameStyleRandom},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AppConfigInstance.Upload_NameStyle = tt.fallback
+			if got := ResolveNameStyle(tt.override, database.User{NameStyle: tt.account}); got != tt.want {
+				t.Errorf("ResolveNameStyle = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateUploadName(t *testing.T) {
+	useReservedNames(t)
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	taken := counted("uploads", 1)
+
+	tests := []struct {
+		name    string
+		style   string
+		replies []bson.D
+		want    *regexp.Regexp
+		err     error
+	}{
+		{"free on the first try", NameStyleWords, nameFree(), regexp.MustCompile(`^[a-z]+-[a-z]+-[a-z]+$`), nil},
+		{"regenerated after a collision", NameStyleRandom, append([]bson.D{taken, taken}, nameFree()...), regexp.MustCompile(`^[A-Za-z0-9]{10}$`), nil},
+		{"suffixed original", NameStyleOriginal, append([]bson.D{taken}, nameFree()...), regexp.MustCompile(`^holiday-photo-[A-Za-z0-9]{4}$`), nil},
+		{"unknown style is random", "bogus", nameFree(), regexp.MustCompile(`^[A-Za-z0-9]{10}$`), nil},
+		{"gives up", NameStyleRandom, []bson.D{taken, taken, taken, taken, taken, taken, taken, taken}, nil, ErrNameTaken},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			database.Use(mt.Client)
+			mt.AddMockResponses(tt.replies...)
+
+			name, err := GenerateUploadName("i.example.com", tt.style, "Holiday Photo.png")
+			if !errors.Is(err, tt.err) {
+				mt.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.want != nil && !tt.want.MatchString(name) {
+				mt.Errorf("generated %q, want %s", name, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimName(t *testing.T) {
+	name := "claim-" + GenerateRandomKey(8)
+	if !claimName(name) {
+		t.Fatal("first claim was refused")
+	}
+	if claimName(name) {
+		t.Error("a name was handed out twice")
+	}
+	if !claimName(name + "-2") {
+		t.Error("claiming one name blocked another")
+	}
+}
@@ -0,0 +1,59 @@
+package functions
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/database"
+)
+
+var (
+	ErrNameInvalid  = errors.New("invalid upload name")
+	ErrNameReserved = errors.New("reserved upload name")
+	ErrNameTaken    = errors.New("upload name already taken")
+)
+
+var uploadNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{2,63}$`)
+
+// reservedNames can never be chosen as upload names, because they collide
+// with routes or would make links look like part of the site itself.
+var reservedNames = []string{
+	"a", "i", "u", "api", "raw", "unlock", "admin", "account", "settings",
+	"dashboard", "login", "logout", "register", "upload", "uploads", "urls",
+	"albums", "trash", "search", "static", "assets", "favicon", "robots",
+	"sitemap", "index", "null", "undefined",
+}
+
+func isReservedName(name string) bool {
+	name = strings.ToLower(name)
+	for _, reserved := range append(reservedNames, config.AppConfigInstance.Upload_ReservedNames...) {
+		if name == strings.ToLower(reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckUploadName validates a user chosen name and makes sure nothing else on
+// domain uses it. except is the ID of the upload being renamed, if any, so
+// that it can take back one of its own earlier names.
+func CheckUploadName(domain, name string, except primitive.ObjectID) error {
+	if !uploadNamePattern.MatchString(name) {
+		return ErrNameInvalid
+	}
+	if isReservedName(name) {
+		return ErrNameReserved
+	}
+
+	taken, err := database.UploadNameTaken(domain, name, except)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrNameTaken
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package functions
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/database"
+)
+
+// counted is the reply to a count on coll that found n documents.
+func counted(coll string, n int) bson.D {
+	if n == 0 {
+		return mtest.CreateCursorResponse(0, "ShareX-Uploader."+coll, mtest.FirstBatch)
+	}
+	return mtest.CreateCursorResponse(0, "ShareX-Uploader."+coll, mtest.FirstBatch, bson.D{{Key: "n", Value: int32(n)}})
+}
+
+// nameFree are the replies UploadNameTaken gets for a name nothing uses.
+func nameFree() []bson.D {
+	return []bson.D{counted("uploads", 0), counted("upload_redirects", 0)}
+}
+
+func useReservedNames(t *testing.T, names ...string) {
+	t.Helper()
+	previous := config.AppConfigInstance.Upload_ReservedNames
+	t.Cleanup(func() { config.AppConfigInstance.Upload_ReservedNames = previous })
+	config.AppConfigInstance.Upload_ReservedNames = names
+}
+
+func TestCheckUploadName(t *testing.T) {
+	useReservedNames(t, "Blog")
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name    string
+		upload  string
+		replies []bson.D
+		want    error
+	}{
+		{"free", "holiday-2024", nameFree(), nil},
+		{"too short", "ab", nil, ErrNameInvalid},
+		{"too long", strings.Repeat("a", 65), nil, ErrNameInvalid},
+		{"leading dash", "-holiday", nil, ErrNameInvalid},
+		{"slash", "a/b/c", nil, ErrNameInvalid},
+		{"dot", "cat.png", nil, ErrNameInvalid},
+		{"route", "admin", nil, ErrNameReserved},
+		{"route in capitals", "Settings", nil, ErrNameReserved},
+		{"configured", "blog", nil, ErrNameReserved},
+		{"used by an upload", "holiday", []bson.D{counted("uploads", 1)}, ErrNameTaken},
+		{"kept by a redirect", "holiday", []bson.D{counted("uploads", 0), counted("upload_redirects", 1)}, ErrNameTaken},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			database.Use(mt.Client)
+			mt.AddMockResponses(tt.replies...)
+
+			if err := CheckUploadName("i.example.com", tt.upload, primitive.NilObjectID); !errors.Is(err, tt.want) {
+				mt.Errorf("CheckUploadName(%q) = %v, want %v", tt.upload, err, tt.want)
+			}
+			// Invalid and reserved names are turned down without a lookup.
+			if tt.replies == nil {
+				if started := mt.GetStartedEvent(); started != nil {
+					mt.Errorf("sent %s for a name that was never allowed", started.CommandName)
+				}
+			}
+		})
+	}
+}
+
+func TestSlugifyOriginal(t *testing.T) {
+	useReservedNames(t)
+
+	tests := []struct {
+		original string
+		want     string
+	}{
+		{"Holiday Photo.PNG", "holiday-photo"},
+		{"C:\\Users\\me\\Screenshot (3).png", "screenshot-3"},
+		{"dir/sub/my_file.tar.gz", "my_file-tar"},
+		{"--weird--name--.jpg", "weird-name"},
+		{"café.jpg", "caf"},
+		{strings.Repeat("a", 70) + ".png", strings.Repeat("a", 64)},
+	}
+
+	for _, tt := range tests {
+		if got := slugifyOriginal(tt.original); got != tt.want {
+			t.Errorf("slugifyOriginal(%q) = %q, want %q", tt.original, got, tt.want)
+		}
+	}
+
+	// Names with nothing usable, or only a reserved word, fall back to a
+	// random name.
+	for _, original := range []string{"日本.png", "....png", "Admin.png"} {
+		got := slugifyOriginal(original)
+		if got == "" || isReservedName(got) || !uploadNamePattern.MatchString(got) {
+			t.Errorf("slugifyOriginal(%q) = %q, want a random name", original, got)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package functions
+
+import (
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"tritan.dev/image-uploader/database"
+)
+
+const (
+	outboxInterval = time.Minute
+	outboxLease    = 5 * time.Minute
+	outboxMaxDelay = time.Hour
+)
+
+var outboxKick = make(chan struct{}, 1)
+
+// KickOutbox wakes the storage worker after a commit that queued deletions,
+// instead of leaving them until the next tick.
+func KickOutbox() {
+	select {
+	case outboxKick <- struct{}{}:
+	default:
+	}
+}
+
+// DrainOutbox deletes every due object in the storage outbox. Objects that
+// are referenced again are dropped from the outbox without being deleted;
+// failed deletions are retried with exponential backoff.
+func DrainOutbox() (int, error) {
+	deleted := 0
+	for {
+		entry, err := database.ClaimOutboxEntry(outboxLease)
+		if err == mongo.ErrNoDocuments {
+			return deleted, nil
+		}
+		if err != nil {
+			return deleted, err
+		}
+
+		referenced, err := database.ObjectReferenced(entry.StorageKey)
+		if err == nil && !referenced {
+			err = DeleteFileFromS3(entry.StorageKey)
+		}
+		if err != nil {
+			log.Printf("Error deleting %s from storage (attempt %d): %v", entry.StorageKey, entry.Attempts, err)
+			if err := database.RetryOutboxEntry(entry.ID, err, time.Now().Add(outboxBackoff(entry.Attempts))); err != nil {
+				return deleted, err
+			}
+			continue
+		}
+
+		if err := database.CompleteOutboxEntry(entry.ID); err != nil {
+			return deleted, err
+		}
+		if !referenced {
+			deleted++
+		}
+	}
+}
+
+func outboxBackoff(attempts int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < attempts && delay < outboxMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxDelay {
+		return outboxMaxDelay
+	}
+	return delay
+}
+
+// StartOutboxWorker drains the storage outbox in the background, on a fixed
+// interval and whenever KickOutbox is called.
+func StartOutboxWorker() {
+	go func() {
+		ticker := time.NewTicker(outboxInterval)
+		defer ticker.Stop()
+
+		for {
+			deleted, err := DrainOutbox()
+			if err != nil {
+				log.Printf("Error draining storage outbox: %v", err)
+			} else if deleted > 0 {
+				log.Printf("Deleted %d objects from the storage outbox", deleted)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-outboxKick:
+			}
+		}
+	}()
+}
+
+// DeleteAccount removes a user with all their records and has their stored
+// objects deleted once that has committed.
+func DeleteAccount(key string) error {
+	if err := database.DeleteUserByKey(key); err != nil {
+		return err
+	}
+	KickOutbox()
+	return nil
+}
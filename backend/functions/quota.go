@@ -0,0 +1,32 @@
+package functions
+
+import (
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/database"
+)
+
+func effectiveLimit(override, fallback int64) int64 {
+	switch {
+	case override < 0:
+		return 0
+	case override > 0:
+		return override
+	default:
+		return fallback
+	}
+}
+
+// EffectiveLimits merges a user's overrides with the configured defaults. In
+// the result a zero field means the limit does not apply.
+func EffectiveLimits(user database.User) database.UserLimits {
+	var overrides database.UserLimits
+	if user.Limits != nil {
+		overrides = *user.Limits
+	}
+
+	return database.UserLimits{
+		MaxBytes:    effectiveLimit(overrides.MaxBytes, config.AppConfigInstance.Quota_MaxBytes),
+		MaxFiles:    effectiveLimit(overrides.MaxFiles, config.AppConfigInstance.Quota_MaxFiles),
+		MaxFileSize: effectiveLimit(overrides.MaxFileSize, config.AppConfigInstance.Quota_MaxFileSize),
+	}
+}
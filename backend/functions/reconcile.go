@@ -0,0 +1,365 @@
+package functions
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/constants"
+	"tritan.dev/image-uploader/database"
+)
+
+const (
+	ReconcileOrphansDelete = "delete"
+	ReconcileOrphansImport = "import"
+
+	ReconcileDanglingMark   = "mark"
+	ReconcileDanglingDelete = "delete"
+)
+
+// ReconcileOptions choose what Reconcile repairs. With DryRun set it only
+// reports what it would do. Objects newer than MinAge are left alone, since
+// an upload in flight is stored before its record is saved.
+type ReconcileOptions struct {
+	DryRun    bool
+	Orphans   string
+	Dangling  string
+	FixSizes  bool
+	ImportKey string
+	MinAge    time.Duration
+}
+
+type OrphanObject struct {
+	StorageKey string    `bson:"storage_key" json:"storage_key"`
+	Size       int64     `bson:"size" json:"size"`
+	Modified   time.Time `bson:"modified" json:"modified"`
+	Action     string    `bson:"action,omitempty" json:"action,omitempty"`
+}
+
+// DanglingRecord is an upload, or one kept version of it, whose object is not
+// in the bucket. Version is 0 for the current content.
+type DanglingRecord struct {
+	UploadID   primitive.ObjectID `bson:"upload_id" json:"upload_id"`
+	FileName   string             `bson:"file_name" json:"file_name"`
+	StorageKey string             `bson:"storage_key" json:"storage_key"`
+	Version    int                `bson:"version,omitempty" json:"version,omitempty"`
+	Action     string             `bson:"action,omitempty" json:"action,omitempty"`
+}
+
+type SizeMismatch struct {
+	UploadID   primitive.ObjectID `bson:"upload_id" json:"upload_id"`
+	FileName   string             `bson:"file_name" json:"file_name"`
+	StorageKey string             `bson:"storage_key" json:"storage_key"`
+	Version    int                `bson:"version,omitempty" json:"version,omitempty"`
+	Recorded   int64              `bson:"recorded" json:"recorded"`
+	Actual     int64              `bson:"actual" json:"actual"`
+	Action     string             `bson:"action,omitempty" json:"action,omitempty"`
+}
+
+// ReconcileReport lists the differences found between the bucket and the
+// uploads collection. Field names match in BSON and JSON because the report
+// is also stored as a job result.
+type ReconcileReport struct {
+	DryRun         bool             `bson:"dry_run" json:"dry_run"`
+	ObjectsScanned int              `bson:"objects_scanned" json:"objects_scanned"`
+	RecordsScanned int              `bson:"records_scanned" json:"records_scanned"`
+	Orphans        []OrphanObject   `bson:"orphans" json:"orphans"`
+	Dangling       []DanglingRecord `bson:"dangling" json:"dangling"`
+	SizeMismatches []SizeMismatch   `bson:"size_mismatches" json:"size_mismatches"`
+	Errors         []string         `bson:"errors,omitempty" json:"errors,omitempty"`
+}
+
+// objectRef is one record that points at a storage key.
+type objectRef struct {
+	upload  database.UploadEntry
+	version int
+	size    int64
+	sealed  bool
+}
+
+// OptionError is a ReconcileOptions problem with the option it concerns, so
+// the admin API can name the query parameter to fix.
+type OptionError struct {
+	Field   string
+	Message string
+}
+
+func (e OptionError) Error() string {
+	return e.Message
+}
+
+// ParseReconcileOptions reads options from string fields, as they arrive in a
+// job payload. Dry runs are the default; dry_run has to be "false" to repair.
+func ParseReconcileOptions(fields map[string]string) (ReconcileOptions, error) {
+	opts := ReconcileOptions{
+		DryRun:    fields["dry_run"] != "false",
+		Orphans:   fields["orphans"],
+		Dangling:  fields["dangling"],
+		FixSizes:  fields["fix_sizes"] == "true",
+		ImportKey: fields["import_key"],
+		MinAge:    time.Hour,
+	}
+	if raw := fields["min_age"]; raw != "" {
+		minAge, err := time.ParseDuration(raw)
+		if err != nil || minAge < 0 {
+			return opts, OptionError{"min_age", fmt.Sprintf("invalid min_age %q", raw)}
+		}
+		opts.MinAge = minAge
+	}
+	return opts, opts.Validate()
+}
+
+// Validate checks that the chosen repairs exist and can be carried out.
+func (opts ReconcileOptions) Validate() error {
+	switch opts.Orphans {
+	case "", ReconcileOrphansDelete:
+	case ReconcileOrphansImport:
+		if opts.ImportKey == "" {
+			return OptionError{"import_key", "importing orphans needs the key of the user to import them to"}
+		}
+		if config.AppConfigInstance.Storage_Encrypt {
+			return OptionError{"orphans", "orphans cannot be imported while Storage_Encrypt is on: their data keys are lost"}
+		}
+	default:
+		return OptionError{"orphans", fmt.Sprintf("unknown orphan action %q", opts.Orphans)}
+	}
+
+	switch opts.Dangling {
+	case "", ReconcileDanglingMark, ReconcileDanglingDelete:
+	default:
+		return OptionError{"dangling", fmt.Sprintf("unknown dangling action %q", opts.Dangling)}
+	}
+	return nil
+}
+
+// Reconcile compares every object in the bucket with the upload records that
+// point at it and, unless DryRun is set, applies the chosen repairs.
+// Envelope-encrypted objects are stored with their nonce and tag, so their
+// sizes are not compared.
+func Reconcile(opts ReconcileOptions) (ReconcileReport, error) {
+	report := ReconcileReport{
+		DryRun:         opts.DryRun,
+		Orphans:        []OrphanObject{},
+		Dangling:       []DanglingRecord{},
+		SizeMismatches: []SizeMismatch{},
+	}
+	if err := opts.Validate(); err != nil {
+		return report, err
+	}
+
+	refs := map[string][]objectRef{}
+	err := database.EachUploadObject(func(upload database.UploadEntry) error {
+		report.RecordsScanned++
+		refs[upload.ObjectKey()] = append(refs[upload.ObjectKey()], objectRef{
+			upload: upload,
+			size:   upload.Metadata.FileSize,
+			sealed: upload.Encryption != nil,
+		})
+		for _, v := range upload.Versions {
+			refs[v.StorageKey] = append(refs[v.StorageKey], objectRef{
+				upload:  upload,
+				version: v.Version,
+				size:    v.FileSize,
+				sealed:  v.Encryption != nil,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	pending, err := database.PendingObjectDeletions()
+	if err != nil {
+		return report, err
+	}
+
+	seen := map[string]bool{}
+	cutoff := time.Now().Add(-opts.MinAge)
+	err = ListS3Objects(func(object *s3.Object) error {
+		report.ObjectsScanned++
+		key := aws.StringValue(object.Key)
+		size := aws.Int64Value(object.Size)
+		seen[key] = true
+
+		holders, ok := refs[key]
+		if !ok {
+			modified := aws.TimeValue(object.LastModified)
+			if pending[key] || modified.After(cutoff) {
+				return nil
+			}
+			report.Orphans = append(report.Orphans, OrphanObject{StorageKey: key, Size: size, Modified: modified})
+			return nil
+		}
+
+		for _, ref := range holders {
+			if ref.sealed || ref.size == size {
+				continue
+			}
+			report.SizeMismatches = append(report.SizeMismatches, SizeMismatch{
+				UploadID:   ref.upload.ID,
+				FileName:   ref.upload.FileName,
+				StorageKey: key,
+				Version:    ref.version,
+				Recorded:   ref.size,
+				Actual:     size,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for key, holders := range refs {
+		if seen[key] {
+			continue
+		}
+		for _, ref := range holders {
+			report.Dangling = append(report.Dangling, DanglingRecord{
+				UploadID:   ref.upload.ID,
+				FileName:   ref.upload.FileName,
+				StorageKey: key,
+				Version:    ref.version,
+			})
+		}
+	}
+
+	if !opts.DryRun {
+		repairReport(&report, opts)
+	}
+	return report, nil
+}
+
+// repairReport applies the chosen repairs and records on each entry what was
+// done to it.
+func repairReport(report *ReconcileReport, opts ReconcileOptions) {
+	fail := func(format string, args ...interface{}) {
+		message := fmt.Sprintf(format, args...)
+		log.Println("Reconcile:", message)
+		report.Errors = append(report.Errors, message)
+	}
+
+	var importUser database.User
+	if opts.Orphans == ReconcileOrphansImport {
+		user, err := database.GetUserByKey(opts.ImportKey)
+		if err != nil {
+			fail("import user %s: %v", opts.ImportKey, err)
+			opts.Orphans = ""
+		}
+		importUser = user
+	}
+
+	queued := false
+	for i := range report.Orphans {
+		orphan := &report.Orphans[i]
+		switch opts.Orphans {
+		case ReconcileOrphansDelete:
+			if err := database.QueueObjectDeletion(orphan.StorageKey); err != nil {
+				fail("queue deletion of %s: %v", orphan.StorageKey, err)
+				continue
+			}
+			orphan.Action = "queued_for_deletion"
+			queued = true
+		case ReconcileOrphansImport:
+			fileName, err := importOrphan(importUser, *orphan)
+			if err != nil {
+				fail("import %s: %v", orphan.StorageKey, err)
+				continue
+			}
+			orphan.Action = "imported as " + fileName
+		}
+	}
+	if queued {
+		KickOutbox()
+	}
+
+	usageChanged := map[string]bool{}
+	for i := range report.Dangling {
+		record := &report.Dangling[i]
+		var err error
+		switch {
+		case opts.Dangling == ReconcileDanglingMark && record.Version == 0:
+			err = database.MarkUploadMissing(record.UploadID)
+			record.Action = "marked_missing"
+		case opts.Dangling == ReconcileDanglingDelete && record.Version == 0:
+			_, err = PurgeUpload(record.UploadID)
+			record.Action = "deleted"
+		case opts.Dangling == ReconcileDanglingDelete:
+			err = database.DropUploadVersion(record.UploadID, record.Version)
+			record.Action = "version_dropped"
+			if upload, lookupErr := database.GetUploadByID(record.UploadID); lookupErr == nil {
+				usageChanged[upload.Key] = true
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			fail("repair %s: %v", record.FileName, err)
+			record.Action = ""
+		}
+	}
+
+	if opts.FixSizes {
+		for i := range report.SizeMismatches {
+			mismatch := &report.SizeMismatches[i]
+			if err := database.SetStoredSize(mismatch.UploadID, mismatch.Version, mismatch.Actual); err != nil {
+				fail("fix size of %s: %v", mismatch.FileName, err)
+				continue
+			}
+			mismatch.Action = "size_fixed"
+			if upload, err := database.GetUploadByID(mismatch.UploadID); err == nil {
+				usageChanged[upload.Key] = true
+			}
+		}
+	}
+
+	for key := range usageChanged {
+		if _, err := database.RecalculateUsage(key); err != nil {
+			fail("recalculate usage of %s: %v", key, err)
+		}
+	}
+}
+
+// importOrphan gives an orphaned object a private upload record owned by
+// user, under its own key as the name when that is free.
+func importOrphan(user database.User, orphan OrphanObject) (string, error) {
+	ext := path.Ext(orphan.StorageKey)
+	name := orphan.StorageKey[:len(orphan.StorageKey)-len(ext)]
+	if err := CheckUploadName(user.Domain, name, primitive.NilObjectID); err != nil {
+		name = NewID(IDUpload)
+	}
+
+	entry := database.UploadEntry{
+		ID:          primitive.NewObjectID(),
+		Key:         user.Key,
+		DisplayName: user.DisplayName,
+		FileName:    name + ext,
+		Domain:      user.Domain,
+		StorageKey:  orphan.StorageKey,
+		Metadata: database.Metadata{
+			FileType:   ext,
+			FileSize:   orphan.Size,
+			UploadDate: orphan.Modified,
+		},
+		Type:         constants.UploadTypeFile,
+		Visibility:   constants.VisibilityPrivate,
+		OriginalName: path.Base(orphan.StorageKey),
+		Title:        "Recovered from storage",
+	}
+	if err := database.SaveUploadToDB(entry); err != nil {
+		return "", err
+	}
+	if err := ApplyObjectACL(&entry); err != nil {
+		log.Printf("Error making %s private: %v", entry.ObjectKey(), err)
+	}
+	if err := database.AdjustUsage(user.Key, orphan.Size, 1); err != nil {
+		log.Printf("Error adding usage for %s: %v", user.Key, err)
+	}
+	return entry.FileName, nil
+}
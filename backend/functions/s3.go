@@ -56,19 +56,38 @@ func DeleteFileFromS3(fileName string) error {
 	return nil
 }
 
-func UploadFileToS3(fileBody io.ReadSeeker, fileName string) error {
+type S3ObjectOptions struct {
+	Public             bool
+	ContentType        string
+	ContentDisposition string
+}
+
+func UploadFileToS3(fileBody io.ReadSeeker, fileName string, opts S3ObjectOptions) error {
 	sess, err := createS3Session()
 	if err != nil {
 		return err
 	}
 
-	svc := s3.New(sess)
-	_, err = svc.PutObject(&s3.PutObjectInput{
+	acl := "private"
+	if opts.Public {
+		acl = "public-read"
+	}
+
+	input := &s3.PutObjectInput{
 		Body:   fileBody,
 		Bucket: aws.String(config.AppConfigInstance.S3_BucketName),
 		Key:    aws.String(fileName),
-		ACL:    aws.String("public-read"),
-	})
+		ACL:    aws.String(acl),
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(opts.ContentDisposition)
+	}
+
+	svc := s3.New(sess)
+	_, err = svc.PutObject(input)
 	if err != nil {
 		log.Println("Error uploading to S3:", err)
 		return err
@@ -100,3 +119,100 @@ func VerifyUploadToS3(fileName string) bool {
 
 	return verified
 }
+
+func GetFileFromS3(fileName string) (*s3.GetObjectOutput, error) {
+	sess, err := createS3Session()
+	if err != nil {
+		return nil, err
+	}
+
+	svc := s3.New(sess)
+	output, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(config.AppConfigInstance.S3_BucketName),
+		Key:    aws.String(fileName),
+	})
+	if err != nil {
+		log.Println("Error fetching object from S3:", err)
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// ListS3Objects calls fn for every object in the bucket, a page at a time.
+func ListS3Objects(fn func(object *s3.Object) error) error {
+	sess, err := createS3Session()
+	if err != nil {
+		return err
+	}
+
+	var fnErr error
+	svc := s3.New(sess)
+	err = svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(config.AppConfigInstance.S3_BucketName),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			if fnErr = fn(object); fnErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		log.Println("Error listing objects in S3:", err)
+		return err
+	}
+	return fnErr
+}
+
+func SetFileACL(fileName string, public bool) error {
+	sess, err := createS3Session()
+	if err != nil {
+		return err
+	}
+
+	acl := "private"
+	if public {
+		acl = "public-read"
+	}
+
+	svc := s3.New(sess)
+	_, err = svc.PutObjectAcl(&s3.PutObjectAclInput{
+		Bucket: aws.String(config.AppConfigInstance.S3_BucketName),
+		Key:    aws.String(fileName),
+		ACL:    aws.String(acl),
+	})
+	if err != nil {
+		log.Println("Error updating object ACL in S3:", err)
+		return err
+	}
+
+	return nil
+}
+
+func CopyFileInS3(sourceName, destinationName string, public bool) error {
+	sess, err := createS3Session()
+	if err != nil {
+		return err
+	}
+
+	acl := "private"
+	if public {
+		acl = "public-read"
+	}
+
+	bucket := config.AppConfigInstance.S3_BucketName
+	svc := s3.New(sess)
+	_, err = svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(bucket),
+		CopySource: aws.String(bucket + "/" + sourceName),
+		Key:        aws.String(destinationName),
+		ACL:        aws.String(acl),
+	})
+	if err != nil {
+		log.Println("Error copying object in S3:", err)
+		return err
+	}
+
+	return nil
+}
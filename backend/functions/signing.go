@@ -0,0 +1,70 @@
+package functions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/database"
+)
+
+// exampleSigningSecret is the placeholder in config.go.example. Tokens signed
+// with it, or with no secret at all, could be forged by anyone.
+const exampleSigningSecret = "change-me-to-a-long-random-string"
+
+// CheckSigningSecret reports whether Signing_Secret is fit to sign tokens
+// with. The server refuses to start without one, and VerifyToken rejects
+// every token until it is set.
+func CheckSigningSecret() error {
+	switch config.AppConfigInstance.Signing_Secret {
+	case "":
+		return errors.New("Signing_Secret is empty")
+	case exampleSigningSecret:
+		return errors.New("Signing_Secret is still the example value")
+	}
+	return nil
+}
+
+func signPayload(payload string) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfigInstance.Signing_Secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignToken returns a token for subject that VerifyToken accepts until ttl has passed.
+func SignToken(subject string, ttl time.Duration) string {
+	expires := time.Now().Add(ttl).Unix()
+	payload := fmt.Sprintf("%s|%d", subject, expires)
+	return fmt.Sprintf("%d.%s", expires, signPayload(payload))
+}
+
+func VerifyToken(subject, token string) bool {
+	if CheckSigningSecret() != nil {
+		return false
+	}
+
+	rawExpires, signature, found := strings.Cut(token, ".")
+	if !found {
+		return false
+	}
+
+	expires, err := strconv.ParseInt(rawExpires, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+
+	expected := signPayload(fmt.Sprintf("%s|%d", subject, expires))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// ShareSubject is what share links for an upload are signed over. It uses the
+// upload ID, as names are only unique per domain and change on rename.
+func ShareSubject(upload database.UploadEntry) string {
+	return "share:" + upload.ID.Hex()
+}
@@ -0,0 +1,244 @@
+package functions
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/database"
+)
+
+// StoreObject writes an upload to the bucket. With Storage_Encrypt enabled the
+// bytes are sealed as they are sent and the object is always stored without a
+// public ACL.
+func StoreObject(body io.ReadSeeker, fileName string, opts S3ObjectOptions) (*database.ObjectEncryption, error) {
+	if !config.AppConfigInstance.Storage_Encrypt {
+		return nil, UploadFileToS3(body, fileName, opts)
+	}
+
+	sealed, encryption, err := SealObject(body)
+	if err != nil {
+		log.Println("Error encrypting object:", err)
+		return nil, err
+	}
+
+	opts.Public = false
+	if err := UploadFileToS3(sealed, fileName, opts); err != nil {
+		return nil, err
+	}
+
+	return encryption, nil
+}
+
+// OpenObject returns the plaintext of an upload and its length, decrypting it
+// when it was stored with envelope encryption.
+func OpenObject(upload database.UploadEntry) (io.ReadCloser, int64, error) {
+	object, err := GetFileFromS3(upload.ObjectKey())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if upload.Encryption == nil {
+		return object.Body, aws.Int64Value(object.ContentLength), nil
+	}
+
+	if upload.Encryption.ChunkSize > 0 {
+		body, size, err := OpenSealed(object.Body, aws.Int64Value(object.ContentLength), upload.Encryption)
+		if err != nil {
+			object.Body.Close()
+			log.Printf("Error decrypting %s: %v\n", upload.FileName, err)
+			return nil, 0, err
+		}
+		return body, size, nil
+	}
+	defer object.Body.Close()
+
+	// Objects sealed before chunking can only be opened whole.
+	ciphertext, err := io.ReadAll(object.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	plaintext, err := DecryptObject(ciphertext, upload.Encryption)
+	if err != nil {
+		log.Printf("Error decrypting %s: %v\n", upload.FileName, err)
+		return nil, 0, err
+	}
+
+	return io.NopCloser(bytes.NewReader(plaintext)), int64(len(plaintext)), nil
+}
+
+// RotateStorageKeys re-wraps the data key of every upload that is not yet under
+// the active master key and returns how many uploads were updated.
+func RotateStorageKeys() (int, error) {
+	activeKeyID := config.AppConfigInstance.Storage_MasterKeyID
+	rotated := 0
+
+	for {
+		uploads, err := database.LoadUploadsForRewrap(activeKeyID, 100)
+		if err != nil {
+			return rotated, err
+		}
+		if len(uploads) == 0 {
+			return rotated, nil
+		}
+
+		for _, upload := range uploads {
+			// Kept versions are sealed independently of the current content.
+			objects := map[string]*database.ObjectEncryption{upload.ObjectKey(): upload.Encryption}
+			for _, version := range upload.Versions {
+				objects[version.StorageKey] = version.Encryption
+			}
+
+			for objectKey, current := range objects {
+				if current == nil || current.KeyID == activeKeyID {
+					continue
+				}
+
+				encryption, err := RewrapDataKey(current)
+				if err != nil {
+					log.Printf("Error re-wrapping data key for %s: %v\n", upload.FileName, err)
+					return rotated, err
+				}
+
+				if err := database.UpdateObjectEncryption(objectKey, encryption); err != nil {
+					return rotated, err
+				}
+			}
+			rotated++
+		}
+	}
+}
+
+// HashObject returns the hex SHA-256 of body and rewinds it for the upload.
+func HashObject(body io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return "", err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func shareable(upload *database.UploadEntry) bool {
+	return config.AppConfigInstance.Upload_DedupShared && upload.Hash != "" && !upload.IsEncrypted()
+}
+
+// PutUploadObject stores the bytes for upload and fills in its StorageKey and
+// Encryption. Identical content already in the bucket with the same ACL is
+// shared instead of being written again.
+func PutUploadObject(body io.ReadSeeker, upload *database.UploadEntry, opts S3ObjectOptions) error {
+	public := opts.Public && !config.AppConfigInstance.Storage_Encrypt
+
+	if shareable(upload) {
+		if object, err := database.AcquireObject(upload.Hash, public); err == nil {
+			upload.StorageKey = object.StorageKey
+			upload.Encryption = object.Encryption
+			return nil
+		}
+	}
+
+	// Objects get their own key rather than the upload's name, so a name
+	// collision can be retried without ever overwriting someone's bytes.
+	key := NewID(IDStorage) + path.Ext(upload.FileName)
+	encryption, err := StoreObject(body, key, opts)
+	if err != nil {
+		return err
+	}
+	upload.StorageKey = key
+	upload.Encryption = encryption
+
+	if shareable(upload) {
+		err := database.RegisterObject(database.StoredObject{
+			StorageKey: key,
+			Hash:       upload.Hash,
+			Public:     public,
+			Size:       upload.Metadata.FileSize,
+			Encryption: encryption,
+		})
+		if err != nil {
+			log.Printf("Error registering shared object %s: %v\n", upload.FileName, err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteUploadObject removes the bytes behind an upload and its kept versions,
+// unless other uploads still hold a reference to the same shared object.
+func DeleteUploadObject(upload database.UploadEntry) error {
+	for _, version := range upload.Versions {
+		if err := deleteObjectKey(version.StorageKey); err != nil {
+			return err
+		}
+	}
+	return deleteObjectKey(upload.ObjectKey())
+}
+
+func deleteObjectKey(storageKey string) error {
+	tracked, last, err := database.ReleaseObject(storageKey)
+	if err != nil {
+		return err
+	}
+	if tracked && !last {
+		return nil
+	}
+	return DeleteFileFromS3(storageKey)
+}
+
+// ApplyObjectACL brings the stored object in line with the upload's current
+// visibility. A shared object is never flipped for everyone; the upload is
+// moved onto an object with the right ACL instead.
+func ApplyObjectACL(upload *database.UploadEntry) error {
+	public := !upload.StoredPrivately()
+
+	object, err := database.GetObject(upload.ObjectKey())
+	if err != nil {
+		return SetFileACL(upload.ObjectKey(), public)
+	}
+
+	if object.Refs <= 1 {
+		if err := SetFileACL(upload.ObjectKey(), public); err != nil {
+			return err
+		}
+		return database.SetObjectPublic(upload.ObjectKey(), public)
+	}
+
+	oldKey := upload.ObjectKey()
+	// The data key belongs to the object, so it moves with the upload.
+	if target, err := database.AcquireObject(upload.Hash, public); err == nil {
+		upload.StorageKey = target.StorageKey
+		upload.Encryption = target.Encryption
+	} else {
+		newKey := NewID(IDStorage) + path.Ext(upload.FileName)
+		if err := CopyFileInS3(oldKey, newKey, public); err != nil {
+			return err
+		}
+		err := database.RegisterObject(database.StoredObject{
+			StorageKey: newKey,
+			Hash:       upload.Hash,
+			Public:     public,
+			Size:       object.Size,
+			Encryption: object.Encryption,
+		})
+		if err != nil {
+			return err
+		}
+		upload.StorageKey = newKey
+		upload.Encryption = object.Encryption
+	}
+
+	if err := database.UpdateUploadObject(upload.ID, upload.StorageKey, upload.Encryption); err != nil {
+		return err
+	}
+
+	_, _, err = database.ReleaseObject(oldKey)
+	return err
+}
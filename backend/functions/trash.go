@@ -0,0 +1,146 @@
+package functions
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/database"
+)
+
+const trashPurgeInterval = time.Hour
+
+// ErrTrashExpired is returned when restoring an item whose retention window
+// has passed; the purger is about to delete it, or already is.
+var ErrTrashExpired = errors.New("trash retention has passed")
+
+// TrashEnabled reports whether deletes go to the trash rather than being
+// permanent straight away.
+func TrashEnabled() bool {
+	return config.AppConfigInstance.Trash_RetentionDays > 0
+}
+
+// TrashExpiry is when an item trashed at deletedAt will be purged.
+func TrashExpiry(deletedAt time.Time) time.Time {
+	return deletedAt.AddDate(0, 0, config.AppConfigInstance.Trash_RetentionDays)
+}
+
+// TrashExpired reports whether an item trashed at deletedAt is due to be
+// purged. Nothing expires while the trash is disabled, as nothing is purged.
+func TrashExpired(deletedAt time.Time) bool {
+	return TrashEnabled() && !TrashExpiry(deletedAt).After(time.Now())
+}
+
+// TrashUpload moves an upload to the trash and withdraws the public ACL on its
+// object so the bucket URL stops serving it too.
+func TrashUpload(upload *database.UploadEntry) error {
+	wasPrivate := upload.StoredPrivately()
+	now := time.Now()
+
+	if err := database.TrashUpload(upload.ID, now); err != nil {
+		return err
+	}
+	upload.DeletedAt = &now
+
+	if !wasPrivate {
+		if err := ApplyObjectACL(upload); err != nil {
+			log.Printf("Error hiding trashed upload %s: %v", upload.FileName, err)
+		}
+	}
+	return nil
+}
+
+// RestoreUpload takes an upload out of the trash and puts its ACL back. It
+// returns ErrTrashExpired once the upload is due to be purged.
+func RestoreUpload(upload *database.UploadEntry) error {
+	if upload.DeletedAt != nil && TrashExpired(*upload.DeletedAt) {
+		return ErrTrashExpired
+	}
+	if err := database.RestoreUpload(upload.ID); err != nil {
+		return err
+	}
+	upload.DeletedAt = nil
+
+	if !upload.StoredPrivately() {
+		return ApplyObjectACL(upload)
+	}
+	return nil
+}
+
+// PurgeUpload permanently removes an upload: its record, album membership,
+// quota usage and, once no other upload references it, the stored object.
+// The object is queued in the storage outbox in the same transaction that
+// deletes the record, so it is never left behind or deleted too early.
+func PurgeUpload(id primitive.ObjectID) (database.UploadEntry, error) {
+	entry, err := database.PurgeUpload(id)
+	if err != nil {
+		return entry, err
+	}
+	KickOutbox()
+
+	if err := database.AdjustUsage(entry.Key, -entry.StoredBytes(), -1); err != nil {
+		log.Printf("Error releasing usage for %s: %v", entry.Key, err)
+	}
+
+	if err := database.RemoveUploadFromAlbums(entry.ID); err != nil {
+		log.Printf("Error removing %s from albums: %v", entry.FileName, err)
+	}
+
+	if err := database.DeleteUploadRedirects(entry.ID); err != nil {
+		log.Printf("Error removing redirects to %s: %v", entry.FileName, err)
+	}
+
+	return entry, nil
+}
+
+// PurgeExpiredTrash hard-deletes everything whose retention window has passed.
+func PurgeExpiredTrash() (int, error) {
+	cutoff := time.Now().AddDate(0, 0, -config.AppConfigInstance.Trash_RetentionDays)
+	purged := 0
+
+	for {
+		uploads, err := database.LoadExpiredTrash(cutoff, 100)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, upload := range uploads {
+			if _, err := PurgeUpload(upload.ID); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+
+		if len(uploads) < 100 {
+			break
+		}
+	}
+
+	urls, err := database.DeleteExpiredTrashedURLs(cutoff)
+	return purged + int(urls), err
+}
+
+// StartTrashPurger runs PurgeExpiredTrash in the background on a fixed
+// interval for as long as the process lives.
+func StartTrashPurger() {
+	if !TrashEnabled() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := PurgeExpiredTrash()
+			if err != nil {
+				log.Printf("Error purging trash: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired items from the trash", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
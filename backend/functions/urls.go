@@ -1,16 +1,22 @@
 package functions
 
 import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"tritan.dev/image-uploader/database"
 )
 
 type URL struct {
-	Key       string `bson:"key"`
-	URL       string `bson:"url"`
-	CreatedAt string `bson:"created_at"`
-	IP        string `bson:"ip"`
-	Slug      string `bson:"slug"`
-	Clicks    int    `bson:"clicks"`
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Key       string             `bson:"key"`
+	URL       string             `bson:"url"`
+	CreatedAt time.Time          `bson:"created_at"`
+	IP        string             `bson:"ip"`
+	Slug      string             `bson:"slug"`
+	Clicks    int                `bson:"clicks"`
+	Domain    string             `bson:"domain,omitempty"`
+	DeletedAt *time.Time         `bson:"deleted_at,omitempty"`
 }
 
 func LoadURLsFromDB() ([]URL, error) {
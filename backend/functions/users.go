@@ -0,0 +1,38 @@
+package functions
+
+import (
+	"time"
+
+	"tritan.dev/image-uploader/database"
+)
+
+const defaultUserDomain = "i.tritan.gg"
+
+// CreateUser saves a new user under a fresh API key. An empty domain gets the
+// default one.
+func CreateUser(displayName, ip, domain string, admin bool) (database.User, error) {
+	if domain == "" {
+		domain = defaultUserDomain
+	}
+
+	user := database.User{
+		Admin:       admin,
+		DisplayName: displayName,
+		CreatedAt:   time.Now(),
+		IP:          ip,
+		Domain:      domain,
+	}
+
+	_, err := WithUniqueID(IDAPIKey, func(key string) error {
+		user.Key = key
+		return database.SaveUserToDB(user)
+	})
+	return user, err
+}
+
+// RerollUserKey moves a user and everything they own to a fresh API key.
+func RerollUserKey(key string) (string, error) {
+	return WithUniqueID(IDAPIKey, func(newKey string) error {
+		return database.UpdateUserKey(key, newKey)
+	})
+}
@@ -0,0 +1,151 @@
+package functions
+
+import (
+	"io"
+	"log"
+	"time"
+
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/database"
+)
+
+// ReplaceUploadContent stores body as a new version of upload under the same
+// public name. The previous content is kept as a private version, and the
+// oldest versions beyond Upload_MaxVersions are deleted. It returns how many
+// bytes the pruned versions freed.
+func ReplaceUploadContent(upload *database.UploadEntry, body io.ReadSeeker, size int64, hash, originalName string, opts S3ObjectOptions) (int64, error) {
+	previous := upload.CurrentVersionInfo()
+	previousVersion := upload.CurrentVersion()
+
+	// Each version gets its own bucket key from PutUploadObject; the public
+	// name stays the same because pages and raw links resolve through the
+	// upload record.
+	staged := *upload
+	staged.StorageKey = ""
+	staged.Hash = hash
+	staged.Metadata.FileSize = size
+	staged.Encryption = nil
+	if err := PutUploadObject(body, &staged, opts); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	updated := *upload
+	updated.StorageKey = staged.ObjectKey()
+	updated.Hash = hash
+	updated.Metadata.FileSize = size
+	updated.OriginalName = originalName
+	updated.Encryption = staged.Encryption
+	updated.Version = latestVersion(*upload) + 1
+	updated.VersionedAt = &now
+	updated.Versions = append(append([]database.UploadVersion{}, upload.Versions...), previous)
+
+	pruned := pruneVersions(&updated)
+
+	if err := database.SetUploadContent(updated, previousVersion); err != nil {
+		if err := deleteObjectKey(staged.ObjectKey()); err != nil {
+			log.Printf("Error removing staged version of %s: %v", upload.FileName, err)
+		}
+		return 0, err
+	}
+
+	hideVersionObject(previous.StorageKey)
+	*upload = updated
+	return deletePrunedVersions(upload.FileName, pruned), nil
+}
+
+// RollbackUpload makes version the current content again. The content it
+// replaces becomes a version in turn, so a rollback can itself be undone.
+func RollbackUpload(upload *database.UploadEntry, version int) error {
+	target, ok := upload.AtVersion(version)
+	if !ok || target.ShownVersion == 0 {
+		return database.ErrVersionConflict
+	}
+
+	previous := upload.CurrentVersionInfo()
+	previousVersion := upload.CurrentVersion()
+
+	now := time.Now()
+	updated := *upload
+	updated.StorageKey = target.StorageKey
+	updated.Hash = target.Hash
+	updated.Metadata.FileSize = target.Metadata.FileSize
+	updated.OriginalName = target.OriginalName
+	updated.Encryption = target.Encryption
+	updated.Version = version
+	updated.VersionedAt = &now
+	updated.Versions = []database.UploadVersion{}
+	for _, v := range upload.Versions {
+		if v.Version != version {
+			updated.Versions = append(updated.Versions, v)
+		}
+	}
+	updated.Versions = append(updated.Versions, previous)
+
+	if err := database.SetUploadContent(updated, previousVersion); err != nil {
+		return err
+	}
+
+	hideVersionObject(previous.StorageKey)
+	*upload = updated
+
+	if !upload.StoredPrivately() {
+		return ApplyObjectACL(upload)
+	}
+	return nil
+}
+
+// latestVersion is the highest version number the upload has used, so a
+// new version never reuses the number of one that was rolled back.
+func latestVersion(upload database.UploadEntry) int {
+	latest := upload.CurrentVersion()
+	for _, v := range upload.Versions {
+		if v.Version > latest {
+			latest = v.Version
+		}
+	}
+	return latest
+}
+
+// pruneVersions drops the oldest kept versions beyond Upload_MaxVersions and
+// returns them so their objects can be deleted once the record is saved.
+func pruneVersions(upload *database.UploadEntry) []database.UploadVersion {
+	limit := config.AppConfigInstance.Upload_MaxVersions
+	if limit <= 0 || len(upload.Versions) <= limit {
+		return nil
+	}
+
+	excess := len(upload.Versions) - limit
+	pruned := upload.Versions[:excess]
+	upload.Versions = upload.Versions[excess:]
+	return pruned
+}
+
+func deletePrunedVersions(fileName string, pruned []database.UploadVersion) int64 {
+	freed := int64(0)
+	for _, v := range pruned {
+		if err := deleteObjectKey(v.StorageKey); err != nil {
+			log.Printf("Error deleting version %d of %s: %v", v.Version, fileName, err)
+		}
+		freed += v.FileSize
+	}
+	return freed
+}
+
+// hideVersionObject withdraws the public ACL from content that is no longer
+// current, since earlier versions are only served through the raw proxy. A
+// shared object is left alone as other uploads still serve it.
+func hideVersionObject(storageKey string) {
+	if object, err := database.GetObject(storageKey); err == nil {
+		if object.Refs > 1 || !object.Public {
+			return
+		}
+		if err := database.SetObjectPublic(storageKey, false); err != nil {
+			log.Printf("Error updating object %s: %v", storageKey, err)
+		}
+	}
+
+	if err := SetFileACL(storageKey, false); err != nil {
+		log.Printf("Error hiding earlier version %s: %v", storageKey, err)
+	}
+}
@@ -0,0 +1,159 @@
+package functions
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/database"
+)
+
+// versioned is an upload at version current that kept the given versions.
+func versioned(current int, kept ...int) database.UploadEntry {
+	upload := database.UploadEntry{ID: primitive.NewObjectID(), FileName: "a.png", Version: current, StorageKey: "key-current"}
+	upload.Metadata.FileSize = 10
+	for _, v := range kept {
+		upload.Versions = append(upload.Versions, database.UploadVersion{
+			Version:    v,
+			StorageKey: "key-" + strconv.Itoa(v),
+			FileSize:   int64(v),
+		})
+	}
+	return upload
+}
+
+func versionNumbers(versions []database.UploadVersion) []int {
+	numbers := []int{}
+	for _, v := range versions {
+		numbers = append(numbers, v.Version)
+	}
+	return numbers
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPruneVersions(t *testing.T) {
+	previous := config.AppConfigInstance.Upload_MaxVersions
+	t.Cleanup(func() { config.AppConfigInstance.Upload_MaxVersions = previous })
+
+	tests := []struct {
+		name   string
+		limit  int
+		kept   []int
+		remain []int
+		pruned []int
+	}{
+		{"no limit", 0, []int{1, 2, 3}, []int{1, 2, 3}, []int{}},
+		{"under the limit", 5, []int{1, 2, 3}, []int{1, 2, 3}, []int{}},
+		{"at the limit", 3, []int{1, 2, 3}, []int{1, 2, 3}, []int{}},
+		{"oldest dropped first", 2, []int{1, 2, 3, 4}, []int{3, 4}, []int{1, 2}},
+		{"order of keeping, not number", 1, []int{5, 2}, []int{2}, []int{5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AppConfigInstance.Upload_MaxVersions = tt.limit
+			upload := versioned(len(tt.kept)+1, tt.kept...)
+
+			pruned := pruneVersions(&upload)
+			if got := versionNumbers(upload.Versions); !equalInts(got, tt.remain) {
+				t.Errorf("kept %v, want %v", got, tt.remain)
+			}
+			if got := versionNumbers(pruned); !equalInts(got, tt.pruned) {
+				t.Errorf("pruned %v, want %v", got, tt.pruned)
+			}
+		})
+	}
+}
+
+func TestLatestVersion(t *testing.T) {
+	tests := []struct {
+		name   string
+		upload database.UploadEntry
+		want   int
+	}{
+		{"never replaced", versioned(0), 1},
+		{"current is newest", versioned(3, 1, 2), 3},
+		{"rolled back", versioned(2, 1, 4, 3), 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := latestVersion(tt.upload); got != tt.want {
+				t.Errorf("latestVersion = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollbackUpload(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("unknown version", func(mt *mtest.T) {
+		database.Use(mt.Client)
+		upload := versioned(3, 1, 2)
+		for _, version := range []int{3, 4} {
+			if err := RollbackUpload(&upload, version); !errors.Is(err, database.ErrVersionConflict) {
+				mt.Errorf("rollback to %d: err = %v, want ErrVersionConflict", version, err)
+			}
+		}
+		if started := mt.GetStartedEvent(); started != nil {
+			mt.Errorf("sent %s for a version that does not exist", started.CommandName)
+		}
+	})
+
+	mt.Run("changed concurrently", func(mt *mtest.T) {
+		database.Use(mt.Client)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+
+		upload := versioned(3, 1, 2)
+		if err := RollbackUpload(&upload, 1); !errors.Is(err, database.ErrVersionConflict) {
+			mt.Fatalf("err = %v, want ErrVersionConflict", err)
+		}
+		if upload.Version != 3 || upload.StorageKey != "key-current" {
+			mt.Error("upload was changed although the update did not apply")
+		}
+
+		started := mt.GetStartedEvent()
+		if started == nil || started.CommandName != "update" {
+			mt.Fatalf("expected an update command, got %v", started)
+		}
+		statement := started.Command.Lookup("updates", "0").Document()
+
+		// The update only applies to the version the rollback started from.
+		if version, ok := statement.Lookup("q", "version").AsInt64OK(); !ok || version != 3 {
+			mt.Errorf("filter version = %v, want 3", statement.Lookup("q", "version"))
+		}
+
+		// Version 1 becomes current and the replaced content is kept in its
+		// place, so the rollback can itself be undone.
+		set := statement.Lookup("u", "$set").Document()
+		if version, _ := set.Lookup("version").AsInt64OK(); version != 1 {
+			mt.Errorf("set version = %d, want 1", version)
+		}
+		if key := set.Lookup("storage_key").StringValue(); key != "key-1" {
+			mt.Errorf("set storage_key = %q, want key-1", key)
+		}
+		var kept []database.UploadVersion
+		if err := set.Lookup("versions").Unmarshal(&kept); err != nil {
+			mt.Fatal(err)
+		}
+		if got := versionNumbers(kept); !equalInts(got, []int{2, 3}) {
+			mt.Errorf("kept versions %v, want [2 3]", got)
+		}
+	})
+}
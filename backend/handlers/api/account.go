@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"log"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"tritan.dev/image-uploader/constants"
@@ -10,32 +9,27 @@ import (
 	"tritan.dev/image-uploader/functions"
 )
 
-func errorResponse(c *fiber.Ctx, status int, message string) error {
-	return c.Status(status).JSON(fiber.Map{
-		"status":  status,
-		"message": message,
-	})
-}
-
 func GetAccountDataByKey(c *fiber.Ctx) error {
 	apiKey := c.Get("key")
 	if apiKey == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageAPIKeyRequired)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
 	}
 
 	user, err := database.GetUserByKey(apiKey)
 	if err != nil {
-		return errorResponse(c, constants.StatusNotFound, constants.MessageUserNotFound)
+		return errorResponse(c, constants.StatusNotFound, constants.CodeUserNotFound, constants.MessageUserNotFound)
 	}
 
 	user.IP = "[Redacted]"
+	quota := functions.EffectiveLimits(user)
+	user.Quota = &quota
 
 	return c.JSON(user)
 }
 
 func changeDisplayName(c *fiber.Ctx, apiKey string) error {
 	if apiKey == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageAPIKeyRequired)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
 	}
 
 	var updateData struct {
@@ -43,12 +37,12 @@ func changeDisplayName(c *fiber.Ctx, apiKey string) error {
 	}
 
 	if err := c.BodyParser(&updateData); err != nil {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageInvalidPayload)
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidPayload, constants.MessageInvalidPayload)
 	}
 
 	err := database.UpdateUserDisplayName(apiKey, updateData.DisplayName)
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedUpdateName)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedUpdateName, constants.MessageFailedUpdateName)
 	}
 
 	return c.SendStatus(constants.StatusNoContent)
@@ -56,62 +50,31 @@ func changeDisplayName(c *fiber.Ctx, apiKey string) error {
 
 func deleteAccountByKey(c *fiber.Ctx, apiKey string) error {
 	if apiKey == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageAPIKeyRequired)
-	}
-
-	uploads, err := database.LoadUploadsFromDB(apiKey)
-	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedFetchUploads)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
 	}
 
-	for _, upload := range uploads {
-		if err := functions.DeleteFileFromS3(upload.FileName); err != nil {
-			log.Printf("Error deleting file from S3: %v", err)
-			return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedDelete)
-		}
+	if _, err := database.GetUserByKey(apiKey); err != nil {
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
 	}
 
-	err = database.DeleteUserByKey(apiKey)
-	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedDelete)
-	}
-
-	return c.SendStatus(constants.StatusNoContent)
+	return enqueueJob(c, functions.JobDeleteAccount, apiKey, map[string]string{"key": apiKey})
 }
 
 func PostNewAccount(c *fiber.Ctx) error {
-	ip := c.Get("x-forwarded-for")
-	if ip == "" {
-		ip = c.IP()
-	}
+	ip := c.IP()
 
 	var userRequest struct {
 		DisplayName string `json:"display_name"`
 	}
 
 	if err := c.BodyParser(&userRequest); err != nil {
-		return c.Status(constants.StatusBadRequest).JSON(fiber.Map{
-			"status":  constants.StatusBadRequest,
-			"message": "Invalid request body",
-		})
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequestBody, constants.MessageInvalidRequestBody)
 	}
 
-	newUser := database.User{
-		Key:         functions.GenerateAPIKey(20),
-		Admin:       false,
-		DisplayName: userRequest.DisplayName,
-		CreatedAt:   time.Now().Format(time.RFC3339),
-		IP:          ip,
-		Domain:      "i.tritan.gg",
-	}
-
-	if err := database.SaveUserToDB(newUser); err != nil {
+	newUser, err := functions.CreateUser(userRequest.DisplayName, ip, "", false)
+	if err != nil {
 		log.Printf("Failed to save user: %v\n", err)
-		return c.Status(constants.StatusInternalServerError).JSON(fiber.Map{
-			"status":  constants.StatusInternalServerError,
-			"message": constants.MessageFailedCreateUser,
-			"error":   err.Error(),
-		})
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedCreateUser, constants.MessageFailedCreateUser)
 	}
 
 	return c.JSON(fiber.Map{
@@ -122,10 +85,9 @@ func PostNewAccount(c *fiber.Ctx) error {
 }
 
 func regenerateToken(c *fiber.Ctx, apiKey string) error {
-	newKey := functions.GenerateAPIKey(20)
-	err := database.UpdateUserKey(apiKey, newKey)
+	newKey, err := functions.RerollUserKey(apiKey)
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedRegenToken)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedRegenToken, constants.MessageFailedRegenToken)
 	}
 
 	return c.JSON(fiber.Map{
@@ -137,7 +99,20 @@ func regenerateToken(c *fiber.Ctx, apiKey string) error {
 func updateDomain(c *fiber.Ctx, apiKey string, domain string) error {
 	err := database.UpdateUserDomain(apiKey, domain)
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedUpdateDomain)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedUpdateDomain, constants.MessageFailedUpdateDomain)
+	}
+
+	return c.SendStatus(constants.StatusNoContent)
+}
+
+func updateNameStyle(c *fiber.Ctx, apiKey string, style string) error {
+	if !functions.ValidNameStyle(style) {
+		return validationError(c, constants.CodeInvalidNameStyle, constants.MessageInvalidNameStyle, invalidField("value"))
+	}
+
+	err := database.UpdateUserNameStyle(apiKey, style)
+	if err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedUpdateNameStyle, constants.MessageFailedUpdateNameStyle)
 	}
 
 	return c.SendStatus(constants.StatusNoContent)
@@ -149,7 +124,7 @@ func PutAccountDetailsByKey(c *fiber.Ctx) error {
 	value := c.Query("value")
 
 	if apiKey == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageAPIKeyRequired)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
 	}
 
 	switch queryType {
@@ -159,9 +134,11 @@ func PutAccountDetailsByKey(c *fiber.Ctx) error {
 		return updateDomain(c, apiKey, value)
 	case "name":
 		return changeDisplayName(c, apiKey)
+	case "name-style":
+		return updateNameStyle(c, apiKey, value)
 	case "delete":
 		return deleteAccountByKey(c, apiKey)
 	default:
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageInvalidRequestType)
+		return validationError(c, constants.CodeInvalidRequestType, constants.MessageInvalidRequestType, invalidField("type"))
 	}
 }
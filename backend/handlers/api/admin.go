@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"math"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"tritan.dev/image-uploader/constants"
 	"tritan.dev/image-uploader/database"
 	"tritan.dev/image-uploader/functions"
@@ -13,18 +17,18 @@ import (
 func requireAdmin(c *fiber.Ctx) (database.User, bool) {
 	apiKey := c.Get("key")
 	if apiKey == "" {
-		_ = errorResponse(c, constants.StatusUnauthorized, constants.MessageAPIKeyRequired)
+		_ = errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
 		return database.User{}, false
 	}
 
 	requestingUser, err := database.GetUserByKey(apiKey)
 	if err != nil {
-		_ = errorResponse(c, constants.StatusUnauthorized, constants.MessageInvalidKey)
+		_ = errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
 		return database.User{}, false
 	}
 
 	if !requestingUser.Admin {
-		_ = errorResponse(c, constants.StatusForbidden, constants.MessageForbidden)
+		_ = errorResponse(c, constants.StatusForbidden, constants.CodeForbidden, constants.MessageForbidden)
 		return database.User{}, false
 	}
 
@@ -38,7 +42,7 @@ func getPagination(c *fiber.Ctx) (int64, int64, error) {
 	if rawPage := c.Query("page"); rawPage != "" {
 		parsedPage, err := strconv.Atoi(rawPage)
 		if err != nil || parsedPage < 1 {
-			return 0, 0, fiber.NewError(constants.StatusBadRequest, constants.MessageInvalidRequest)
+			return 0, 0, invalidField("page")
 		}
 		page = int64(parsedPage)
 	}
@@ -46,7 +50,7 @@ func getPagination(c *fiber.Ctx) (int64, int64, error) {
 	if rawLimit := c.Query("limit"); rawLimit != "" {
 		parsedLimit, err := strconv.Atoi(rawLimit)
 		if err != nil || parsedLimit < 1 {
-			return 0, 0, fiber.NewError(constants.StatusBadRequest, constants.MessageInvalidRequest)
+			return 0, 0, invalidField("limit")
 		}
 		if parsedLimit > 100 {
 			parsedLimit = 100
@@ -64,13 +68,13 @@ func GetAdminUsers(c *fiber.Ctx) error {
 
 	page, limit, err := getPagination(c)
 	if err != nil {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageInvalidRequest)
+		return invalidQuery(c, err)
 	}
 	query := c.Query("q")
 
 	users, total, err := database.LoadUsersPaginated(page, limit, query)
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedLoadUsers)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedLoadUsers, constants.MessageFailedLoadUsers)
 	}
 
 	totalPages := int(math.Ceil(float64(total) / float64(limit)))
@@ -97,13 +101,13 @@ func GetAdminRecentUploads(c *fiber.Ctx) error {
 
 	page, limit, err := getPagination(c)
 	if err != nil {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageInvalidRequest)
+		return invalidQuery(c, err)
 	}
 	query := c.Query("q")
 
 	uploads, total, err := database.LoadRecentUploadsPaginated(page, limit, query)
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedFetchUploads)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedFetchUploads, constants.MessageFailedFetchUploads)
 	}
 
 	totalPages := int(math.Ceil(float64(total) / float64(limit)))
@@ -130,18 +134,18 @@ func GetAdminUploadsByUser(c *fiber.Ctx) error {
 
 	userKey := c.Params("key")
 	if userKey == "" {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageInvalidRequest)
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequest, constants.MessageInvalidRequest)
 	}
 
 	page, limit, err := getPagination(c)
 	if err != nil {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageInvalidRequest)
+		return invalidQuery(c, err)
 	}
 	query := c.Query("q")
 
 	uploads, total, err := database.LoadUploadsByKeyPaginated(userKey, page, limit, query)
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedFetchUploads)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedFetchUploads, constants.MessageFailedFetchUploads)
 	}
 
 	totalPages := int(math.Ceil(float64(total) / float64(limit)))
@@ -166,18 +170,22 @@ func DeleteAdminUpload(c *fiber.Ctx) error {
 		return nil
 	}
 
-	fileName := c.Params("file")
-	if fileName == "" {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageMissingUploadID)
+	rawID := pathParam(c, "id")
+	if rawID == "" {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeMissingUploadID, constants.MessageMissingUploadID)
 	}
 
-	entry, err := database.DeleteUploadByFileName(fileName)
+	// File names are only unique per domain, so admins delete by upload ID.
+	id, err := primitive.ObjectIDFromHex(rawID)
 	if err != nil {
-		return errorResponse(c, constants.StatusNotFound, constants.MessageUploadNotFound)
+		return errorResponse(c, constants.StatusNotFound, constants.CodeUploadNotFound, constants.MessageUploadNotFound)
 	}
 
-	if err := functions.DeleteFileFromS3(entry.FileName); err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageUploadError)
+	if _, err := functions.PurgeUpload(id); errors.Is(err, mongo.ErrNoDocuments) {
+		return errorResponse(c, constants.StatusNotFound, constants.CodeUploadNotFound, constants.MessageUploadNotFound)
+	} else if err != nil {
+		log.Printf("Error deleting upload %s: %v\n", rawID, err)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeUploadError, constants.MessageUploadError)
 	}
 
 	return c.JSON(fiber.Map{
@@ -194,111 +202,186 @@ func DeleteAdminUser(c *fiber.Ctx) error {
 
 	userKey := c.Params("key")
 	if userKey == "" {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageInvalidRequest)
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequest, constants.MessageInvalidRequest)
 	}
 	if userKey == adminUser.Key {
-		return errorResponse(c, constants.StatusBadRequest, "Admins cannot delete their own account from admin API")
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeCannotDeleteSelf, constants.MessageCannotDeleteSelf)
 	}
 
-	uploads, err := database.LoadUploadsFromDB(userKey)
-	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedFetchUploads)
+	return enqueueJob(c, functions.JobDeleteAccount, adminUser.Key, map[string]string{"key": userKey})
+}
+
+func DeleteAdminUserUploads(c *fiber.Ctx) error {
+	adminUser, ok := requireAdmin(c)
+	if !ok {
+		return nil
 	}
 
-	for _, upload := range uploads {
-		if err := functions.DeleteFileFromS3(upload.FileName); err != nil {
-			return errorResponse(c, constants.StatusInternalServerError, constants.MessageUploadError)
-		}
+	userKey := c.Params("key")
+	if userKey == "" {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequest, constants.MessageInvalidRequest)
+	}
+
+	return enqueueJob(c, functions.JobDeleteUserUploads, adminUser.Key, map[string]string{"key": userKey})
+}
+
+func UpdateAdminUserDisplayName(c *fiber.Ctx) error {
+	if _, ok := requireAdmin(c); !ok {
+		return nil
+	}
+
+	userKey := c.Params("key")
+	if userKey == "" {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequest, constants.MessageInvalidRequest)
+	}
+
+	var payload struct {
+		DisplayName string `json:"display_name"`
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidPayload, constants.MessageInvalidPayload)
+	}
+	if payload.DisplayName == "" {
+		return validationError(c, constants.CodeInvalidPayload, constants.MessageInvalidPayload, requiredField("display_name"))
 	}
 
-	if err := database.DeleteUserByKey(userKey); err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedDelete)
+	if err := database.UpdateUserDisplayName(userKey, payload.DisplayName); err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedUpdateName, constants.MessageFailedUpdateName)
 	}
 
 	return c.JSON(fiber.Map{
 		"status":  constants.StatusOK,
-		"message": "User deleted successfully",
+		"message": "User display name updated",
 	})
 }
 
-func DeleteAdminUserUploads(c *fiber.Ctx) error {
+func RerollAdminUserKey(c *fiber.Ctx) error {
 	if _, ok := requireAdmin(c); !ok {
 		return nil
 	}
 
 	userKey := c.Params("key")
 	if userKey == "" {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageInvalidRequest)
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequest, constants.MessageInvalidRequest)
 	}
 
-	uploads, err := database.LoadUploadsFromDB(userKey)
+	newKey, err := functions.RerollUserKey(userKey)
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedFetchUploads)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedRegenToken, constants.MessageFailedRegenToken)
 	}
 
-	for _, upload := range uploads {
-		if err := functions.DeleteFileFromS3(upload.FileName); err != nil {
-			return errorResponse(c, constants.StatusInternalServerError, constants.MessageUploadError)
-		}
+	return c.JSON(fiber.Map{
+		"status":  constants.StatusOK,
+		"message": "User key rerolled",
+		"new_key": newKey,
+	})
+}
+
+func PostAdminRotateStorageKeys(c *fiber.Ctx) error {
+	if _, ok := requireAdmin(c); !ok {
+		return nil
 	}
 
-	deletedCount, err := database.DeleteUploadsByUserKey(userKey)
+	rotated, err := functions.RotateStorageKeys()
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedDelete)
+		c.Locals(constants.ErrorCodeLocal, constants.CodeFailedRotateKeys)
+		return c.Status(constants.StatusInternalServerError).JSON(fiber.Map{
+			"status":  constants.StatusInternalServerError,
+			"message": constants.MessageFailedRotateKeys,
+			"rotated": rotated,
+		})
 	}
 
 	return c.JSON(fiber.Map{
-		"status":        constants.StatusOK,
-		"deleted_count": deletedCount,
-		"message":       "User uploads deleted successfully",
+		"status":  constants.StatusOK,
+		"message": "Storage keys rotated",
+		"rotated": rotated,
 	})
 }
 
-func UpdateAdminUserDisplayName(c *fiber.Ctx) error {
-	if _, ok := requireAdmin(c); !ok {
+// PostAdminReconcileStorage queues a comparison of the bucket against the
+// uploads collection. It is a dry run unless ?dry_run=false is passed; the
+// report ends up in the job's result.
+func PostAdminReconcileStorage(c *fiber.Ctx) error {
+	adminUser, ok := requireAdmin(c)
+	if !ok {
 		return nil
 	}
 
-	userKey := c.Params("key")
-	if userKey == "" {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageInvalidRequest)
+	payload := map[string]string{}
+	for _, field := range []string{"dry_run", "orphans", "dangling", "fix_sizes", "import_key", "min_age"} {
+		if value := c.Query(field); value != "" {
+			payload[field] = value
+		}
 	}
-
-	var payload struct {
-		DisplayName string `json:"display_name"`
+	if _, err := functions.ParseReconcileOptions(payload); err != nil {
+		response := fiber.Map{
+			"status":  constants.StatusBadRequest,
+			"message": constants.MessageInvalidRequest,
+			"error":   err.Error(),
+		}
+		var option functions.OptionError
+		if errors.As(err, &option) {
+			response["fields"] = []fieldError{invalidField(option.Field)}
+		}
+		c.Locals(constants.ErrorCodeLocal, constants.CodeInvalidRequest)
+		return c.Status(constants.StatusBadRequest).JSON(response)
 	}
-	if err := c.BodyParser(&payload); err != nil || payload.DisplayName == "" {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageInvalidPayload)
+
+	return enqueueJob(c, functions.JobReconcileStorage, adminUser.Key, payload)
+}
+
+func GetAdminUserLimits(c *fiber.Ctx) error {
+	if _, ok := requireAdmin(c); !ok {
+		return nil
 	}
 
-	if err := database.UpdateUserDisplayName(userKey, payload.DisplayName); err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedUpdateName)
+	user, err := database.GetUserByKey(c.Params("key"))
+	if err != nil {
+		return errorResponse(c, constants.StatusNotFound, constants.CodeUserNotFound, constants.MessageUserNotFound)
 	}
 
 	return c.JSON(fiber.Map{
-		"status":  constants.StatusOK,
-		"message": "User display name updated",
+		"status":    constants.StatusOK,
+		"usage":     user.Usage,
+		"overrides": user.Limits,
+		"effective": functions.EffectiveLimits(user),
 	})
 }
 
-func RerollAdminUserKey(c *fiber.Ctx) error {
+func UpdateAdminUserLimits(c *fiber.Ctx) error {
 	if _, ok := requireAdmin(c); !ok {
 		return nil
 	}
 
 	userKey := c.Params("key")
-	if userKey == "" {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageInvalidRequest)
+	if _, err := database.GetUserByKey(userKey); err != nil {
+		return errorResponse(c, constants.StatusNotFound, constants.CodeUserNotFound, constants.MessageUserNotFound)
+	}
+
+	var limits database.UserLimits
+	if err := c.BodyParser(&limits); err != nil {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidPayload, constants.MessageInvalidPayload)
+	}
+
+	var overrides *database.UserLimits
+	if limits != (database.UserLimits{}) {
+		overrides = &limits
 	}
 
-	newKey := functions.GenerateAPIKey(20)
-	if err := database.UpdateUserKey(userKey, newKey); err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedRegenToken)
+	if err := database.UpdateUserLimits(userKey, overrides); err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedUpdateLimits, constants.MessageFailedUpdateLimits)
+	}
+
+	usage, err := database.RecalculateUsage(userKey)
+	if err != nil {
+		log.Printf("Error recalculating usage for %s: %v", userKey, err)
 	}
 
 	return c.JSON(fiber.Map{
-		"status":  constants.StatusOK,
-		"message": "User key rerolled",
-		"new_key": newKey,
+		"status":    constants.StatusOK,
+		"message":   "User limits updated",
+		"usage":     usage,
+		"overrides": overrides,
 	})
 }
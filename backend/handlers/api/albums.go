@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"tritan.dev/image-uploader/constants"
+	"tritan.dev/image-uploader/database"
+	"tritan.dev/image-uploader/functions"
+)
+
+type albumRequest struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Cover       string   `json:"cover"`
+	Files       []string `json:"files"`
+}
+
+func albumURL(user database.User, album database.Album) string {
+	return fmt.Sprintf("https://%s/a/%s", user.Domain, album.ID)
+}
+
+// requireOwnedAlbum resolves the :id album and checks it belongs to the
+// caller's key, writing the error response itself when it does not.
+func requireOwnedAlbum(c *fiber.Ctx) (database.User, database.Album, bool) {
+	key := c.Get("key")
+	if key == "" {
+		_ = errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
+		return database.User{}, database.Album{}, false
+	}
+
+	user, err := database.GetUserByKey(key)
+	if err != nil {
+		_ = errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
+		return database.User{}, database.Album{}, false
+	}
+
+	album, err := database.GetAlbumByID(c.Params("id"))
+	if err != nil {
+		_ = errorResponse(c, constants.StatusNotFound, constants.CodeAlbumNotFound, constants.MessageAlbumNotFound)
+		return database.User{}, database.Album{}, false
+	}
+
+	if album.Key != key {
+		_ = errorResponse(c, constants.StatusForbidden, constants.CodeForbidden, constants.MessageForbidden)
+		return database.User{}, database.Album{}, false
+	}
+
+	return user, album, true
+}
+
+// resolveOwnedFiles maps upload references (IDs, or names with or without
+// extension) to the IDs of uploads owned by key, rejecting any that are
+// missing or foreign. Albums store the IDs.
+func resolveOwnedFiles(key string, refs []string) ([]string, error) {
+	ids := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		upload, err := findUpload(ref, key)
+		if err != nil || upload.Key != key {
+			return nil, fmt.Errorf("upload %q not found", ref)
+		}
+		ids = append(ids, upload.ID.Hex())
+	}
+	return ids, nil
+}
+
+func GetAlbums(c *fiber.Ctx) error {
+	key := c.Get("key")
+	if key == "" {
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
+	}
+
+	if _, err := database.GetUserByKey(key); err != nil {
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
+	}
+
+	albums, err := database.LoadAlbumsByKey(key)
+	if err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedLoadAlbums, constants.MessageFailedLoadAlbums)
+	}
+
+	for i := range albums {
+		albums[i].Key = "[Redacted]"
+	}
+
+	return c.JSON(fiber.Map{
+		"status": constants.StatusOK,
+		"albums": albums,
+	})
+}
+
+func PostAlbum(c *fiber.Ctx) error {
+	key := c.Get("key")
+	if key == "" {
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
+	}
+
+	user, err := database.GetUserByKey(key)
+	if err != nil {
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
+	}
+
+	var req albumRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequestBody, constants.MessageInvalidRequestBody)
+	}
+
+	if req.Title == "" {
+		return validationError(c, constants.CodeAlbumTitleRequired, constants.MessageAlbumTitleRequired, requiredField("title"))
+	}
+
+	files, err := resolveOwnedFiles(key, req.Files)
+	if err != nil {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeUploadNotFound, constants.MessageUploadNotFound)
+	}
+
+	album, err := createAlbum(user, req.Title, req.Description, files)
+	if err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedSaveAlbum, constants.MessageFailedSaveAlbum)
+	}
+
+	return c.JSON(fiber.Map{
+		"status": constants.StatusOK,
+		"album":  album,
+		"url":    albumURL(user, album),
+	})
+}
+
+func createAlbum(user database.User, title, description string, files []string) (database.Album, error) {
+	album := database.Album{
+		Key:         user.Key,
+		Title:       title,
+		Description: description,
+		Files:       files,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if len(files) > 0 {
+		album.Cover = files[0]
+	}
+
+	_, err := functions.WithUniqueID(functions.IDAlbum, func(id string) error {
+		album.ID = id
+		return database.SaveAlbumToDB(album)
+	})
+	if err != nil {
+		return database.Album{}, err
+	}
+	return album, nil
+}
+
+func GetAlbum(c *fiber.Ctx) error {
+	user, album, ok := requireOwnedAlbum(c)
+	if !ok {
+		return nil
+	}
+
+	uploads, err := database.LoadUploadsByIDs(album.Files)
+	if err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedFetchUploads, constants.MessageFailedFetchUploads)
+	}
+
+	for i := range uploads {
+		uploads[i].IP = "[Redacted]"
+		uploads[i].Key = "[Redacted]"
+	}
+	album.Key = "[Redacted]"
+
+	return c.JSON(fiber.Map{
+		"status":  constants.StatusOK,
+		"album":   album,
+		"uploads": uploads,
+		"url":     albumURL(user, album),
+	})
+}
+
+func PutAlbum(c *fiber.Ctx) error {
+	_, album, ok := requireOwnedAlbum(c)
+	if !ok {
+		return nil
+	}
+
+	var req database.AlbumDetails
+	if err := c.BodyParser(&req); err != nil {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequestBody, constants.MessageInvalidRequestBody)
+	}
+
+	if req.Title != nil && *req.Title == "" {
+		return validationError(c, constants.CodeAlbumTitleRequired, constants.MessageAlbumTitleRequired, requiredField("title"))
+	}
+
+	if req.Cover != nil && *req.Cover != "" {
+		covers, err := resolveOwnedFiles(album.Key, []string{*req.Cover})
+		if err != nil || !slices.Contains(album.Files, covers[0]) {
+			return validationError(c, constants.CodeInvalidAlbumCover, constants.MessageInvalidAlbumCover, invalidField("cover"))
+		}
+		req.Cover = &covers[0]
+	}
+
+	if err := database.UpdateAlbumDetails(album.ID, req); err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedSaveAlbum, constants.MessageFailedSaveAlbum)
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  constants.StatusOK,
+		"message": "Album updated successfully",
+	})
+}
+
+func DeleteAlbum(c *fiber.Ctx) error {
+	_, album, ok := requireOwnedAlbum(c)
+	if !ok {
+		return nil
+	}
+
+	if err := database.DeleteAlbumFromDB(album.ID); err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedSaveAlbum, constants.MessageFailedSaveAlbum)
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  constants.StatusOK,
+		"message": "Album deleted successfully",
+	})
+}
+
+func PostAlbumUploads(c *fiber.Ctx) error {
+	_, album, ok := requireOwnedAlbum(c)
+	if !ok {
+		return nil
+	}
+
+	var req albumRequest
+	if err := c.BodyParser(&req); err != nil || len(req.Files) == 0 {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequestBody, constants.MessageInvalidRequestBody)
+	}
+
+	files, err := resolveOwnedFiles(album.Key, req.Files)
+	if err != nil {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeUploadNotFound, constants.MessageUploadNotFound)
+	}
+
+	if err := database.AddFilesToAlbum(album.ID, files); err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedSaveAlbum, constants.MessageFailedSaveAlbum)
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  constants.StatusOK,
+		"message": "Uploads added to album",
+	})
+}
+
+func DeleteAlbumUpload(c *fiber.Ctx) error {
+	_, album, ok := requireOwnedAlbum(c)
+	if !ok {
+		return nil
+	}
+
+	files, err := resolveOwnedFiles(album.Key, []string{pathParam(c, "upload")})
+	if err != nil || !slices.Contains(album.Files, files[0]) {
+		return errorResponse(c, constants.StatusNotFound, constants.CodeUploadNotFound, constants.MessageUploadNotFound)
+	}
+
+	if err := database.RemoveFileFromAlbum(album.ID, files[0]); err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedSaveAlbum, constants.MessageFailedSaveAlbum)
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  constants.StatusOK,
+		"message": "Upload removed from album",
+	})
+}
+
+func PutAlbumOrder(c *fiber.Ctx) error {
+	_, album, ok := requireOwnedAlbum(c)
+	if !ok {
+		return nil
+	}
+
+	var req albumRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequestBody, constants.MessageInvalidRequestBody)
+	}
+
+	files, err := resolveOwnedFiles(album.Key, req.Files)
+	if err != nil || !samePermutation(files, album.Files) {
+		return validationError(c, constants.CodeInvalidAlbumOrder, constants.MessageInvalidAlbumOrder, invalidField("files"))
+	}
+
+	if err := database.SetAlbumOrder(album.ID, files); err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedSaveAlbum, constants.MessageFailedSaveAlbum)
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  constants.StatusOK,
+		"message": "Album reordered",
+		"files":   files,
+	})
+}
+
+func samePermutation(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	counts := make(map[string]int, len(a))
+	for _, v := range a {
+		counts[v]++
+	}
+	for _, v := range b {
+		if counts[v] == 0 {
+			return false
+		}
+		counts[v]--
+	}
+	return true
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"log"
+
 	"github.com/gofiber/fiber/v2"
 	"tritan.dev/image-uploader/constants"
 	"tritan.dev/image-uploader/database"
@@ -10,40 +12,40 @@ import (
 func PostShareXConfig(c *fiber.Ctx) error {
 	key := c.Get("key")
 	if key == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageAPIKeyRequired)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
 	}
 
 	validUsers, err := database.LoadUsersFromDB()
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, "Failed to load users")
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedLoadUsers, constants.MessageFailedLoadUsers)
 	}
 	queryType := c.Query("type")
 
 	if !functions.IsValidKey(key, validUsers) {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageInvalidKey)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
 	}
 
 	user, err := database.GetUserByKey(key)
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, "Failed to get user")
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedGetUser, constants.MessageFailedGetUser)
 	}
 	domain := user.Domain
 
-	if queryType == "" || !(queryType == "upload" || queryType == "url" || queryType == "text") {
-		return errorResponse(c, constants.StatusBadRequest, "The query type was invalid")
-	}
-
+	var sharexConfig functions.ShareXConfig
 	switch queryType {
 	case "upload":
-		uploadConfig := functions.GenerateUploaderConfig(key, domain)
-		functions.SendConfig(c, uploadConfig)
+		sharexConfig = functions.GenerateUploaderConfig(key, domain)
 	case "url":
-		urlConfig := functions.GenerateURLShortenerConfig(key, domain)
-		functions.SendConfig(c, urlConfig)
+		sharexConfig = functions.GenerateURLShortenerConfig(key, domain)
 	case "text":
-		config := functions.GenerateTextUploaderConfig()
-		functions.SendConfig(c, config)
+		sharexConfig = functions.GenerateTextUploaderConfig()
+	default:
+		return validationError(c, constants.CodeInvalidConfigType, constants.MessageInvalidConfigType, invalidField("type"))
 	}
 
+	if err := functions.SendConfig(c, sharexConfig); err != nil {
+		log.Printf("Error sending %s config: %v\n", queryType, err)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedSendConfig, constants.MessageFailedSendConfig)
+	}
 	return nil
 }
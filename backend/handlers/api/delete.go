@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"log"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"tritan.dev/image-uploader/constants"
@@ -12,45 +13,51 @@ import (
 func DeleteUpload(c *fiber.Ctx) error {
 	key := c.Get("key")
 	if key == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageAPIKeyRequired)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
 	}
 
 	validUsers, err := database.LoadUsersFromDB()
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedLoadUsers)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedLoadUsers, constants.MessageFailedLoadUsers)
 	}
 
 	if !functions.IsValidKey(key, validUsers) {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageInvalidKey)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
 	}
 
-	id := c.Params("id")
+	id := pathParam(c, "id")
 	if id == "" {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageMissingUploadID)
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeMissingUploadID, constants.MessageMissingUploadID)
 	}
 
-	logEntry, err := database.GetUploadBySlug(id)
-	if err != nil || logEntry == (database.UploadEntry{}) {
-		return errorResponse(c, constants.StatusNotFound, constants.MessageUploadNotFound)
+	logEntry, err := findUpload(id, key)
+	if err != nil || logEntry.FileName == "" || logEntry.Trashed() {
+		return errorResponse(c, constants.StatusNotFound, constants.CodeUploadNotFound, constants.MessageUploadNotFound)
 	}
 
 	if logEntry.Key != key {
 		log.Printf("Key: %s, logEntry.Key: %s\n", key, logEntry.Key)
-		return errorResponse(c, fiber.StatusForbidden, constants.MessageUploadUnauthorized)
+		return errorResponse(c, fiber.StatusForbidden, constants.CodeUploadUnauthorized, constants.MessageUploadUnauthorized)
 	}
 
-	logEntry, err = database.DeleteUploadFromDB(key, id)
-	if err != nil {
-		log.Printf("Error deleting upload from DB: %v\n", err)
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageUploadError)
+	if functions.TrashEnabled() {
+		if err := functions.TrashUpload(&logEntry); err != nil {
+			log.Printf("Error moving upload to trash: %v\n", err)
+			return errorResponse(c, constants.StatusInternalServerError, constants.CodeUploadError, constants.MessageUploadError)
+		}
+
+		return c.JSON(fiber.Map{
+			"status":     constants.StatusOK,
+			"message":    constants.MessageMovedToTrash,
+			"expires_at": functions.TrashExpiry(*logEntry.DeletedAt).Format(time.RFC3339),
+		})
 	}
 
-	fullKey := logEntry.FileName
-
-	err = functions.DeleteFileFromS3(fullKey)
-	if err != nil {
-		log.Println("Failed to delete object from S3:", err)
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageUploadError)
+	// Delete the record that was just checked, not whatever the name
+	// resolves to now.
+	if _, err := functions.PurgeUpload(logEntry.ID); err != nil {
+		log.Printf("Error deleting upload %s: %v\n", logEntry.FileName, err)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeUploadError, constants.MessageUploadError)
 	}
 
 	return c.JSON(fiber.Map{
@@ -62,36 +69,51 @@ func DeleteUpload(c *fiber.Ctx) error {
 func DeleteURL(c *fiber.Ctx) error {
 	key := c.Get("key")
 	if key == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageAPIKeyRequired)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
 	}
 
 	validUsers, err := database.LoadUsersFromDB()
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedLoadUsers)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedLoadUsers, constants.MessageFailedLoadUsers)
 	}
 
 	if !functions.IsValidKey(key, validUsers) {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageInvalidKey)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
 	}
 
-	slug := c.Params("slug")
+	slug := pathParam(c, "slug")
 	if slug == "" {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageMissingURLSlug)
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeMissingURLSlug, constants.MessageMissingURLSlug)
 	}
 
 	urlData, err := functions.GetURLBySlug(slug)
-	if err != nil || urlData == nil {
-		return errorResponse(c, constants.StatusNotFound, constants.MessageMissingURL)
+	if err != nil || urlData == nil || urlData.DeletedAt != nil {
+		return errorResponse(c, constants.StatusNotFound, constants.CodeURLNotFound, constants.MessageMissingURL)
 	}
 
 	if urlData.Key != key {
-		return errorResponse(c, constants.StatusForbidden, constants.MessageSlugUnauthorized)
+		return errorResponse(c, constants.StatusForbidden, constants.CodeSlugUnauthorized, constants.MessageSlugUnauthorized)
+	}
+
+	if functions.TrashEnabled() {
+		now := time.Now()
+		if err := database.TrashURL(slug, now); err != nil {
+			log.Printf("Error moving URL to trash: %v\n", err)
+			return errorResponse(c, constants.StatusInternalServerError, constants.CodeSlugFailed, constants.MessageSlugFailed)
+		}
+
+		return c.JSON(fiber.Map{
+			"status":     constants.StatusOK,
+			"message":    constants.MessageMovedToTrash,
+			"url":        urlData.URL,
+			"expires_at": functions.TrashExpiry(now).Format(time.RFC3339),
+		})
 	}
 
 	url, err := database.DeleteURLFromDB(key, slug)
 	if err != nil {
 		log.Printf("Error deleting URL from DB: %v\n", err)
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageSlugFailed)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeSlugFailed, constants.MessageSlugFailed)
 	}
 
 	return c.JSON(fiber.Map{
@@ -8,20 +8,20 @@ import (
 	"tritan.dev/image-uploader/database"
 )
 
-func GetEligableDomains(c *fiber.Ctx) error {
+func GetEligibleDomains(c *fiber.Ctx) error {
 	apiKey := c.Get("key")
 	if apiKey == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageAPIKeyRequired)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
 	}
 
 	_, err := database.GetUserByKey(apiKey)
 	if err != nil {
-		return errorResponse(c, constants.StatusNotFound, constants.MessageUserNotFound)
+		return errorResponse(c, constants.StatusNotFound, constants.CodeUserNotFound, constants.MessageUserNotFound)
 	}
 
 	domains, err := database.GetEligibleDomainsFromDB(apiKey)
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedGetDomains)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedGetDomains, constants.MessageFailedGetDomains)
 	}
 
 	return c.JSON(fiber.Map{
@@ -35,30 +35,26 @@ func PutDomainWithAPIKey(c *fiber.Ctx) error {
 	isPublic := c.Query("p")
 
 	if apiKey == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageAPIKeyRequired)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
 	}
 
 	_, err := database.GetUserByKey(apiKey)
 	if err != nil {
-		return errorResponse(c, constants.StatusNotFound, constants.MessageUserNotFound)
+		return errorResponse(c, constants.StatusNotFound, constants.CodeUserNotFound, constants.MessageUserNotFound)
 	}
 
 	if domain == "" {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageMissingFields)
-	}
-
-	if domain == "" || apiKey == "" {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageMissingFields)
+		return validationError(c, constants.CodeMissingFields, constants.MessageMissingFields, requiredField("i"))
 	}
 
 	boolIsPublic, err := strconv.ParseBool(isPublic)
 	if err != nil {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageInvalidPayload)
+		return validationError(c, constants.CodeInvalidPayload, constants.MessageInvalidPayload, invalidField("p"))
 	}
 
 	err = database.AddDomainWithAPIKey(domain, apiKey, boolIsPublic)
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedAddDomain)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedAddDomain, constants.MessageFailedAddDomain)
 	}
 
 	return c.JSON(fiber.Map{
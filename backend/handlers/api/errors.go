@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"tritan.dev/image-uploader/constants"
+)
+
+// errorResponse writes the legacy {status, message} error body. code is the
+// constants.Code the /api/v1 envelope reports for it.
+func errorResponse(c *fiber.Ctx, status int, code, message string) error {
+	c.Locals(constants.ErrorCodeLocal, code)
+	return c.Status(status).JSON(fiber.Map{
+		"status":  status,
+		"message": message,
+	})
+}
+
+// fieldError names one request field that failed validation and why, using
+// the constants.Field codes.
+type fieldError struct {
+	Field string `json:"field"`
+	Code  string `json:"code"`
+}
+
+func (e fieldError) Error() string {
+	return e.Field + " is " + e.Code
+}
+
+func requiredField(field string) fieldError {
+	return fieldError{Field: field, Code: constants.FieldRequired}
+}
+
+func invalidField(field string) fieldError {
+	return fieldError{Field: field, Code: constants.FieldInvalid}
+}
+
+// fieldErrorResponse is errorResponse with the fields that caused it, so
+// clients can point at the input to fix.
+func fieldErrorResponse(c *fiber.Ctx, status int, code, message string, fields ...fieldError) error {
+	c.Locals(constants.ErrorCodeLocal, code)
+	return c.Status(status).JSON(fiber.Map{
+		"status":  status,
+		"message": message,
+		"fields":  fields,
+	})
+}
+
+func validationError(c *fiber.Ctx, code, message string, fields ...fieldError) error {
+	return fieldErrorResponse(c, constants.StatusBadRequest, code, message, fields...)
+}
+
+// invalidQuery writes the 400 for query parameters rejected by getListQuery
+// or getPagination, naming the parameter when it is known.
+func invalidQuery(c *fiber.Ctx, err error) error {
+	var field fieldError
+	if errors.As(err, &field) {
+		return validationError(c, constants.CodeInvalidRequest, constants.MessageInvalidRequest, field)
+	}
+	return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequest, constants.MessageInvalidRequest)
+}
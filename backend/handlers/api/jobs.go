@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"tritan.dev/image-uploader/constants"
+	"tritan.dev/image-uploader/database"
+	"tritan.dev/image-uploader/functions"
+)
+
+const maxJobsListed = 100
+
+// apiPrefix is the prefix the request was routed under, /api or /api/v1.
+func apiPrefix(c *fiber.Ctx) string {
+	if prefix, ok := c.Locals(constants.APIPrefixLocal).(string); ok {
+		return prefix
+	}
+	return "/api"
+}
+
+// enqueueJob queues a job and answers 202 Accepted with where to follow it,
+// under the same API prefix as the request.
+func enqueueJob(c *fiber.Ctx, jobType, key string, payload map[string]string) error {
+	job, err := functions.EnqueueJob(jobType, key, payload)
+	if err != nil {
+		log.Printf("Error queueing %s job: %v", jobType, err)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedQueueJob, constants.MessageFailedQueueJob)
+	}
+
+	return c.Status(constants.StatusAccepted).JSON(fiber.Map{
+		"status":     constants.StatusAccepted,
+		"message":    constants.MessageJobQueued,
+		"job_id":     job.ID.Hex(),
+		"status_url": apiPrefix(c) + "/jobs/" + job.ID.Hex(),
+	})
+}
+
+// GetJob reports a job's progress to the key that queued it, or to an admin.
+// The key does not need to belong to a user any more, so a deleted account
+// can still see its deletion finish.
+func GetJob(c *fiber.Ctx) error {
+	key := c.Get("key")
+	if key == "" {
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return errorResponse(c, constants.StatusNotFound, constants.CodeJobNotFound, constants.MessageJobNotFound)
+	}
+
+	job, err := database.GetJob(id)
+	if err != nil {
+		return errorResponse(c, constants.StatusNotFound, constants.CodeJobNotFound, constants.MessageJobNotFound)
+	}
+
+	if job.Key != key {
+		user, err := database.GetUserByKey(key)
+		if err != nil || !user.Admin {
+			return errorResponse(c, constants.StatusNotFound, constants.CodeJobNotFound, constants.MessageJobNotFound)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"status": constants.StatusOK,
+		"job":    job,
+	})
+}
+
+func GetJobs(c *fiber.Ctx) error {
+	key := c.Get("key")
+	if key == "" {
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
+	}
+
+	if _, err := database.GetUserByKey(key); err != nil {
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
+	}
+
+	return listJobs(c, key)
+}
+
+func GetAdminJobs(c *fiber.Ctx) error {
+	if _, ok := requireAdmin(c); !ok {
+		return nil
+	}
+
+	return listJobs(c, "")
+}
+
+func listJobs(c *fiber.Ctx, key string) error {
+	jobs, err := database.LoadJobs(key, c.Query("status"), maxJobsListed)
+	if err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedLoadJobs, constants.MessageFailedLoadJobs)
+	}
+
+	return c.JSON(fiber.Map{
+		"status": constants.StatusOK,
+		"jobs":   jobs,
+	})
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"tritan.dev/image-uploader/constants"
+	"tritan.dev/image-uploader/database"
+)
+
+// getListQuery reads the filter, sort and cursor parameters shared by the
+// upload and URL listings. Without limit or cursor every match is returned,
+// which keeps the dashboard's existing unpaginated calls working.
+func getListQuery(c *fiber.Ctx, key string, validSort func(string) bool) (database.ListQuery, error) {
+	query := database.ListQuery{
+		Key:    key,
+		Search: c.Query("q"),
+		Domain: c.Query("domain"),
+		Tag:    normalizeTag(c.Query("tag")),
+		Type:   c.Query("type"),
+		Sort:   c.Query("sort", "date"),
+		Cursor: c.Query("cursor"),
+	}
+
+	if !validSort(query.Sort) {
+		return query, invalidField("sort")
+	}
+
+	switch c.Query("order", "desc") {
+	case "asc":
+		query.Ascending = true
+	case "desc":
+	default:
+		return query, invalidField("order")
+	}
+
+	if query.Type != "" && query.Type != constants.UploadTypeFile && query.Type != constants.UploadTypeEncrypted {
+		return query, invalidField("type")
+	}
+
+	var err error
+	if query.From, err = parseListDate(c.Query("from")); err != nil {
+		return query, invalidField("from")
+	}
+	if query.To, err = parseListDate(c.Query("to")); err != nil {
+		return query, invalidField("to")
+	}
+	if query.MinSize, err = parseListInt(c.Query("min_size")); err != nil {
+		return query, invalidField("min_size")
+	}
+	if query.MaxSize, err = parseListInt(c.Query("max_size")); err != nil {
+		return query, invalidField("max_size")
+	}
+
+	if c.Query("limit") != "" || query.Cursor != "" {
+		_, limit, err := getPagination(c)
+		if err != nil {
+			return query, err
+		}
+		query.Limit = limit
+	}
+
+	return query, nil
+}
+
+// parseListDate accepts a full RFC 3339 timestamp or a bare date.
+func parseListDate(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if date, err := time.Parse(time.RFC3339, raw); err == nil {
+		return date, nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
+
+func parseListInt(raw string) (int64, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || value < 0 {
+		return 0, fiber.NewError(constants.StatusBadRequest, constants.MessageInvalidRequest)
+	}
+	return value, nil
+}
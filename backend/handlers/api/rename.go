@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/constants"
+	"tritan.dev/image-uploader/database"
+	"tritan.dev/image-uploader/functions"
+)
+
+// uploadNameError writes the response for a name rejected by
+// functions.CheckUploadName.
+func uploadNameError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, functions.ErrNameInvalid):
+		return validationError(c, constants.CodeInvalidUploadName, constants.MessageInvalidUploadName, invalidField("name"))
+	case errors.Is(err, functions.ErrNameReserved):
+		return validationError(c, constants.CodeReservedUploadName, constants.MessageReservedUploadName, fieldError{Field: "name", Code: constants.FieldReserved})
+	case errors.Is(err, functions.ErrNameTaken):
+		return fieldErrorResponse(c, constants.StatusConflict, constants.CodeUploadNameTaken, constants.MessageUploadNameTaken, fieldError{Field: "name", Code: constants.FieldTaken})
+	}
+	log.Printf("Error checking upload name: %v\n", err)
+	return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedUpdateUpload, constants.MessageFailedUpdateUpload)
+}
+
+func PutUploadName(c *fiber.Ctx) error {
+	user, upload, ok := requireOwnedUpload(c)
+	if !ok {
+		return nil
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequestBody, constants.MessageInvalidRequestBody)
+	}
+
+	ext := path.Ext(upload.FileName)
+	oldName := strings.TrimSuffix(upload.FileName, ext)
+	domain := upload.Domain
+	if domain == "" {
+		domain = user.Domain
+	}
+	uploadURL := fmt.Sprintf("https://%s/i/%s", domain, url.PathEscape(req.Name))
+	if req.Name == oldName {
+		return c.JSON(fiber.Map{
+			"status":  constants.StatusOK,
+			"message": constants.MessageUploadRenamed,
+			"url":     uploadURL,
+		})
+	}
+
+	if err := functions.CheckUploadName(upload.Domain, req.Name, upload.ID); err != nil {
+		return uploadNameError(c, err)
+	}
+
+	redirectUntil := time.Time{}
+	if days := config.AppConfigInstance.Upload_RenameRedirectDays; days > 0 {
+		redirectUntil = time.Now().AddDate(0, 0, days)
+	}
+
+	err := database.RenameUpload(upload, req.Name+ext, oldName, redirectUntil)
+	if database.IsDuplicateKey(err) {
+		// Taken on this domain in the meantime.
+		return uploadNameError(c, functions.ErrNameTaken)
+	}
+	if err != nil {
+		log.Printf("Error renaming %s: %v\n", upload.FileName, err)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedUpdateUpload, constants.MessageFailedUpdateUpload)
+	}
+
+	response := fiber.Map{
+		"status":  constants.StatusOK,
+		"message": constants.MessageUploadRenamed,
+		"url":     uploadURL,
+	}
+	if !redirectUntil.IsZero() {
+		response["redirect_until"] = redirectUntil.Format(time.RFC3339)
+	}
+	return c.JSON(response)
+}
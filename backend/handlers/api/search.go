@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"tritan.dev/image-uploader/constants"
+	"tritan.dev/image-uploader/database"
+)
+
+// GetSearch searches the caller's own uploads and URLs.
+func GetSearch(c *fiber.Ctx) error {
+	key := c.Get("key")
+	if key == "" {
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
+	}
+
+	if _, err := database.GetUserByKey(key); err != nil {
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
+	}
+
+	hits, ok := runSearch(c, key, []string{database.SearchKindUpload, database.SearchKindURL})
+	if !ok {
+		return nil
+	}
+
+	for i := range hits {
+		if hits[i].Upload != nil {
+			hits[i].Upload.IP = "[Redacted]"
+			hits[i].Upload.Key = "[Redacted]"
+		}
+		if hits[i].URL != nil {
+			hits[i].URL.IP = "[Redacted]"
+			hits[i].URL.Key = "[Redacted]"
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  constants.StatusOK,
+		"query":   c.Query("q"),
+		"count":   len(hits),
+		"results": hits,
+	})
+}
+
+// GetAdminSearch searches uploads, URLs and users across every account.
+func GetAdminSearch(c *fiber.Ctx) error {
+	if _, ok := requireAdmin(c); !ok {
+		return nil
+	}
+
+	hits, ok := runSearch(c, "", []string{database.SearchKindUpload, database.SearchKindURL, database.SearchKindUser})
+	if !ok {
+		return nil
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  constants.StatusOK,
+		"query":   c.Query("q"),
+		"count":   len(hits),
+		"results": hits,
+	})
+}
+
+// runSearch reads q, limit and the optional comma separated kind filter, and
+// writes the error response itself when the search cannot run.
+func runSearch(c *fiber.Ctx, key string, allowed []string) ([]database.SearchHit, bool) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		_ = validationError(c, constants.CodeSearchQueryRequired, constants.MessageSearchQueryRequired, requiredField("q"))
+		return nil, false
+	}
+
+	_, limit, err := getPagination(c)
+	if err != nil {
+		_ = invalidQuery(c, err)
+		return nil, false
+	}
+
+	kinds := allowed
+	if raw := c.Query("kind"); raw != "" {
+		kinds = []string{}
+		for _, kind := range strings.Split(raw, ",") {
+			kind = strings.TrimSpace(kind)
+			if !slices.Contains(allowed, kind) {
+				_ = validationError(c, constants.CodeInvalidRequest, constants.MessageInvalidRequest, invalidField("kind"))
+				return nil, false
+			}
+			kinds = append(kinds, kind)
+		}
+	}
+
+	hits, err := database.Search(query, key, kinds, limit)
+	if err != nil {
+		_ = errorResponse(c, constants.StatusInternalServerError, constants.CodeSearchFailed, constants.MessageSearchFailed)
+		return nil, false
+	}
+	return hits, true
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"tritan.dev/image-uploader/constants"
+	"tritan.dev/image-uploader/database"
+	"tritan.dev/image-uploader/functions"
+)
+
+const (
+	defaultShareLinkTTL = 24 * time.Hour
+	maxShareLinkTTL     = 30 * 24 * time.Hour
+)
+
+func PostUploadShareLink(c *fiber.Ctx) error {
+	user, upload, ok := requireOwnedUpload(c)
+	if !ok {
+		return nil
+	}
+
+	var req struct {
+		ExpiresIn int64 `json:"expires_in"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequestBody, constants.MessageInvalidRequestBody)
+		}
+	}
+
+	ttl := defaultShareLinkTTL
+	if req.ExpiresIn != 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if ttl <= 0 || ttl > maxShareLinkTTL {
+		return validationError(c, constants.CodeInvalidExpiry, constants.MessageInvalidExpiry, invalidField("expires_in"))
+	}
+
+	token := functions.SignToken(functions.ShareSubject(upload), ttl)
+	name := strings.TrimSuffix(upload.FileName, path.Ext(upload.FileName))
+	domain := upload.Domain
+	if domain == "" {
+		domain = user.Domain
+	}
+
+	return c.JSON(fiber.Map{
+		"status":     constants.StatusOK,
+		"url":        fmt.Sprintf("https://%s/i/%s?share=%s", domain, url.PathEscape(name), token),
+		"expires_at": time.Now().Add(ttl).Format(time.RFC3339),
+	})
+}
+
+func PutUploadVisibility(c *fiber.Ctx) error {
+	_, upload, ok := requireOwnedUpload(c)
+	if !ok {
+		return nil
+	}
+
+	var req struct {
+		Visibility string `json:"visibility"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequestBody, constants.MessageInvalidRequestBody)
+	}
+
+	if !validVisibility(req.Visibility) {
+		return validationError(c, constants.CodeInvalidVisibility, constants.MessageInvalidVisibility, invalidField("visibility"))
+	}
+
+	wasPrivate := upload.StoredPrivately()
+	upload.Visibility = req.Visibility
+
+	if upload.StoredPrivately() != wasPrivate {
+		if err := functions.ApplyObjectACL(&upload); err != nil {
+			log.Printf("Error updating object ACL for %s: %v\n", upload.FileName, err)
+			return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedUpdateUpload, constants.MessageFailedUpdateUpload)
+		}
+	}
+
+	if err := database.UpdateUploadVisibility(upload.ID, req.Visibility); err != nil {
+		log.Printf("Error updating visibility for %s: %v\n", upload.FileName, err)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedUpdateUpload, constants.MessageFailedUpdateUpload)
+	}
+
+	return c.JSON(fiber.Map{
+		"status":     constants.StatusOK,
+		"visibility": req.Visibility,
+	})
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/constants"
+	"tritan.dev/image-uploader/database"
+	"tritan.dev/image-uploader/functions"
+)
+
+type trashedUpload struct {
+	database.UploadEntry
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type trashedURL struct {
+	database.URL
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func GetTrash(c *fiber.Ctx) error {
+	key := c.Get("key")
+	if key == "" {
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
+	}
+
+	if _, err := database.GetUserByKey(key); err != nil {
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
+	}
+
+	uploads, err := database.LoadTrashedUploads(key)
+	if err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedLoadTrash, constants.MessageFailedLoadTrash)
+	}
+
+	urls, err := database.LoadTrashedURLs(key)
+	if err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedLoadTrash, constants.MessageFailedLoadTrash)
+	}
+
+	trashedUploads := make([]trashedUpload, 0, len(uploads))
+	for _, upload := range uploads {
+		upload.IP = "[Redacted]"
+		upload.Key = "[Redacted]"
+		trashedUploads = append(trashedUploads, trashedUpload{upload, functions.TrashExpiry(*upload.DeletedAt)})
+	}
+
+	trashedURLs := make([]trashedURL, 0, len(urls))
+	for _, url := range urls {
+		url.IP = "[Redacted]"
+		url.Key = "[Redacted]"
+		trashedURLs = append(trashedURLs, trashedURL{url, functions.TrashExpiry(*url.DeletedAt)})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":         constants.StatusOK,
+		"retention_days": config.AppConfigInstance.Trash_RetentionDays,
+		"uploads":        trashedUploads,
+		"urls":           trashedURLs,
+	})
+}
+
+// requireTrashedUpload resolves the :id upload from the caller's trash,
+// writing the error response itself when it is not there.
+func requireTrashedUpload(c *fiber.Ctx) (database.UploadEntry, bool) {
+	key := c.Get("key")
+	if key == "" {
+		_ = errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
+		return database.UploadEntry{}, false
+	}
+
+	upload, err := findUpload(pathParam(c, "id"), key)
+	if err != nil || upload.Key != key {
+		_ = errorResponse(c, constants.StatusNotFound, constants.CodeUploadNotFound, constants.MessageUploadNotFound)
+		return database.UploadEntry{}, false
+	}
+
+	if !upload.Trashed() {
+		_ = errorResponse(c, constants.StatusConflict, constants.CodeNotInTrash, constants.MessageNotInTrash)
+		return database.UploadEntry{}, false
+	}
+
+	return upload, true
+}
+
+// requireTrashedURL is requireTrashedUpload for the :slug URL.
+func requireTrashedURL(c *fiber.Ctx) (database.URL, bool) {
+	key := c.Get("key")
+	if key == "" {
+		_ = errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
+		return database.URL{}, false
+	}
+
+	url, err := database.GetURLBySlug(pathParam(c, "slug"))
+	if err != nil || url == nil || url.Key != key {
+		_ = errorResponse(c, constants.StatusNotFound, constants.CodeURLNotFound, constants.MessageMissingURL)
+		return database.URL{}, false
+	}
+
+	if url.DeletedAt == nil {
+		_ = errorResponse(c, constants.StatusConflict, constants.CodeNotInTrash, constants.MessageNotInTrash)
+		return database.URL{}, false
+	}
+
+	return *url, true
+}
+
+func PostRestoreUpload(c *fiber.Ctx) error {
+	upload, ok := requireTrashedUpload(c)
+	if !ok {
+		return nil
+	}
+
+	if err := functions.RestoreUpload(&upload); errors.Is(err, functions.ErrTrashExpired) {
+		return errorResponse(c, constants.StatusConflict, constants.CodeTrashExpired, constants.MessageTrashExpired)
+	} else if err != nil {
+		log.Printf("Error restoring upload %s: %v\n", upload.FileName, err)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedUpdateUpload, constants.MessageFailedUpdateUpload)
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  constants.StatusOK,
+		"message": constants.MessageRestored,
+	})
+}
+
+func PostRestoreURL(c *fiber.Ctx) error {
+	url, ok := requireTrashedURL(c)
+	if !ok {
+		return nil
+	}
+
+	if functions.TrashExpired(*url.DeletedAt) {
+		return errorResponse(c, constants.StatusConflict, constants.CodeTrashExpired, constants.MessageTrashExpired)
+	}
+
+	if err := database.RestoreURL(url.Slug); err != nil {
+		log.Printf("Error restoring URL %s: %v\n", url.Slug, err)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeSlugFailed, constants.MessageSlugFailed)
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  constants.StatusOK,
+		"message": constants.MessageRestored,
+	})
+}
+
+// DeleteTrashedUpload purges an upload from the trash without waiting for
+// the retention window.
+func DeleteTrashedUpload(c *fiber.Ctx) error {
+	upload, ok := requireTrashedUpload(c)
+	if !ok {
+		return nil
+	}
+
+	if _, err := functions.PurgeUpload(upload.ID); err != nil {
+		log.Printf("Error purging upload %s: %v\n", upload.FileName, err)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeUploadError, constants.MessageUploadError)
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  constants.StatusOK,
+		"message": constants.MessageUploadDeleted,
+	})
+}
+
+func DeleteTrashedURL(c *fiber.Ctx) error {
+	url, ok := requireTrashedURL(c)
+	if !ok {
+		return nil
+	}
+
+	if _, err := database.DeleteURLFromDB(url.Key, url.Slug); err != nil {
+		log.Printf("Error purging URL %s: %v\n", url.Slug, err)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeSlugFailed, constants.MessageSlugFailed)
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  constants.StatusOK,
+		"message": "URL deleted successfully",
+	})
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"log"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"tritan.dev/image-uploader/constants"
+	"tritan.dev/image-uploader/database"
+)
+
+const (
+	maxOriginalNameLength = 255
+	maxTitleLength        = 200
+	maxDescriptionLength  = 2000
+	maxTags               = 20
+	maxTagLength          = 50
+)
+
+func PatchUploadDetails(c *fiber.Ctx) error {
+	_, upload, ok := requireOwnedUpload(c)
+	if !ok {
+		return nil
+	}
+
+	var req database.UploadDetails
+	if err := c.BodyParser(&req); err != nil {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequestBody, constants.MessageInvalidRequestBody)
+	}
+
+	details, field, ok := normalizeUploadDetails(req)
+	if !ok {
+		return validationError(c, constants.CodeInvalidUploadDetails, constants.MessageInvalidUploadDetails, field)
+	}
+
+	if err := database.UpdateUploadDetails(upload.ID, details); err != nil {
+		log.Printf("Error updating details for %s: %v\n", upload.FileName, err)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedUpdateUpload, constants.MessageFailedUpdateUpload)
+	}
+
+	if details.OriginalName != nil {
+		upload.OriginalName = *details.OriginalName
+	}
+	if details.Title != nil {
+		upload.Title = *details.Title
+	}
+	if details.Description != nil {
+		upload.Description = *details.Description
+	}
+	if details.Tags != nil {
+		upload.Tags = *details.Tags
+	}
+
+	return c.JSON(fiber.Map{
+		"status":       constants.StatusOK,
+		"originalName": upload.OriginalName,
+		"title":        upload.Title,
+		"description":  upload.Description,
+		"tags":         upload.Tags,
+	})
+}
+
+// normalizeUploadDetails trims and bounds the descriptive fields. It reports
+// false and the offending field when any field is over its limit rather than
+// silently truncating it.
+func normalizeUploadDetails(details database.UploadDetails) (database.UploadDetails, fieldError, bool) {
+	if details.OriginalName != nil {
+		name := sanitizeFileName(*details.OriginalName)
+		if len(name) > maxOriginalNameLength {
+			return details, fieldError{Field: "originalName", Code: constants.FieldTooLong}, false
+		}
+		details.OriginalName = &name
+	}
+
+	if details.Title != nil {
+		title := strings.TrimSpace(*details.Title)
+		if len(title) > maxTitleLength {
+			return details, fieldError{Field: "title", Code: constants.FieldTooLong}, false
+		}
+		details.Title = &title
+	}
+
+	if details.Description != nil {
+		description := strings.TrimSpace(*details.Description)
+		if len(description) > maxDescriptionLength {
+			return details, fieldError{Field: "description", Code: constants.FieldTooLong}, false
+		}
+		details.Description = &description
+	}
+
+	if details.Tags != nil {
+		tags, ok := normalizeTags(*details.Tags)
+		if !ok {
+			return details, invalidField("tags"), false
+		}
+		details.Tags = &tags
+	}
+
+	return details, fieldError{}, true
+}
+
+// normalizeTags lowercases, trims and de-duplicates tags, keeping their order.
+func normalizeTags(raw []string) ([]string, bool) {
+	tags := []string{}
+	for _, tag := range raw {
+		tag = normalizeTag(tag)
+		if tag == "" || slices.Contains(tags, tag) {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, false
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTags {
+		return nil, false
+	}
+	return tags, true
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// splitTags parses the comma separated tags form field sent with an upload.
+func splitTags(field string) []string {
+	if strings.TrimSpace(field) == "" {
+		return nil
+	}
+	return strings.Split(field, ",")
+}
+
+// sanitizeFileName keeps only the base name of a client supplied filename and
+// drops control characters, so it is safe to echo in a Content-Disposition.
+func sanitizeFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
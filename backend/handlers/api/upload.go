@@ -3,82 +3,390 @@ package handlers
 import (
 	"fmt"
 	"log"
+	"mime/multipart"
+	"net/url"
 	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/sync/errgroup"
+	"tritan.dev/image-uploader/config"
 	"tritan.dev/image-uploader/constants"
 	"tritan.dev/image-uploader/database"
 	"tritan.dev/image-uploader/functions"
 )
 
+// defaultCipher is the only scheme pages/encrypted.html knows how to decrypt:
+// AES-256-GCM with the 12-byte IV prepended to the ciphertext.
+const defaultCipher = "AES-GCM-256"
+
+// nameSaveAttempts bounds how often an upload is saved under a fresh name
+// after its generated one was taken by a concurrent upload.
+const nameSaveAttempts = 3
+
+// uploadOptions are the per-request form fields shared by every file in it.
+type uploadOptions struct {
+	uploadType   string
+	cipher       string
+	visibility   string
+	passwordHash string
+	ip           string
+	name         string
+	nameStyle    string
+	title        string
+	description  string
+	tags         []string
+}
+
+type uploadResult struct {
+	File      string `json:"file"`
+	URL       string `json:"url,omitempty"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Error     string `json:"error,omitempty"`
+
+	status   int
+	code     string
+	uploadID string
+}
+
+func failedUpload(file string, status int, code, message string) uploadResult {
+	return uploadResult{File: file, Error: message, status: status, code: code}
+}
+
 func PostUpload(c *fiber.Ctx) error {
 	apiKey := c.Get("key")
 	if apiKey == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageAPIKeyRequired)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
 	}
 
 	user, err := database.GetUserByKey(apiKey)
 	if err != nil {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageInvalidKey)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
 	}
 
-	sharex, err := c.FormFile("sharex")
-	if err != nil {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageNoFileUploaded)
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["sharex"]) == 0 {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeNoFileUploaded, constants.MessageNoFileUploaded)
 	}
+	files := form.File["sharex"]
 
-	ext := path.Ext(sharex.Filename)
-	name := functions.GenerateRandomKey(10)
+	if max := config.AppConfigInstance.Upload_MaxFilesPerRequest; max > 0 && len(files) > max {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeTooManyFiles, constants.MessageTooManyFiles)
+	}
+
+	opts := uploadOptions{
+		uploadType: constants.UploadTypeFile,
+		visibility: c.FormValue("visibility", constants.VisibilityPublic),
+		ip:         c.IP(),
+	}
+
+	if encrypted, _ := strconv.ParseBool(c.FormValue("encrypted")); encrypted {
+		opts.uploadType = constants.UploadTypeEncrypted
+		opts.cipher = c.FormValue("cipher", defaultCipher)
+		if opts.cipher != defaultCipher {
+			return validationError(c, constants.CodeInvalidCipher, constants.MessageInvalidCipher, invalidField("cipher"))
+		}
+	}
+
+	var album *database.Album
+	if albumID := c.FormValue("album"); albumID != "" {
+		found, err := database.GetAlbumByID(albumID)
+		if err != nil || found.Key != apiKey {
+			return validationError(c, constants.CodeAlbumNotFound, constants.MessageAlbumNotFound, invalidField("album"))
+		}
+		album = &found
+	}
+	createAlbumForBatch, _ := strconv.ParseBool(c.FormValue("create_album"))
+
+	if opts.name = c.FormValue("name"); opts.name != "" {
+		if len(files) > 1 {
+			return validationError(c, constants.CodeNameNeedsSingleFile, constants.MessageNameNeedsSingleFile, invalidField("name"))
+		}
+		if err := functions.CheckUploadName(user.Domain, opts.name, primitive.NilObjectID); err != nil {
+			return uploadNameError(c, err)
+		}
+	}
+
+	if opts.nameStyle = c.FormValue("name_style"); opts.nameStyle != "" && !functions.ValidNameStyle(opts.nameStyle) {
+		return validationError(c, constants.CodeInvalidNameStyle, constants.MessageInvalidNameStyle, invalidField("name_style"))
+	}
+
+	if !validVisibility(opts.visibility) {
+		return validationError(c, constants.CodeInvalidVisibility, constants.MessageInvalidVisibility, invalidField("visibility"))
+	}
+
+	title, description, tags := c.FormValue("title"), c.FormValue("description"), splitTags(c.FormValue("tags"))
+	details, field, ok := normalizeUploadDetails(database.UploadDetails{Title: &title, Description: &description, Tags: &tags})
+	if !ok {
+		return validationError(c, constants.CodeInvalidUploadDetails, constants.MessageInvalidUploadDetails, field)
+	}
+	opts.title, opts.description, opts.tags = *details.Title, *details.Description, *details.Tags
+
+	if password := c.FormValue("password"); password != "" {
+		opts.passwordHash, err = functions.HashPassword(password)
+		if err != nil {
+			log.Printf("Error hashing upload password: %v\n", err)
+			return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedHashPassword, constants.MessageFailedHashPassword)
+		}
+	}
+
+	results := make([]uploadResult, len(files))
+	group := errgroup.Group{}
+	group.SetLimit(max(config.AppConfigInstance.Upload_MaxParallel, 1))
+	for i, file := range files {
+		i, file := i, file
+		group.Go(func() error {
+			results[i] = storeUpload(user, file, opts)
+			return nil
+		})
+	}
+	group.Wait()
+
+	uploaded := []string{}
+	for _, result := range results {
+		if result.Error == "" && !result.Duplicate {
+			uploaded = append(uploaded, result.uploadID)
+		}
+	}
+
+	albumLink := ""
+	switch {
+	case album != nil && len(uploaded) > 0:
+		if err := database.AddFilesToAlbum(album.ID, uploaded); err != nil {
+			log.Printf("Error adding uploads to album %s: %v\n", album.ID, err)
+		} else {
+			albumLink = albumURL(user, *album)
+		}
+	case createAlbumForBatch && len(uploaded) > 0:
+		title := c.FormValue("album_title", "Upload "+time.Now().Format(time.RFC1123))
+		created, err := createAlbum(user, title, "", uploaded)
+		if err != nil {
+			log.Printf("Error creating album for batch: %v\n", err)
+		} else {
+			albumLink = albumURL(user, created)
+		}
+	}
+
+	// A single file keeps the original response shape, which existing .sxcu
+	// configs read with {json:url}.
+	if len(files) == 1 {
+		result := results[0]
+		if result.Error != "" {
+			return errorResponse(c, result.status, result.code, result.Error)
+		}
+
+		message := constants.MessageFileUploaded
+		if result.Duplicate {
+			message = constants.MessageFileDuplicate
+		}
+
+		response := fiber.Map{
+			"status":  constants.StatusOK,
+			"message": message,
+			"url":     result.URL,
+			"type":    opts.uploadType,
+		}
+		if result.Duplicate {
+			response["duplicate"] = true
+		}
+		if albumLink != "" {
+			response["album"] = albumLink
+		}
+		return c.JSON(response)
+	}
 
-	ip := c.Get("x-forwarded-for")
-	if ip == "" {
-		ip = c.IP()
+	firstURL := ""
+	for _, result := range results {
+		if result.Error == "" {
+			firstURL = result.URL
+			break
+		}
 	}
+	if firstURL == "" {
+		c.Locals(constants.ErrorCodeLocal, constants.CodeUploadFailed)
+		return c.Status(results[0].status).JSON(fiber.Map{
+			"status":  results[0].status,
+			"message": constants.MessageUploadFailed,
+			"results": results,
+		})
+	}
+
+	url := firstURL
+	if albumLink != "" {
+		url = albumLink
+	}
+
+	response := fiber.Map{
+		"status":  constants.StatusOK,
+		"message": constants.MessageFilesUploaded,
+		"url":     url,
+		"type":    opts.uploadType,
+		"results": results,
+	}
+	if albumLink != "" {
+		response["album"] = albumLink
+	}
+	return c.JSON(response)
+}
 
-	s3FileName := name + ext
+// storeUpload runs the full pipeline for one file: limits, hashing and
+// deduplication, storage and the database record. It is safe to run
+// concurrently for files in the same request.
+func storeUpload(user database.User, sharex *multipart.FileHeader, opts uploadOptions) uploadResult {
+	apiKey := user.Key
+
+	limits := functions.EffectiveLimits(user)
+	if limits.MaxFileSize > 0 && sharex.Size > limits.MaxFileSize {
+		return failedUpload(sharex.Filename, constants.StatusRequestTooLarge, constants.CodeFileTooLarge, constants.MessageFileTooLarge)
+	}
+
+	ext := path.Ext(sharex.Filename)
+	originalName := sanitizeFileName(sharex.Filename)
+	if opts.uploadType == constants.UploadTypeEncrypted {
+		// The client's filename is part of what it asked us not to learn.
+		ext = ".bin"
+		originalName = ""
+	}
+	if len(originalName) > maxOriginalNameLength {
+		originalName = ""
+	}
+	style := functions.ResolveNameStyle(opts.nameStyle, user)
+	if opts.uploadType == constants.UploadTypeEncrypted {
+		style = functions.NameStyleRandom
+	}
+	name := opts.name
+	if name == "" {
+		generated, err := functions.GenerateUploadName(user.Domain, style, sharex.Filename)
+		if err != nil {
+			log.Printf("Error generating a name for %s: %v\n", sharex.Filename, err)
+			return failedUpload(sharex.Filename, constants.StatusInternalServerError, constants.CodeUploadFailed, constants.MessageUploadFailed)
+		}
+		name = generated
+	}
 
 	file, err := sharex.Open()
 	if err != nil {
 		log.Printf("Error opening file: %v\n", err)
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageUploadFailed)
+		return failedUpload(sharex.Filename, constants.StatusInternalServerError, constants.CodeUploadFailed, constants.MessageUploadFailed)
 	}
 	defer file.Close()
 
+	hash := ""
+	if opts.uploadType != constants.UploadTypeEncrypted {
+		if hash, err = functions.HashObject(file); err != nil {
+			log.Printf("Error hashing file: %v\n", err)
+			return failedUpload(sharex.Filename, constants.StatusInternalServerError, constants.CodeUploadFailed, constants.MessageUploadFailed)
+		}
+	}
+
+	if hash != "" && opts.passwordHash == "" && config.AppConfigInstance.Upload_DedupSameUser {
+		existing, err := database.FindUploadByHash(apiKey, hash)
+		if err == nil && !existing.Protected && existing.EffectiveVisibility() == opts.visibility {
+			existingName := strings.TrimSuffix(existing.FileName, path.Ext(existing.FileName))
+			return uploadResult{
+				File:      sharex.Filename,
+				URL:       fmt.Sprintf("https://%s/i/%s", user.Domain, url.PathEscape(existingName)),
+				Duplicate: true,
+				uploadID:  existing.ID.Hex(),
+			}
+		}
+	}
+
 	fileSize := sharex.Size
-	err = functions.UploadFileToS3(file, s3FileName)
+	reserved, err := database.ReserveUsage(apiKey, fileSize, limits.MaxBytes, limits.MaxFiles)
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedToUploadToS3)
+		return failedUpload(sharex.Filename, constants.StatusInternalServerError, constants.CodeUploadFailed, constants.MessageUploadFailed)
 	}
-
-	if !functions.VerifyUploadToS3(s3FileName) {
-		log.Printf("Error verifying upload to S3: %v\n", err)
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageVerifyFailed)
+	if !reserved {
+		return failedUpload(sharex.Filename, constants.StatusInsufficientStorage, constants.CodeQuotaExceeded, constants.MessageQuotaExceeded)
 	}
 
-	log.Printf("%s just uploaded %s from %s.\n", apiKey, name+ext, ip)
 	logEntry := database.UploadEntry{
-		IP:          ip,
+		ID:          primitive.NewObjectID(),
+		IP:          opts.ip,
 		Key:         apiKey,
 		DisplayName: user.DisplayName,
 		FileName:    name + ext,
+		Domain:      user.Domain,
 		Metadata: database.Metadata{
 			FileType:   ext,
 			FileSize:   fileSize,
 			UploadDate: time.Now(),
 		},
+		Type:         opts.uploadType,
+		Cipher:       opts.cipher,
+		Visibility:   opts.visibility,
+		Protected:    opts.passwordHash != "",
+		PasswordHash: opts.passwordHash,
+		Hash:         hash,
+		OriginalName: originalName,
+		Title:        opts.title,
+		Description:  opts.description,
+		Tags:         opts.tags,
+	}
+
+	objectOptions := functions.S3ObjectOptions{Public: !logEntry.StoredPrivately()}
+	if logEntry.IsEncrypted() {
+		objectOptions.ContentType = "application/octet-stream"
+		objectOptions.ContentDisposition = "attachment"
+	}
+
+	err = functions.PutUploadObject(file, &logEntry, objectOptions)
+	if err != nil {
+		releaseUsage(apiKey, fileSize)
+		return failedUpload(sharex.Filename, constants.StatusInternalServerError, constants.CodeFailedToUploadToS3, constants.MessageFailedToUploadToS3)
 	}
 
-	if err := database.SaveUploadToDB(logEntry); err != nil {
+	if !functions.VerifyUploadToS3(logEntry.ObjectKey()) {
+		log.Printf("Error verifying upload to S3: %s not found after upload\n", logEntry.ObjectKey())
+		releaseUsage(apiKey, fileSize)
+		return failedUpload(sharex.Filename, constants.StatusInternalServerError, constants.CodeVerifyFailed, constants.MessageVerifyFailed)
+	}
+
+	// The object has its own storage key, so a generated name that was taken
+	// in the meantime is simply swapped for a new one.
+	err = database.SaveUploadToDB(logEntry)
+	for attempt := 1; database.IsDuplicateKey(err) && opts.name == "" && attempt < nameSaveAttempts; attempt++ {
+		if name, err = functions.GenerateUploadName(user.Domain, style, sharex.Filename); err != nil {
+			break
+		}
+		logEntry.FileName = name + ext
+		err = database.SaveUploadToDB(logEntry)
+	}
+	if err != nil {
 		log.Printf("Error saving log entry: %v\n", err)
+		if err := functions.DeleteUploadObject(logEntry); err != nil {
+			log.Printf("Error removing unsaved object %s: %v\n", logEntry.ObjectKey(), err)
+		}
+		releaseUsage(apiKey, fileSize)
+		if database.IsDuplicateKey(err) {
+			return failedUpload(sharex.Filename, constants.StatusConflict, constants.CodeUploadNameTaken, constants.MessageUploadNameTaken)
+		}
+		return failedUpload(sharex.Filename, constants.StatusInternalServerError, constants.CodeUploadFailed, constants.MessageUploadFailed)
 	}
 
-	fullURL := fmt.Sprintf("https://%s/i/%s", user.Domain, name)
+	log.Printf("%s just uploaded %s from %s.\n", apiKey, name+ext, opts.ip)
+
+	fullURL := fmt.Sprintf("https://%s/i/%s", user.Domain, url.PathEscape(name))
 	log.Printf("File uploaded successfully: %s\n", fullURL)
 
-	return c.JSON(fiber.Map{
-		"status":  constants.StatusOK,
-		"message": constants.MessageFileUploaded,
-		"url":     fullURL,
-	})
+	return uploadResult{File: sharex.Filename, URL: fullURL, uploadID: logEntry.ID.Hex()}
+}
+
+func validVisibility(visibility string) bool {
+	switch visibility {
+	case constants.VisibilityPublic, constants.VisibilityUnlisted, constants.VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// releaseUsage hands back quota reserved for an upload that did not complete.
+func releaseUsage(apiKey string, size int64) {
+	if err := database.AdjustUsage(apiKey, -size, -1); err != nil {
+		log.Printf("Error releasing usage for %s: %v\n", apiKey, err)
+	}
 }
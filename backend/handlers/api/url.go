@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"tritan.dev/image-uploader/constants"
 	"tritan.dev/image-uploader/database"
 	"tritan.dev/image-uploader/functions"
@@ -13,39 +14,43 @@ import (
 func PostNewURL(c *fiber.Ctx) error {
 	key := c.Get("key")
 	if key == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageAPIKeyRequired)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
 	}
 
 	validUsers, err := database.LoadUsersFromDB()
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedLoadUsers)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedLoadUsers, constants.MessageFailedLoadUsers)
 	}
 
 	if !functions.IsValidKey(key, validUsers) {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageInvalidKey)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
 	}
 
 	user, err := database.GetUserByKey(key)
 	if err != nil {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageInvalidKey)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
 	}
 
 	var urlRequest database.URL
 	if err := c.BodyParser(&urlRequest); err != nil {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageInvalidRequestBody)
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequestBody, constants.MessageInvalidRequestBody)
 	}
 
 	if urlRequest.URL == "" {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageURLRequired)
+		return validationError(c, constants.CodeURLRequired, constants.MessageURLRequired, requiredField("url"))
 	}
 
+	urlRequest.ID = primitive.NilObjectID
 	urlRequest.Key = key
-	urlRequest.CreatedAt = time.Now().Format(time.RFC3339)
+	urlRequest.Domain = user.Domain
+	urlRequest.CreatedAt = time.Now()
 	urlRequest.IP = c.IP()
-	urlRequest.Slug = functions.GenerateRandomKey(10)
-
-	if err := database.SaveURLToDB(urlRequest); err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedSaveURL)
+	_, err = functions.WithUniqueID(functions.IDURL, func(slug string) error {
+		urlRequest.Slug = slug
+		return database.SaveURLToDB(urlRequest)
+	})
+	if err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedSaveURL, constants.MessageFailedSaveURL)
 	}
 
 	return c.JSON(fiber.Map{
@@ -60,47 +65,50 @@ func PostNewURL(c *fiber.Ctx) error {
 func PutUpdatedURLSlug(c *fiber.Ctx) error {
 	key := c.Get("key")
 	if key == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageAPIKeyRequired)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
 	}
 
 	validUsers, err := database.LoadUsersFromDB()
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedLoadUsers)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedLoadUsers, constants.MessageFailedLoadUsers)
 	}
 
 	if !functions.IsValidKey(key, validUsers) {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageInvalidKey)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
 	}
 
-	oldSlug := c.Params("slug")
+	oldSlug := pathParam(c, "slug")
 	var req struct {
 		NewSlug string `json:"new_slug"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageInvalidRequestBody)
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeInvalidRequestBody, constants.MessageInvalidRequestBody)
 	}
 
 	if req.NewSlug == "" {
-		return errorResponse(c, constants.StatusBadRequest, constants.MessageNewSlugRequired)
+		return validationError(c, constants.CodeNewSlugRequired, constants.MessageNewSlugRequired, requiredField("new_slug"))
 	}
 
 	urlData, err := functions.GetURLBySlug(oldSlug)
-	if err != nil || urlData == nil {
-		return errorResponse(c, constants.StatusNotFound, constants.MessageSlugNotFound)
+	if err != nil || urlData == nil || urlData.DeletedAt != nil {
+		return errorResponse(c, constants.StatusNotFound, constants.CodeSlugNotFound, constants.MessageSlugNotFound)
 	}
 
 	if urlData.Key != key {
-		return errorResponse(c, constants.StatusForbidden, constants.MessageSlugUnauthorized)
+		return errorResponse(c, constants.StatusForbidden, constants.CodeSlugUnauthorized, constants.MessageSlugUnauthorized)
 	}
 
 	existing, _ := functions.GetURLBySlug(req.NewSlug)
 	if existing != nil {
-		return errorResponse(c, constants.StatusConflict, constants.MessageSlugExists)
+		return errorResponse(c, constants.StatusConflict, constants.CodeSlugExists, constants.MessageSlugExists)
 	}
 
 	if err := functions.UpdateURLSlug(oldSlug, req.NewSlug); err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageSlugFailed)
+		if database.IsDuplicateKey(err) {
+			return errorResponse(c, constants.StatusConflict, constants.CodeSlugExists, constants.MessageSlugExists)
+		}
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeSlugFailed, constants.MessageSlugFailed)
 	}
 
 	return c.JSON(fiber.Map{
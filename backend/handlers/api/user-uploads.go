@@ -1,7 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"tritan.dev/image-uploader/constants"
 	"tritan.dev/image-uploader/database"
 )
@@ -9,12 +15,12 @@ import (
 func GetUploadsByToken(c *fiber.Ctx) error {
 	key := c.Get("key")
 	if key == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageAPIKeyRequired)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
 	}
 
 	validUsers, err := database.LoadUsersFromDB()
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedLoadUsers)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedLoadUsers, constants.MessageFailedLoadUsers)
 	}
 
 	var displayName string
@@ -26,12 +32,20 @@ func GetUploadsByToken(c *fiber.Ctx) error {
 	}
 
 	if displayName == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageInvalidKey)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
+	}
+
+	query, err := getListQuery(c, key, database.ValidUploadSort)
+	if err != nil {
+		return invalidQuery(c, err)
 	}
 
-	matchingLogs, err := database.LoadUploadsFromDB(key)
+	matchingLogs, page, err := database.ListUploads(query)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		return validationError(c, constants.CodeInvalidCursor, constants.MessageInvalidCursor, invalidField("cursor"))
+	}
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedFetchUploads)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedFetchUploads, constants.MessageFailedFetchUploads)
 	}
 
 	for i := range matchingLogs {
@@ -40,7 +54,72 @@ func GetUploadsByToken(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"status":  constants.StatusOK,
-		"uploads": matchingLogs,
+		"status":      constants.StatusOK,
+		"uploads":     matchingLogs,
+		"total":       page.Total,
+		"next_cursor": page.NextCursor,
+		"has_more":    page.HasMore,
 	})
 }
+
+// pathParam returns a route parameter decoded, since upload names and slugs
+// with emoji or zero-width characters arrive percent-encoded.
+func pathParam(c *fiber.Ctx, name string) string {
+	value := c.Params(name)
+	if decoded, err := url.PathUnescape(value); err == nil {
+		return decoded
+	}
+	return value
+}
+
+// findUpload resolves an upload reference from a request: an upload ID, or a
+// name with or without its extension. Names are only unique per domain, so
+// the upload owned by key wins when several share one.
+func findUpload(ref, key string) (database.UploadEntry, error) {
+	if id, err := primitive.ObjectIDFromHex(ref); err == nil {
+		if upload, err := database.GetUploadByID(id); err == nil {
+			return upload, nil
+		}
+	}
+
+	upload, err := database.GetUploadByName(ref, key, "")
+	if err != nil && path.Ext(ref) != "" {
+		upload, err = database.GetUploadByName(strings.TrimSuffix(ref, path.Ext(ref)), key, "")
+	}
+	return upload, err
+}
+
+// requireOwnedUpload resolves the :id upload and checks it belongs to the
+// caller's key, writing the error response itself when it does not.
+func requireOwnedUpload(c *fiber.Ctx) (database.User, database.UploadEntry, bool) {
+	key := c.Get("key")
+	if key == "" {
+		_ = errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
+		return database.User{}, database.UploadEntry{}, false
+	}
+
+	user, err := database.GetUserByKey(key)
+	if err != nil {
+		_ = errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
+		return database.User{}, database.UploadEntry{}, false
+	}
+
+	id := pathParam(c, "id")
+	if id == "" {
+		_ = errorResponse(c, constants.StatusBadRequest, constants.CodeMissingUploadID, constants.MessageMissingUploadID)
+		return database.User{}, database.UploadEntry{}, false
+	}
+
+	upload, err := findUpload(id, key)
+	if err != nil || upload.Trashed() {
+		_ = errorResponse(c, constants.StatusNotFound, constants.CodeUploadNotFound, constants.MessageUploadNotFound)
+		return database.User{}, database.UploadEntry{}, false
+	}
+
+	if upload.Key != key {
+		_ = errorResponse(c, constants.StatusForbidden, constants.CodeForbidden, constants.MessageForbidden)
+		return database.User{}, database.UploadEntry{}, false
+	}
+
+	return user, upload, true
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+
 	"github.com/gofiber/fiber/v2"
 	"tritan.dev/image-uploader/constants"
 	"tritan.dev/image-uploader/database"
@@ -10,16 +12,16 @@ import (
 func GetURLsByToken(c *fiber.Ctx) error {
 	key := c.Get("key")
 	if key == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageAPIKeyRequired)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeAPIKeyRequired, constants.MessageAPIKeyRequired)
 	}
 
 	validUsers, err := database.LoadUsersFromDB()
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedLoadUsers)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedLoadUsers, constants.MessageFailedLoadUsers)
 	}
 
 	if !functions.IsValidKey(key, validUsers) {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageInvalidKey)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
 	}
 
 	var displayName string
@@ -31,12 +33,20 @@ func GetURLsByToken(c *fiber.Ctx) error {
 	}
 
 	if displayName == "" {
-		return errorResponse(c, constants.StatusUnauthorized, constants.MessageInvalidKey)
+		return errorResponse(c, constants.StatusUnauthorized, constants.CodeInvalidKey, constants.MessageInvalidKey)
 	}
 
-	urls, err := database.LoadURLsFromDBByKey(key)
+	query, err := getListQuery(c, key, database.ValidURLSort)
+	if err != nil {
+		return invalidQuery(c, err)
+	}
+
+	urls, page, err := database.ListURLs(query)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		return validationError(c, constants.CodeInvalidCursor, constants.MessageInvalidCursor, invalidField("cursor"))
+	}
 	if err != nil {
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageFailedLoadURLs)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedLoadURLs, constants.MessageFailedLoadURLs)
 	}
 
 	for i := range urls {
@@ -45,7 +55,10 @@ func GetURLsByToken(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"status": constants.StatusOK,
-		"urls":   urls,
+		"status":      constants.StatusOK,
+		"urls":        urls,
+		"total":       page.Total,
+		"next_cursor": page.NextCursor,
+		"has_more":    page.HasMore,
 	})
 }
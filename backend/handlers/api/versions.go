@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"tritan.dev/image-uploader/constants"
+	"tritan.dev/image-uploader/database"
+	"tritan.dev/image-uploader/functions"
+)
+
+type versionResponse struct {
+	database.UploadVersion
+	Current bool   `json:"current"`
+	URL     string `json:"url"`
+}
+
+func versionURL(user database.User, upload database.UploadEntry, version int) string {
+	name := strings.TrimSuffix(upload.FileName, path.Ext(upload.FileName))
+	return fmt.Sprintf("https://%s/i/%s?v=%d", user.Domain, url.PathEscape(name), version)
+}
+
+// PutUploadContent replaces the bytes of an upload while keeping its URL. The
+// new file is sent as the sharex form field, the same as a normal upload.
+func PutUploadContent(c *fiber.Ctx) error {
+	user, upload, ok := requireOwnedUpload(c)
+	if !ok {
+		return nil
+	}
+
+	sharex, err := c.FormFile("sharex")
+	if err != nil {
+		return errorResponse(c, constants.StatusBadRequest, constants.CodeNoFileUploaded, constants.MessageNoFileUploaded)
+	}
+
+	limits := functions.EffectiveLimits(user)
+	if limits.MaxFileSize > 0 && sharex.Size > limits.MaxFileSize {
+		return errorResponse(c, constants.StatusRequestTooLarge, constants.CodeFileTooLarge, constants.MessageFileTooLarge)
+	}
+
+	originalName := ""
+	if !upload.IsEncrypted() {
+		// The public name keeps its extension, so the content type served
+		// for it has to stay the same as well.
+		if !strings.EqualFold(path.Ext(sharex.Filename), path.Ext(upload.FileName)) {
+			return errorResponse(c, constants.StatusBadRequest, constants.CodeVersionTypeMismatch, constants.MessageVersionTypeMismatch)
+		}
+		originalName = sanitizeFileName(sharex.Filename)
+		if len(originalName) > maxOriginalNameLength {
+			originalName = ""
+		}
+	}
+
+	file, err := sharex.Open()
+	if err != nil {
+		log.Printf("Error opening file: %v\n", err)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeUploadFailed, constants.MessageUploadFailed)
+	}
+	defer file.Close()
+
+	hash := ""
+	if !upload.IsEncrypted() {
+		if hash, err = functions.HashObject(file); err != nil {
+			log.Printf("Error hashing file: %v\n", err)
+			return errorResponse(c, constants.StatusInternalServerError, constants.CodeUploadFailed, constants.MessageUploadFailed)
+		}
+	}
+
+	reserved, err := database.ReserveBytes(user.Key, sharex.Size, limits.MaxBytes)
+	if err != nil {
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeUploadFailed, constants.MessageUploadFailed)
+	}
+	if !reserved {
+		return errorResponse(c, constants.StatusInsufficientStorage, constants.CodeQuotaExceeded, constants.MessageQuotaExceeded)
+	}
+
+	objectOptions := functions.S3ObjectOptions{Public: !upload.StoredPrivately()}
+	if upload.IsEncrypted() {
+		objectOptions.ContentType = "application/octet-stream"
+		objectOptions.ContentDisposition = "attachment"
+	}
+
+	freed, err := functions.ReplaceUploadContent(&upload, file, sharex.Size, hash, originalName, objectOptions)
+	if err != nil {
+		if err := database.AdjustUsage(user.Key, -sharex.Size, 0); err != nil {
+			log.Printf("Error releasing usage for %s: %v\n", user.Key, err)
+		}
+		if errors.Is(err, database.ErrVersionConflict) {
+			return errorResponse(c, constants.StatusConflict, constants.CodeVersionConflict, constants.MessageVersionConflict)
+		}
+		log.Printf("Error replacing content of %s: %v\n", upload.FileName, err)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedToUploadToS3, constants.MessageFailedToUploadToS3)
+	}
+
+	if freed > 0 {
+		if err := database.AdjustUsage(user.Key, -freed, 0); err != nil {
+			log.Printf("Error releasing usage for %s: %v\n", user.Key, err)
+		}
+	}
+
+	log.Printf("%s replaced %s with version %d.\n", user.Key, upload.FileName, upload.Version)
+
+	name := strings.TrimSuffix(upload.FileName, path.Ext(upload.FileName))
+	return c.JSON(fiber.Map{
+		"status":  constants.StatusOK,
+		"message": constants.MessageFileReplaced,
+		"url":     fmt.Sprintf("https://%s/i/%s", user.Domain, url.PathEscape(name)),
+		"version": upload.Version,
+	})
+}
+
+func GetUploadVersions(c *fiber.Ctx) error {
+	user, upload, ok := requireOwnedUpload(c)
+	if !ok {
+		return nil
+	}
+
+	current := upload.CurrentVersionInfo()
+	versions := []versionResponse{{current, true, versionURL(user, upload, current.Version)}}
+	for _, v := range upload.Versions {
+		versions = append(versions, versionResponse{v, false, versionURL(user, upload, v.Version)})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].CreatedAt.After(versions[j].CreatedAt) })
+
+	return c.JSON(fiber.Map{
+		"status":   constants.StatusOK,
+		"current":  current.Version,
+		"versions": versions,
+	})
+}
+
+func PostUploadRollback(c *fiber.Ctx) error {
+	_, upload, ok := requireOwnedUpload(c)
+	if !ok {
+		return nil
+	}
+
+	version, err := c.ParamsInt("version")
+	if err != nil {
+		return validationError(c, constants.CodeInvalidRequest, constants.MessageInvalidRequest, invalidField("version"))
+	}
+
+	if target, ok := upload.AtVersion(version); !ok || target.ShownVersion == 0 {
+		return errorResponse(c, constants.StatusNotFound, constants.CodeVersionNotFound, constants.MessageVersionNotFound)
+	}
+
+	if err := functions.RollbackUpload(&upload, version); err != nil {
+		if errors.Is(err, database.ErrVersionConflict) {
+			return errorResponse(c, constants.StatusConflict, constants.CodeVersionConflict, constants.MessageVersionConflict)
+		}
+		log.Printf("Error rolling back %s to version %d: %v\n", upload.FileName, version, err)
+		return errorResponse(c, constants.StatusInternalServerError, constants.CodeFailedUpdateUpload, constants.MessageFailedUpdateUpload)
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  constants.StatusOK,
+		"message": constants.MessageVersionRestored,
+		"version": upload.Version,
+	})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"tritan.dev/image-uploader/constants"
+	"tritan.dev/image-uploader/database"
+	"tritan.dev/image-uploader/functions"
+)
+
+// ownerRequest reports whether the request carries the API key of the
+// upload's owner, as API clients fetching their own uploads do.
+func ownerRequest(c *fiber.Ctx, uploadEntry database.UploadEntry) bool {
+	key := c.Get("key")
+	return key != "" && key == uploadEntry.Key
+}
+
+// shareToken reports whether the caller may see a private upload: its owner
+// by API key, or anyone with a signed share link. Browsers send no key, so
+// owners viewing pages create a share link too. The token is returned so it
+// can be carried over to the raw and unlock URLs.
+func shareToken(c *fiber.Ctx, uploadEntry database.UploadEntry) (string, bool) {
+	if uploadEntry.Visibility != constants.VisibilityPrivate || ownerRequest(c, uploadEntry) {
+		return "", true
+	}
+
+	token := c.Query("share")
+	if token != "" && functions.VerifyToken(functions.ShareSubject(uploadEntry), token) {
+		return token, true
+	}
+
+	return "", false
+}
+
+// accessQuery builds the query string that lets follow-up requests for the
+// same upload pass the share and unlock checks again, and stay on the same
+// version when an earlier one is being viewed.
+func accessQuery(share, unlock string, version int) string {
+	query := url.Values{}
+	if version != 0 {
+		query.Set("v", strconv.Itoa(version))
+	}
+	if share != "" {
+		query.Set("share", share)
+	}
+	if unlock != "" {
+		query.Set("token", unlock)
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
+// requestedVersion applies the ?v= query to an upload. It reports false when
+// the version does not exist.
+func requestedVersion(c *fiber.Ctx, uploadEntry database.UploadEntry) (database.UploadEntry, bool) {
+	raw := c.Query("v")
+	if raw == "" {
+		return uploadEntry, true
+	}
+
+	version, err := strconv.Atoi(raw)
+	if err != nil {
+		return uploadEntry, false
+	}
+	return uploadEntry.AtVersion(version)
+}
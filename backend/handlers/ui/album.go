@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/constants"
+	"tritan.dev/image-uploader/database"
+)
+
+type albumItem struct {
+	Name    string
+	PageURL string
+	FullURL string
+}
+
+// DisplayAlbum renders the public gallery for an album. Uploads that are not
+// publicly readable (private, password-protected, encrypted) are left out.
+func DisplayAlbum(c *fiber.Ctx) error {
+	album, err := database.GetAlbumByID(c.Params("id"))
+	if err != nil {
+		return errorResponse(c, constants.StatusNotFound, constants.MessageAlbumNotFound)
+	}
+
+	uploads, err := database.LoadUploadsByIDs(album.Files)
+	if err != nil {
+		log.Printf("Error loading uploads for album %s: %v\n", album.ID, err)
+		return errorResponse(c, constants.StatusInternalServerError, constants.MessageInternalError)
+	}
+
+	byID := make(map[string]database.UploadEntry, len(uploads))
+	for _, upload := range uploads {
+		byID[upload.ID.Hex()] = upload
+	}
+
+	displayName := ""
+	if owner, err := database.GetUserByKey(album.Key); err == nil {
+		displayName = owner.DisplayName
+	}
+
+	bucket := config.AppConfigInstance.S3_BucketName
+	items := []albumItem{}
+	coverURL := ""
+	for _, uploadID := range album.Files {
+		upload, ok := byID[uploadID]
+		if !ok || upload.StoredPrivately() || upload.IsEncrypted() {
+			continue
+		}
+
+		item := albumItem{
+			Name:    upload.FileName,
+			PageURL: "/i/" + url.PathEscape(strings.TrimSuffix(upload.FileName, path.Ext(upload.FileName))),
+			FullURL: fmt.Sprintf("https://%s/%s/%s", config.AppConfigInstance.S3_PubURL, bucket, upload.ObjectKey()),
+		}
+		items = append(items, item)
+
+		if coverURL == "" || uploadID == album.Cover {
+			coverURL = item.FullURL
+		}
+	}
+
+	data := map[string]interface{}{
+		"Data": map[string]string{
+			"Title":       album.Title,
+			"Description": album.Description,
+			"DisplayName": displayName,
+			"CoverURL":    coverURL,
+			"PageURL":     fmt.Sprintf("%s/a/%s", c.BaseURL(), album.ID),
+			"Count":       fmt.Sprintf("%d", len(items)),
+		},
+		"Items": items,
+	}
+	return c.Render("./pages/album.html", data)
+}
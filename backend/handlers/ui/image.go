@@ -3,8 +3,7 @@ package handlers
 import (
 	"fmt"
 	"log"
-	"path"
-	"strings"
+	"net/url"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -25,10 +24,23 @@ func errorResponse(c *fiber.Ctx, status int, message string) error {
 }
 
 func DisplayImage(c *fiber.Ctx) error {
-	fileWithExtension := c.Params("file")
-	fileWithoutExtension := strings.TrimSuffix(fileWithExtension, path.Ext(fileWithExtension))
+	fileWithExtension := fileParam(c)
 	log.Printf("Requested file: %s\n", fileWithExtension)
 
+	uploadEntry, err := findUploadEntry(c, fileWithExtension)
+	if err != nil {
+		if redirected, err := redirectRenamed(c, fileWithExtension, ""); redirected {
+			return err
+		}
+		log.Printf("Image not found: %s\n", fileWithExtension)
+		return errorResponse(c, constants.StatusNotFound, constants.MessageMissingContent)
+	}
+
+	uploadEntry, ok := requestedVersion(c, uploadEntry)
+	if !ok {
+		return errorResponse(c, constants.StatusNotFound, constants.MessageMissingContent)
+	}
+
 	s3Config := &aws.Config{
 		Credentials:      credentials.NewStaticCredentials(config.AppConfigInstance.S3_KeyID, config.AppConfigInstance.S3_AppKey, ""),
 		Endpoint:         aws.String("http://" + config.AppConfigInstance.S3_RegionURL),
@@ -45,78 +57,86 @@ func DisplayImage(c *fiber.Ctx) error {
 	s3Client := s3.New(newSession)
 	bucket := config.AppConfigInstance.S3_BucketName
 
+	// Deduplicated uploads share one object, so the bucket key can differ
+	// from the public name.
+	objectKey := uploadEntry.ObjectKey()
 	headObjectOutput, err := s3Client.HeadObject(&s3.HeadObjectInput{
 		Bucket: aws.String(bucket),
-		Key:    aws.String(fileWithExtension),
+		Key:    aws.String(objectKey),
 	})
+	if err != nil {
+		log.Printf("Object missing for %s: %v\n", uploadEntry.FileName, err)
+		return errorResponse(c, constants.StatusNotFound, constants.MessageMissingContent)
+	}
+
+	fullURL := fmt.Sprintf("https://%s/%s/%s", config.AppConfigInstance.S3_PubURL, bucket, objectKey)
+	uploadTime := headObjectOutput.LastModified.Format(time.RFC1123)
 
-	if err == nil {
-		fullURL := fmt.Sprintf("https://%s/%s/%s", config.AppConfigInstance.S3_PubURL, bucket, fileWithExtension)
-		uploadTime := headObjectOutput.LastModified.Format(time.RFC1123)
+	return renderUpload(c, uploadEntry, fullURL, uploadTime)
+}
+
+func renderUpload(c *fiber.Ctx, uploadEntry database.UploadEntry, fullURL, uploadTime string) error {
+	share, ok := shareToken(c, uploadEntry)
+	if !ok {
+		return errorResponse(c, constants.StatusNotFound, constants.MessageMissingContent)
+	}
 
-		uploadEntry, err := database.GetUploadEntryByFileName(fileWithExtension)
-		if err != nil {
-			log.Printf("Error fetching upload entry from DB: %v\n", err)
-			return errorResponse(c, constants.StatusInternalServerError, constants.MessageInternalError)
+	unlock := ""
+	if uploadEntry.Protected {
+		if unlock, ok = unlockToken(c, uploadEntry); !ok {
+			return renderPasswordForm(c, uploadEntry, share, constants.StatusOK, "")
 		}
+	}
+
+	rawURL := fmt.Sprintf("%s/i/%s/raw%s", c.BaseURL(), url.PathEscape(uploadEntry.FileName), accessQuery(share, unlock, uploadEntry.ShownVersion))
+	if uploadEntry.StoredPrivately() {
+		fullURL = rawURL
+	}
 
-		database.IncrementViewCount(uploadEntry.FileName)
+	noIndex := ""
+	if uploadEntry.Visibility == constants.VisibilityUnlisted || uploadEntry.StoredPrivately() || uploadEntry.IsEncrypted() {
+		c.Set("X-Robots-Tag", "noindex")
+		noIndex = "true"
+	}
 
-		fileSizeMB := float64(uploadEntry.Metadata.FileSize) / (1024 * 1024)
+	database.IncrementViewCount(uploadEntry.ID)
+	fileSizeMB := float64(uploadEntry.Metadata.FileSize) / (1024 * 1024)
 
-		log.Printf("Image found: %s\n", fullURL)
+	if uploadEntry.IsEncrypted() {
 		data := map[string]interface{}{
 			"Data": map[string]string{
-				"fullURL":     fullURL,
-				"Name":        fileWithExtension,
+				"RawURL":      rawURL,
+				"Name":        uploadEntry.FileName,
 				"UploadTime":  uploadTime,
 				"DisplayName": uploadEntry.DisplayName,
-				"Views":       fmt.Sprintf("%d", uploadEntry.Metadata.Views),
 				"FileSizeMB":  fmt.Sprintf("%.2f MB", fileSizeMB),
+				"Views":       fmt.Sprintf("%d", uploadEntry.Metadata.Views),
+				"Cipher":      uploadEntry.Cipher,
 			},
 		}
-		return c.Render("./pages/image.html", data)
+		return c.Render("./pages/encrypted.html", data)
 	}
 
-	resp, err := s3Client.ListObjectsV2(&s3.ListObjectsV2Input{
-		Bucket: aws.String(bucket),
-		Prefix: aws.String(fileWithoutExtension),
-	})
-	if err != nil {
-		log.Printf("Error listing objects in S3: %v\n", err)
-		return errorResponse(c, constants.StatusInternalServerError, constants.MessageInternalError)
+	downloadURL := rawURL + "?download=true"
+	if accessQuery(share, unlock, uploadEntry.ShownVersion) != "" {
+		downloadURL = rawURL + "&download=true"
 	}
 
-	for _, obj := range resp.Contents {
-		objKeyWithoutExt := strings.TrimSuffix(path.Base(*obj.Key), path.Ext(path.Base(*obj.Key)))
-		if objKeyWithoutExt == fileWithoutExtension {
-			fullURL := fmt.Sprintf("https://%s/%s/%s", config.AppConfigInstance.S3_PubURL, bucket, *obj.Key)
-			uploadTime := obj.LastModified.Format(time.RFC1123)
-
-			uploadEntry, err := database.GetUploadEntryByFileName(*obj.Key)
-			if err != nil {
-				log.Printf("Error fetching upload entry from DB: %v\n", err)
-				return errorResponse(c, constants.StatusInternalServerError, constants.MessageInternalError)
-			}
-
-			database.IncrementViewCount(uploadEntry.FileName)
-			fileSizeMB := float64(uploadEntry.Metadata.FileSize) / (1024 * 1024)
-
-			log.Printf("Image found: %s\n", fullURL)
-			data := map[string]interface{}{
-				"Data": map[string]string{
-					"fullURL":     fullURL,
-					"Name":        *obj.Key,
-					"UploadTime":  uploadTime,
-					"DisplayName": uploadEntry.DisplayName,
-					"FileSizeMB":  fmt.Sprintf("%.2f MB", fileSizeMB),
-					"Views":       fmt.Sprintf("%d", uploadEntry.Metadata.Views),
-				},
-			}
-			return c.Render("./pages/image.html", data)
-		}
+	log.Printf("Image found: %s\n", fullURL)
+	data := map[string]interface{}{
+		"Data": map[string]string{
+			"fullURL":      fullURL,
+			"Name":         uploadEntry.FileName,
+			"DownloadURL":  downloadURL,
+			"DownloadName": uploadEntry.DownloadName(),
+			"Title":        uploadEntry.Title,
+			"Description":  uploadEntry.Description,
+			"UploadTime":   uploadTime,
+			"DisplayName":  uploadEntry.DisplayName,
+			"FileSizeMB":   fmt.Sprintf("%.2f MB", fileSizeMB),
+			"Views":        fmt.Sprintf("%d", uploadEntry.Metadata.Views),
+			"NoIndex":      noIndex,
+		},
 	}
-
-	log.Printf("Image not found: %s\n", fileWithExtension)
-	return errorResponse(c, constants.StatusNotFound, "Content not found")
+	return c.Render("./pages/image.html", data)
 }
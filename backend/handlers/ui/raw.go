@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+
+	"github.com/gofiber/fiber/v2"
+	"tritan.dev/image-uploader/constants"
+	"tritan.dev/image-uploader/functions"
+)
+
+// ServeRawFile proxies the stored bytes of an upload. Private and protected
+// uploads are stored without a public ACL, so this is the only way to read them.
+func ServeRawFile(c *fiber.Ctx) error {
+	uploadEntry, err := findUploadEntry(c, fileParam(c))
+	if err != nil {
+		if redirected, err := redirectRenamed(c, fileParam(c), "/raw"); redirected {
+			return err
+		}
+		return errorResponse(c, constants.StatusNotFound, constants.MessageMissingContent)
+	}
+
+	uploadEntry, ok := requestedVersion(c, uploadEntry)
+	if !ok {
+		return errorResponse(c, constants.StatusNotFound, constants.MessageMissingContent)
+	}
+
+	if _, ok := shareToken(c, uploadEntry); !ok {
+		return errorResponse(c, constants.StatusNotFound, constants.MessageMissingContent)
+	}
+
+	if uploadEntry.Protected && !ownerRequest(c, uploadEntry) {
+		if _, ok := unlockToken(c, uploadEntry); !ok {
+			return errorResponse(c, constants.StatusUnauthorized, constants.MessageUploadLocked)
+		}
+	}
+
+	if uploadEntry.StoredPrivately() {
+		c.Set(fiber.HeaderCacheControl, "private, no-store")
+	}
+
+	body, size, err := functions.OpenObject(uploadEntry)
+	if err != nil {
+		log.Printf("Error fetching %s from S3: %v\n", uploadEntry.FileName, err)
+		return errorResponse(c, constants.StatusNotFound, constants.MessageMissingContent)
+	}
+
+	if uploadEntry.IsEncrypted() {
+		c.Set(fiber.HeaderContentType, fiber.MIMEOctetStream)
+		c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	} else {
+		c.Type(path.Ext(uploadEntry.FileName))
+		disposition := "inline"
+		if c.QueryBool("download") {
+			disposition = "attachment"
+		}
+		c.Set(fiber.HeaderContentDisposition, contentDisposition(disposition, uploadEntry.DownloadName()))
+	}
+	return c.SendStream(body, int(size))
+}
+
+// contentDisposition names the file in both the plain and RFC 5987 forms so
+// non-ASCII original names survive in every browser.
+func contentDisposition(disposition, name string) string {
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, asciiFileName(name), url.PathEscape(name))
+}
+
+func asciiFileName(name string) string {
+	var ascii []rune
+	for _, r := range name {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			r = '_'
+		}
+		ascii = append(ascii, r)
+	}
+	return string(ascii)
+}
@@ -10,7 +10,7 @@ func RedirectBySlug(c *fiber.Ctx) error {
 	slug := c.Params("slug")
 
 	url, err := database.GetURLBySlug(slug)
-	if err != nil || url == nil {
+	if err != nil || url == nil || url.DeletedAt != nil {
 		return errorResponse(c, constants.StatusNotFound, constants.MessageURLNotFound)
 	}
 
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/mongo"
+	"tritan.dev/image-uploader/constants"
+	"tritan.dev/image-uploader/database"
+	"tritan.dev/image-uploader/functions"
+	"tritan.dev/image-uploader/middleware"
+)
+
+const unlockTTL = 10 * time.Minute
+
+func unlockCookieName(fileName string) string {
+	return "unlock_" + url.QueryEscape(strings.TrimSuffix(fileName, path.Ext(fileName)))
+}
+
+// unlockSubject includes the password hash, so changing or removing the
+// password revokes every unlock token issued for the old one.
+func unlockSubject(uploadEntry database.UploadEntry) string {
+	return "unlock:" + uploadEntry.ID.Hex() + ":" + uploadEntry.PasswordHash
+}
+
+// unlockToken returns the caller's unlock token for a protected upload, taken
+// from the ?token= query or the cookie set by UnlockUpload.
+func unlockToken(c *fiber.Ctx, uploadEntry database.UploadEntry) (string, bool) {
+	for _, token := range []string{c.Query("token"), c.Cookies(unlockCookieName(uploadEntry.FileName))} {
+		if token != "" && functions.VerifyToken(unlockSubject(uploadEntry), token) {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// fileParam returns the :file route parameter decoded, since emoji and
+// zero-width upload names arrive percent-encoded.
+func fileParam(c *fiber.Ctx) string {
+	file := c.Params("file")
+	if decoded, err := url.PathUnescape(file); err == nil {
+		return decoded
+	}
+	return file
+}
+
+// UnlockAttemptKey names the client and the upload an unlock attempt is for,
+// so password guesses can be rate limited per client and upload whichever
+// form of its name is used.
+func UnlockAttemptKey(c *fiber.Ctx) string {
+	file := fileParam(c)
+	return middleware.ByIP(c) + " " + requestDomain(c) + "/" + strings.TrimSuffix(file, path.Ext(file))
+}
+
+// requestDomain is the domain the request was made on, which decides between
+// uploads that share a name on different domains.
+func requestDomain(c *fiber.Ctx) string {
+	host := c.Hostname()
+	if domain, _, err := net.SplitHostPort(host); err == nil {
+		return domain
+	}
+	return host
+}
+
+func findUploadEntry(c *fiber.Ctx, file string) (database.UploadEntry, error) {
+	uploadEntry, err := database.GetUploadByName(file, "", requestDomain(c))
+	if err != nil {
+		uploadEntry, err = database.GetUploadByName(strings.TrimSuffix(file, path.Ext(file)), "", requestDomain(c))
+	}
+	if err == nil && uploadEntry.Trashed() {
+		return database.UploadEntry{}, mongo.ErrNoDocuments
+	}
+	return uploadEntry, err
+}
+
+// redirectRenamed sends requests for the old name of a renamed upload to its
+// current name, keeping the rest of the path and the query. It reports false
+// when file is not a redirected name.
+func redirectRenamed(c *fiber.Ctx, file, suffix string) (bool, error) {
+	name := strings.TrimSuffix(file, path.Ext(file))
+	redirect, err := database.GetUploadRedirect(name, requestDomain(c))
+	if err != nil {
+		return false, nil
+	}
+
+	target := "/i/" + url.PathEscape(strings.TrimSuffix(redirect.FileName, path.Ext(redirect.FileName))) + suffix
+	if query := string(c.Request().URI().QueryString()); query != "" {
+		target += "?" + query
+	}
+	return true, c.Redirect(target, fiber.StatusFound)
+}
+
+func renderPasswordForm(c *fiber.Ctx, uploadEntry database.UploadEntry, share string, status int, message string) error {
+	data := map[string]interface{}{
+		"Data": map[string]string{
+			"Name":        uploadEntry.FileName,
+			"DisplayName": uploadEntry.DisplayName,
+			"Action":      fmt.Sprintf("/i/%s/unlock%s", url.PathEscape(uploadEntry.FileName), accessQuery(share, "", uploadEntry.ShownVersion)),
+			"Error":       message,
+		},
+	}
+	return c.Status(status).Render("./pages/password.html", data)
+}
+
+func UnlockUpload(c *fiber.Ctx) error {
+	uploadEntry, err := findUploadEntry(c, fileParam(c))
+	if err != nil {
+		return errorResponse(c, constants.StatusNotFound, constants.MessageMissingContent)
+	}
+
+	uploadEntry, ok := requestedVersion(c, uploadEntry)
+	if !ok {
+		return errorResponse(c, constants.StatusNotFound, constants.MessageMissingContent)
+	}
+
+	share, ok := shareToken(c, uploadEntry)
+	if !ok {
+		return errorResponse(c, constants.StatusNotFound, constants.MessageMissingContent)
+	}
+
+	redirect := "/i/" + url.PathEscape(uploadEntry.FileName) + accessQuery(share, "", uploadEntry.ShownVersion)
+	if !uploadEntry.Protected {
+		return c.Redirect(redirect, fiber.StatusSeeOther)
+	}
+
+	if !functions.CheckPassword(uploadEntry.PasswordHash, c.FormValue("password")) {
+		log.Printf("Failed unlock attempt for %s from %s\n", uploadEntry.FileName, c.IP())
+		return renderPasswordForm(c, uploadEntry, share, constants.StatusUnauthorized, constants.MessageWrongPassword)
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     unlockCookieName(uploadEntry.FileName),
+		Value:    functions.SignToken(unlockSubject(uploadEntry), unlockTTL),
+		Path:     "/i/",
+		Expires:  time.Now().Add(unlockTTL),
+		HTTPOnly: true,
+		Secure:   c.Protocol() == "https",
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	return c.Redirect(redirect, fiber.StatusSeeOther)
+}
@@ -11,14 +11,28 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 
 	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/database"
+	"tritan.dev/image-uploader/functions"
+	"tritan.dev/image-uploader/middleware"
 	"tritan.dev/image-uploader/router"
 
 	"github.com/getsentry/sentry-go"
 )
 
+// main starts the server, or runs one of the commands in cli.go when given
+// its name, e.g. "./main user create -admin".
 func main() {
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
+	serve()
+}
+
+func serve() {
 	defer func() {
 		if r := recover(); r != nil {
 			sentry.CaptureException(fmt.Errorf("%v", r))
@@ -28,14 +42,37 @@ func main() {
 
 	initSentry()
 
-	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	if err := database.Connect(); err != nil {
+		log.Fatalf("Failed to start: %v", err)
+	}
+
+	if err := functions.CheckSigningSecret(); err != nil {
+		log.Fatalf("Refusing to start: %v; set it to a long random string in config.go", err)
+	}
+
+	if config.AppConfigInstance.Database_AutoMigrate {
+		if _, err := database.RunMigrations(); err != nil {
+			log.Printf("Failed to apply migrations: %v", err)
+		}
+	}
+
+	app := fiber.New(fiber.Config{
+		DisableStartupMessage:   true,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          config.AppConfigInstance.Server_TrustedProxies,
+		ProxyHeader:             config.AppConfigInstance.Server_ProxyHeader,
+		EnableIPValidation:      true,
+	})
 	port := config.AppConfigInstance.Port
 	address := fmt.Sprintf(":%d", port)
 
 	templates := loadTemplates()
 
-	app.Use(logger.New())
-	app.Use(cors.New())
+	app.Use(requestid.New())
+	app.Use(logger.New(logger.Config{
+		Format: "[${time}] ${locals:requestid} ${status} - ${latency} ${method} ${path}\n",
+	}))
+	app.Use(cors.New(cors.Config{ExposeHeaders: fiber.HeaderXRequestID + ", " + middleware.HeaderReplayed}))
 	app.Use(func(c *fiber.Ctx) error {
 		c.Locals("templates", templates)
 		return c.Next()
@@ -46,6 +83,13 @@ func main() {
 		fmt.Printf("Error setting up routes: %v\n", err)
 		return
 	}
+	for _, problem := range router.CheckRoutes(app) {
+		log.Printf("openapi.json is out of date: %s", problem)
+	}
+
+	functions.StartTrashPurger()
+	functions.StartOutboxWorker()
+	functions.StartJobWorkers()
 
 	log.Printf("Listening for requests on port %d", port)
 	if err := app.Listen(address); err != nil {
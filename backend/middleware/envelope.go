@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"tritan.dev/image-uploader/constants"
+)
+
+// RequestID returns the ID the requestid middleware gave the request, which
+// is also sent back in the X-Request-ID header.
+func RequestID(c *fiber.Ctx) string {
+	if id, ok := c.Locals("requestid").(string); ok {
+		return id
+	}
+	return c.GetRespHeader(fiber.HeaderXRequestID)
+}
+
+// APIv1 serves the same handlers as /api under /api/v1, rewriting their JSON
+// responses into one shape. Successes become {"data", "message",
+// "request_id"}, with the legacy status field dropped; failures become
+// {"error": {"code", "message", "fields", "details"}, "request_id"}, where
+// code is the one the handler set with its error, or else one for the status.
+// Responses that are not JSON, such as
+// downloads and 204s, are passed through untouched.
+func APIv1(c *fiber.Ctx) error {
+	c.Locals(constants.APIPrefixLocal, "/api/v1")
+	if err := c.Next(); err != nil {
+		status, message := constants.StatusInternalServerError, constants.MessageInternalError
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status, message = fiberErr.Code, fiberErr.Message
+		} else {
+			log.Printf("Unhandled error on %s %s: %v\n", c.Method(), c.Path(), err)
+		}
+		return writeEnvelope(c, status, fiber.Map{
+			"error": fiber.Map{
+				"code":    constants.ErrorCode(status),
+				"message": message,
+			},
+		})
+	}
+
+	resp := c.Response()
+	body := resp.Body()
+	if len(body) == 0 || len(resp.Header.Peek(fiber.HeaderContentDisposition)) > 0 ||
+		!strings.HasPrefix(string(resp.Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil
+	}
+
+	status := resp.StatusCode()
+	fields, _ := decoded.(map[string]interface{})
+	if fields != nil {
+		if code, ok := fields["status"].(json.Number); ok && code.String() == strconv.Itoa(status) {
+			delete(fields, "status")
+		}
+	}
+
+	if status >= 400 {
+		return writeEnvelope(c, status, fiber.Map{"error": errorBody(errorCode(c, status), status, decoded, fields)})
+	}
+
+	envelope := fiber.Map{"data": decoded}
+	if fields != nil {
+		if message, ok := fields["message"].(string); ok {
+			envelope["message"] = message
+			delete(fields, "message")
+		}
+	}
+	return writeEnvelope(c, status, envelope)
+}
+
+// errorBody builds the error object of a failure envelope. Keys other than
+// message and fields, such as a failed job's error text, go under details.
+func errorBody(code string, status int, decoded interface{}, fields map[string]interface{}) fiber.Map {
+	if fields == nil {
+		return fiber.Map{
+			"code":    code,
+			"message": utils.StatusMessage(status),
+			"details": decoded,
+		}
+	}
+
+	message, _ := fields["message"].(string)
+	body := fiber.Map{
+		"code":    code,
+		"message": message,
+	}
+	delete(fields, "message")
+	if list, ok := fields["fields"]; ok {
+		body["fields"] = list
+		delete(fields, "fields")
+	}
+	if len(fields) > 0 {
+		body["details"] = fields
+	}
+	return body
+}
+
+// errorCode returns the code the failed request set, falling back to one for
+// its status.
+func errorCode(c *fiber.Ctx, status int) string {
+	if code, ok := c.Locals(constants.ErrorCodeLocal).(string); ok && code != "" {
+		return code
+	}
+	return constants.ErrorCode(status)
+}
+
+func writeEnvelope(c *fiber.Ctx, status int, envelope fiber.Map) error {
+	envelope["request_id"] = RequestID(c)
+	return c.Status(status).JSON(envelope)
+}
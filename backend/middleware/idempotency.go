@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"mime/multipart"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/mongo"
+	"tritan.dev/image-uploader/config"
+	"tritan.dev/image-uploader/constants"
+	"tritan.dev/image-uploader/database"
+)
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	HeaderReplayed       = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+
+	// idempotencyLease is how long a request may hold its key before a retry
+	// assumes the server running it died and takes the key over.
+	idempotencyLease = time.Hour
+)
+
+// Idempotent makes next safe to retry. The first request with a given
+// Idempotency-Key header has its response stored for
+// Idempotency_WindowHours, and retries with the same key and the same request
+// get that response back, marked with Idempotent-Replayed, instead of running
+// next again. Only successes and rejected input (400 and 422) are stored;
+// other failures, such as a conflict or a full quota, may go away, so the key
+// is released for the retry. Reusing a key for a different request is
+// rejected with 422, and retrying while the first request is still running
+// with 409. Keys are per API key, and scope separates the endpoints, so the
+// /api and /api/v1 copies of a route share their keys. Requests without the
+// header, or with a missing or unknown API key, run normally and are left to
+// next to reject.
+func Idempotent(scope string, next fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key, apiKey := c.Get(HeaderIdempotencyKey), c.Get("key")
+		window := time.Duration(config.AppConfigInstance.Idempotency_WindowHours) * time.Hour
+		if key == "" || apiKey == "" || window <= 0 {
+			return next(c)
+		}
+		if !validIdempotencyKey(key) {
+			c.Locals(constants.ErrorCodeLocal, constants.CodeInvalidIdempotencyKey)
+			return c.Status(constants.StatusBadRequest).JSON(fiber.Map{
+				"status":  constants.StatusBadRequest,
+				"message": constants.MessageInvalidIdempotencyKey,
+				"fields":  []fiber.Map{{"field": HeaderIdempotencyKey, "code": constants.FieldInvalid}},
+			})
+		}
+
+		// Made-up API keys must not be able to fill the collection, or make
+		// us hash large bodies, so only real users' requests are recorded.
+		if _, err := database.GetUserByKey(apiKey); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return next(c)
+			}
+			log.Printf("Error loading user for idempotency key: %v\n", err)
+			return idempotencyError(c, constants.StatusInternalServerError, constants.CodeFailedIdempotency, constants.MessageFailedIdempotency)
+		}
+
+		fingerprint, err := requestFingerprint(c, scope)
+		if err != nil {
+			// The handler reports a body it cannot read better than we can.
+			return next(c)
+		}
+
+		now := time.Now()
+		request, reserved, err := database.ReserveIdempotencyKey(database.IdempotentRequest{
+			APIKey:      apiKey,
+			Key:         key,
+			Fingerprint: fingerprint,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(idempotencyLease),
+		})
+		if err == nil && !reserved && request.ExpiresAt.Before(now) {
+			// Expired, or abandoned mid-request; the TTL monitor only runs
+			// once a minute.
+			if err = database.DeleteIdempotencyKey(apiKey, key, request.CreatedAt); err == nil {
+				request, reserved, err = database.ReserveIdempotencyKey(database.IdempotentRequest{
+					APIKey:      apiKey,
+					Key:         key,
+					Fingerprint: fingerprint,
+					CreatedAt:   now,
+					ExpiresAt:   now.Add(idempotencyLease),
+				})
+			}
+		}
+		if err != nil {
+			log.Printf("Error reserving idempotency key: %v\n", err)
+			return idempotencyError(c, constants.StatusInternalServerError, constants.CodeFailedIdempotency, constants.MessageFailedIdempotency)
+		}
+
+		if !reserved {
+			switch {
+			case request.Fingerprint != fingerprint:
+				return idempotencyError(c, constants.StatusUnprocessable, constants.CodeIdempotencyKeyReused, constants.MessageIdempotencyKeyReused)
+			case request.Status == 0:
+				return idempotencyError(c, constants.StatusConflict, constants.CodeIdempotencyInProgress, constants.MessageIdempotencyInProgress)
+			}
+			c.Set(HeaderReplayed, "true")
+			if request.ErrorCode != "" {
+				c.Locals(constants.ErrorCodeLocal, request.ErrorCode)
+			}
+			c.Set(fiber.HeaderContentType, request.ContentType)
+			return c.Status(request.Status).Send(request.Body)
+		}
+
+		if err := next(c); err != nil {
+			forgetIdempotencyKey(request)
+			return err
+		}
+
+		resp := c.Response()
+		if !replayable(resp.StatusCode()) {
+			forgetIdempotencyKey(request)
+			return nil
+		}
+		body := append([]byte(nil), resp.Body()...)
+		code, _ := c.Locals(constants.ErrorCodeLocal).(string)
+		err = database.CompleteIdempotencyKey(apiKey, key, resp.StatusCode(), code, string(resp.Header.ContentType()), body, time.Now().Add(window))
+		if err != nil {
+			log.Printf("Error storing response for idempotency key: %v\n", err)
+			forgetIdempotencyKey(request)
+		}
+		return nil
+	}
+}
+
+// replayable reports whether a response with status is stored for retries.
+// A retry of a success or of invalid input would get the same answer, while
+// anything else, from a 401 to a server error, is worth running again.
+func replayable(status int) bool {
+	return status < 300 || status == constants.StatusBadRequest || status == constants.StatusUnprocessable
+}
+
+func idempotencyError(c *fiber.Ctx, status int, code, message string) error {
+	c.Locals(constants.ErrorCodeLocal, code)
+	return c.Status(status).JSON(fiber.Map{
+		"status":  status,
+		"message": message,
+	})
+}
+
+func forgetIdempotencyKey(request database.IdempotentRequest) {
+	if err := database.DeleteIdempotencyKey(request.APIKey, request.Key, request.CreatedAt); err != nil {
+		log.Printf("Error releasing idempotency key: %v\n", err)
+	}
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for _, r := range key {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestFingerprint hashes what makes two requests the same: the endpoint,
+// the query string and the body. Multipart bodies are hashed by their fields
+// and file contents rather than their bytes, because clients pick a new
+// boundary for every attempt.
+func requestFingerprint(c *fiber.Ctx, scope string) (string, error) {
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\n%s\n", scope, c.Request().URI().QueryString())
+
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		sum.Write(c.Body())
+		return hex.EncodeToString(sum.Sum(nil)), nil
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range sortedKeys(form.Value) {
+		fmt.Fprintf(sum, "value %q %q\n", name, form.Value[name])
+	}
+	for _, name := range sortedKeys(form.File) {
+		for _, file := range form.File[name] {
+			fmt.Fprintf(sum, "file %q %q %d\n", name, file.Filename, file.Size)
+			if err := hashFile(sum, file); err != nil {
+				return "", err
+			}
+		}
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+func hashFile(sum hash.Hash, file *multipart.FileHeader) error {
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(sum, f)
+	return err
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
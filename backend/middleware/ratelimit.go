@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"strconv"
 	"sync"
 	"time"
 
@@ -8,41 +9,75 @@ import (
 	"tritan.dev/image-uploader/constants"
 )
 
+// RateLimiter allows at most max requests per window for each key that keyOf
+// returns, such as the client IP. Counts are kept in memory, per process.
 type RateLimiter struct {
 	mu        sync.Mutex
-	uploads   map[string]int
+	max       int
+	window    time.Duration
+	keyOf     func(*fiber.Ctx) string
+	counts    map[string]int
 	timestamp map[string]time.Time
+	swept     time.Time
 }
 
-func NewRateLimiter() *RateLimiter {
+func NewRateLimiter(max int, window time.Duration, keyOf func(*fiber.Ctx) string) *RateLimiter {
 	return &RateLimiter{
-		uploads:   make(map[string]int),
+		max:       max,
+		window:    window,
+		keyOf:     keyOf,
+		counts:    make(map[string]int),
 		timestamp: make(map[string]time.Time),
 	}
 }
 
+// ByIP keys a RateLimiter on the client address. c.IP only believes the
+// proxy header on requests from a configured trusted proxy, so clients
+// cannot pick their own key.
+func ByIP(c *fiber.Ctx) string {
+	return c.IP()
+}
+
 func (rl *RateLimiter) Limit(next fiber.Handler) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		ip := c.IP()
-
-		rl.mu.Lock()
-		defer rl.mu.Unlock()
-
-		if count, exists := rl.uploads[ip]; exists {
-			if time.Since(rl.timestamp[ip]) > 30*time.Second {
-				rl.uploads[ip] = 0
-				rl.timestamp[ip] = time.Now()
-			} else if count >= 5 {
-				return c.Status(constants.StatusRateLimitExceeded).JSON(fiber.Map{
-					"status":  constants.StatusRateLimitExceeded,
-					"message": "Rate limit exceeded. Please wait 30 seconds before uploading again.",
-				})
+		if wait, ok := rl.allow(rl.keyOf(c)); !ok {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())+1))
+			c.Locals(constants.ErrorCodeLocal, constants.CodeRateLimited)
+			return c.Status(constants.StatusRateLimitExceeded).JSON(fiber.Map{
+				"status":  constants.StatusRateLimitExceeded,
+				"message": constants.MessageRateLimited,
+			})
+		}
+		return next(c)
+	}
+}
+
+// allow counts a request for key, or reports how long until the key's window
+// resets when it has none left.
+func (rl *RateLimiter) allow(key string) (time.Duration, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(rl.swept) > rl.window {
+		for k, started := range rl.timestamp {
+			if now.Sub(started) > rl.window {
+				delete(rl.counts, k)
+				delete(rl.timestamp, k)
 			}
-		} else {
-			rl.timestamp[ip] = time.Now()
 		}
+		rl.swept = now
+	}
 
-		rl.uploads[ip]++
-		return next(c)
+	started, exists := rl.timestamp[key]
+	if !exists || now.Sub(started) > rl.window {
+		rl.counts[key] = 0
+		rl.timestamp[key] = now
+		started = now
+	}
+	if rl.counts[key] >= rl.max {
+		return rl.window - now.Sub(started), false
 	}
+	rl.counts[key]++
+	return 0, true
 }
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name    string
+		max     int
+		keys    []string
+		allowed []bool
+	}{
+		{"under the limit", 3, []string{"a", "a", "a"}, []bool{true, true, true}},
+		{"over the limit", 2, []string{"a", "a", "a", "a"}, []bool{true, true, false, false}},
+		{"keys counted apart", 1, []string{"a", "b", "a", "b"}, []bool{true, true, false, false}},
+		{"zero allows nothing", 0, []string{"a"}, []bool{false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := NewRateLimiter(tt.max, time.Minute, nil)
+			for i, key := range tt.keys {
+				wait, ok := rl.allow(key)
+				if ok != tt.allowed[i] {
+					t.Fatalf("request %d for %q: allowed = %v, want %v", i+1, key, ok, tt.allowed[i])
+				}
+				if !ok && (wait <= 0 || wait > time.Minute) {
+					t.Errorf("request %d for %q: wait = %v, want within the window", i+1, key, wait)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterWindowResets(t *testing.T) {
+	rl := NewRateLimiter(1, time.Minute, nil)
+	if _, ok := rl.allow("a"); !ok {
+		t.Fatal("first request was limited")
+	}
+	if _, ok := rl.allow("a"); ok {
+		t.Fatal("second request in the window was allowed")
+	}
+
+	// Age the window instead of sleeping through it.
+	rl.timestamp["a"] = time.Now().Add(-2 * time.Minute)
+	rl.timestamp["b"] = time.Now().Add(-2 * time.Minute)
+	rl.counts["b"] = 1
+	rl.swept = time.Time{}
+
+	if _, ok := rl.allow("a"); !ok {
+		t.Error("request after the window was limited")
+	}
+	if _, ok := rl.timestamp["b"]; ok {
+		t.Error("expired key was not swept")
+	}
+}
+
+func TestRateLimiterLimit(t *testing.T) {
+	rl := NewRateLimiter(1, time.Minute, func(c *fiber.Ctx) string { return c.Get("client") })
+	app := fiber.New()
+	app.Get("/", rl.Limit(func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) }))
+
+	tests := []struct {
+		client string
+		status int
+	}{
+		{"a", fiber.StatusNoContent},
+		{"a", fiber.StatusTooManyRequests},
+		{"b", fiber.StatusNoContent},
+	}
+
+	for i, tt := range tests {
+		request := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		request.Header.Set("client", tt.client)
+		resp, err := app.Test(request, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("request %d from %q: answered %d, want %d", i+1, tt.client, resp.StatusCode, tt.status)
+		}
+		if tt.status == fiber.StatusTooManyRequests {
+			if seconds, err := strconv.Atoi(resp.Header.Get(fiber.HeaderRetryAfter)); err != nil || seconds < 1 {
+				t.Errorf("request %d from %q: Retry-After = %q", i+1, tt.client, resp.Header.Get(fiber.HeaderRetryAfter))
+			}
+		}
+	}
+}
+
+func TestByIP(t *testing.T) {
+	tests := []struct {
+		name   string
+		config fiber.Config
+		header string
+		want   string
+	}{
+		{
+			name:   "no trusted proxies ignores the header",
+			config: fiber.Config{EnableTrustedProxyCheck: true, ProxyHeader: "X-Real-IP"},
+			header: "203.0.113.7",
+			want:   "0.0.0.0",
+		},
+		{
+			name:   "trusted proxy supplies the address",
+			config: fiber.Config{EnableTrustedProxyCheck: true, TrustedProxies: []string{"0.0.0.0"}, ProxyHeader: "X-Real-IP"},
+			header: "203.0.113.7",
+			want:   "203.0.113.7",
+		},
+		{
+			name:   "untrusted proxy is ignored",
+			config: fiber.Config{EnableTrustedProxyCheck: true, TrustedProxies: []string{"10.0.0.1"}, ProxyHeader: "X-Real-IP"},
+			header: "203.0.113.7",
+			want:   "0.0.0.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(tt.config)
+			app.Get("/", func(c *fiber.Ctx) error { return c.SendString(ByIP(c)) })
+
+			request := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			request.Header.Set("X-Real-IP", tt.header)
+			request.Header.Set(fiber.HeaderXForwardedFor, "198.51.100.1")
+			resp, err := app.Test(request, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if got := string(body); got != tt.want {
+				t.Errorf("ByIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
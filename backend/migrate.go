@@ -0,0 +1,27 @@
+package main
+
+import (
+	"tritan.dev/image-uploader/database"
+)
+
+// runMigrateCommand handles "migrate" to apply pending migrations and
+// "migrate status" to list them.
+func runMigrateCommand(args []string) int {
+	if len(args) > 0 && args[0] == "status" {
+		states, err := database.MigrationStatus()
+		if err != nil {
+			return fail(err)
+		}
+		return printJSON(states)
+	}
+
+	applied, err := database.RunMigrations()
+	if err != nil {
+		printJSON(map[string]interface{}{"applied": applied})
+		return fail(err)
+	}
+	if applied == nil {
+		applied = []database.AppliedMigration{}
+	}
+	return printJSON(map[string]interface{}{"applied": applied})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"tritan.dev/image-uploader/router"
+)
+
+// runOpenAPICommand prints openapi.json, or with "check" compares it with the
+// registered routes. Any drift makes it exit 1. The responses themselves are
+// checked against the document by the router package's tests.
+func runOpenAPICommand(args []string) int {
+	if len(args) == 0 {
+		if _, err := os.Stdout.Write(router.OpenAPISpec); err != nil {
+			return fail(err)
+		}
+		return 0
+	}
+	if args[0] != "check" {
+		return fail(fmt.Errorf("unknown openapi command %q, expected check", args[0]))
+	}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	if err := router.SetupRoutes(app); err != nil {
+		return fail(err)
+	}
+
+	problems := router.CheckRoutes(app)
+	code := printJSON(map[string]interface{}{
+		"ok":       len(problems) == 0,
+		"problems": problems,
+	})
+	if len(problems) > 0 {
+		return 1
+	}
+	return code
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	"tritan.dev/image-uploader/functions"
+)
+
+// runReconcileCommand compares the bucket with the uploads collection and
+// prints the report as JSON. Like the admin endpoint it only reports unless
+// -dry-run=false is given.
+func runReconcileCommand(args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", true, "only report, change nothing")
+	orphans := flags.String("orphans", "", "what to do with objects no upload refers to: delete or import")
+	dangling := flags.String("dangling", "", "what to do with uploads whose object is gone: mark or delete")
+	fixSizes := flags.Bool("fix-sizes", false, "correct recorded sizes that differ from the bucket")
+	importKey := flags.String("import-key", "", "API key of the user imported orphans are given to")
+	minAge := flags.Duration("min-age", time.Hour, "ignore objects modified more recently than this")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	opts := functions.ReconcileOptions{
+		DryRun:    *dryRun,
+		Orphans:   *orphans,
+		Dangling:  *dangling,
+		FixSizes:  *fixSizes,
+		ImportKey: *importKey,
+		MinAge:    *minAge,
+	}
+
+	report, err := functions.Reconcile(opts)
+	if err != nil {
+		return fail(err)
+	}
+
+	// There is no background worker in this process, so orphans queued for
+	// deletion are deleted before exiting.
+	if !opts.DryRun && opts.Orphans == functions.ReconcileOrphansDelete {
+		if _, err := functions.DrainOutbox(); err != nil {
+			report.Errors = append(report.Errors, "deleting queued objects: "+err.Error())
+		}
+	}
+
+	if code := printJSON(report); code != 0 {
+		return code
+	}
+	if len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
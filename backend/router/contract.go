@@ -0,0 +1,199 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"tritan.dev/image-uploader/constants"
+)
+
+// The API is mounted at both /api and /api/v1, but only documented once under
+// /api: the v1 copy differs in its response envelope, which is described in
+// the V1Success and V1Error schemas.
+const (
+	legacyPrefix = "/api/"
+	v1Prefix     = "/api/v1/"
+)
+
+// legacyPath maps a /api/v1 path onto the /api path that documents it, and
+// reports whether it was a v1 path.
+func legacyPath(path string) (string, bool) {
+	if !strings.HasPrefix(path, v1Prefix) {
+		return path, false
+	}
+	return legacyPrefix + strings.TrimPrefix(path, v1Prefix), true
+}
+
+// CheckRoutes compares the routes registered on app with openapi.json: every
+// route must be documented, every documented API operation registered under
+// both /api and /api/v1 with the same path parameters, and every $ref in the
+// document must resolve. It returns one line per problem.
+func CheckRoutes(app *fiber.App) []string {
+	doc, err := loadOpenAPI()
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	problems := []string{}
+	registered, registeredV1 := map[string]bool{}, map[string]bool{}
+	for _, route := range app.GetRoutes(true) {
+		// Fiber registers HEAD alongside every GET.
+		if route.Method == fiber.MethodHead {
+			continue
+		}
+
+		path, v1 := legacyPath(specPath(route.Path))
+		method := strings.ToLower(route.Method)
+		if v1 {
+			registeredV1[method+" "+path] = true
+		} else {
+			registered[method+" "+path] = true
+		}
+		if _, ok := doc.Paths[path][method]; !ok {
+			problems = append(problems, fmt.Sprintf("%s %s is registered but not documented", route.Method, specPath(route.Path)))
+		}
+	}
+
+	operationIDs := map[string]string{}
+	for path, item := range doc.Paths {
+		for method, operation := range item {
+			name := strings.ToUpper(method) + " " + path
+			if !registered[method+" "+path] {
+				problems = append(problems, name+" is documented but not registered")
+			}
+			if strings.HasPrefix(path, legacyPrefix) && path != openAPIPath && !registeredV1[method+" "+path] {
+				problems = append(problems, name+" is not registered under /api/v1")
+			}
+
+			if other, ok := operationIDs[operation.OperationID]; ok || operation.OperationID == "" {
+				problems = append(problems, fmt.Sprintf("%s has a missing or duplicate operationId (also %s)", name, other))
+			}
+			operationIDs[operation.OperationID] = name
+
+			if len(operation.Responses) == 0 {
+				problems = append(problems, name+" documents no responses")
+			}
+			problems = append(problems, checkPathParameters(name, path, operation)...)
+		}
+	}
+
+	problems = append(problems, checkErrorCodes(doc)...)
+
+	var raw interface{}
+	if err := json.Unmarshal(OpenAPISpec, &raw); err != nil {
+		return append(problems, err.Error())
+	}
+	problems = append(problems, checkRefs(raw, raw, "#")...)
+
+	sort.Strings(problems)
+	return problems
+}
+
+// checkErrorCodes compares the code enum of V1Error with the codes in
+// constants, so a new error message cannot ship without its code documented.
+func checkErrorCodes(doc openAPIDocument) []string {
+	codes := map[string]bool{"error": true}
+	for _, code := range constants.ErrorCodes {
+		codes[code] = true
+	}
+	for _, code := range constants.StatusErrorCodes {
+		codes[code] = true
+	}
+
+	documented := map[string]bool{}
+	v1Error, _ := doc.Components.Schemas["V1Error"]["properties"].(map[string]interface{})
+	errorObject, _ := v1Error["error"].(map[string]interface{})
+	properties, _ := errorObject["properties"].(map[string]interface{})
+	code, _ := properties["code"].(map[string]interface{})
+	enum, _ := code["enum"].([]interface{})
+	for _, value := range enum {
+		if value, ok := value.(string); ok {
+			documented[value] = true
+		}
+	}
+
+	var problems []string
+	for code := range codes {
+		if !documented[code] {
+			problems = append(problems, fmt.Sprintf("error code %q is not in the V1Error code enum", code))
+		}
+	}
+	for code := range documented {
+		if !codes[code] {
+			problems = append(problems, fmt.Sprintf("V1Error documents unknown error code %q", code))
+		}
+	}
+	return problems
+}
+
+// checkPathParameters reports {name} segments without a matching path
+// parameter and path parameters that are not in the path.
+func checkPathParameters(name, path string, operation openAPIOperation) []string {
+	var problems []string
+	inPath := map[string]bool{}
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") {
+			inPath[strings.Trim(segment, "{}")] = true
+		}
+	}
+
+	declared := map[string]bool{}
+	for _, parameter := range operation.Parameters {
+		if parameter.In != "path" {
+			continue
+		}
+		declared[parameter.Name] = true
+		if !inPath[parameter.Name] {
+			problems = append(problems, fmt.Sprintf("%s declares path parameter %q that is not in the path", name, parameter.Name))
+		}
+		if !parameter.Required {
+			problems = append(problems, fmt.Sprintf("%s path parameter %q must be required", name, parameter.Name))
+		}
+	}
+	for parameter := range inPath {
+		if !declared[parameter] {
+			problems = append(problems, fmt.Sprintf("%s does not declare path parameter %q", name, parameter))
+		}
+	}
+	return problems
+}
+
+// checkRefs walks the document and reports every local $ref that does not
+// point at anything.
+func checkRefs(root, node interface{}, at string) []string {
+	var problems []string
+	switch node := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := node["$ref"].(string); ok && !refExists(root, ref) {
+			problems = append(problems, fmt.Sprintf("%s: unresolved $ref %s", at, ref))
+		}
+		for key, child := range node {
+			problems = append(problems, checkRefs(root, child, at+"/"+key)...)
+		}
+	case []interface{}:
+		for i, child := range node {
+			problems = append(problems, checkRefs(root, child, fmt.Sprintf("%s/%d", at, i))...)
+		}
+	}
+	return problems
+}
+
+func refExists(root interface{}, ref string) bool {
+	if !strings.HasPrefix(ref, "#/") {
+		return false
+	}
+	node := root
+	for _, key := range strings.Split(ref[2:], "/") {
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if node, ok = object[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
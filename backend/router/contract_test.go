@@ -0,0 +1,424 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"tritan.dev/image-uploader/database"
+)
+
+// The contract tests run the real handlers against a mock MongoDB deployment,
+// which answers each query with the next queued response, so they need no
+// database. Every response is checked against openapi.json: the documented
+// schema under /api, and the V1Success or V1Error envelope under /api/v1.
+
+const testKey = "test-key"
+
+func newTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(requestid.New())
+	if err := SetupRoutes(app); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func loadTestOpenAPI(t *testing.T) openAPIDocument {
+	t.Helper()
+	doc, err := loadOpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	for _, problem := range CheckRoutes(newTestApp(t)) {
+		t.Error(problem)
+	}
+}
+
+// TestKeyedRoutesRequireKey calls every operation that requires an API key
+// without one. No handler gets past its key check, so none touches the
+// database.
+func TestKeyedRoutesRequireKey(t *testing.T) {
+	app, doc := newTestApp(t), loadTestOpenAPI(t)
+
+	for path, item := range doc.Paths {
+		for method, operation := range item {
+			if len(operation.Security) == 0 {
+				continue
+			}
+			name := strings.ToUpper(method) + " " + path
+			documented, ok := doc.resolveResponse(operation.Responses["401"])
+			if !ok || documented.Content[fiber.MIMEApplicationJSON].Schema == nil {
+				t.Errorf("%s does not document its 401 response", name)
+				continue
+			}
+
+			target := path
+			for _, parameter := range operation.Parameters {
+				if parameter.In == "path" {
+					target = strings.ReplaceAll(target, "{"+parameter.Name+"}", "1")
+				}
+			}
+			status, body := call(t, app, method, target, nil, "")
+			checkResponse(t, doc, name, status, fiber.StatusUnauthorized, body, documented.Content[fiber.MIMEApplicationJSON].Schema)
+
+			v1Target := v1Prefix + strings.TrimPrefix(target, legacyPrefix)
+			status, body = call(t, app, method, v1Target, nil, "")
+			checkResponse(t, doc, "v1 "+name, status, fiber.StatusUnauthorized, body, v1ErrorSchema)
+		}
+	}
+}
+
+// contractCase is one request and the database responses its handler needs,
+// in the order it makes its queries.
+type contractCase struct {
+	name      string
+	method    string
+	path      string // as documented, e.g. /api/albums/{id}
+	target    string // as requested, under /api
+	body      interface{}
+	responses []bson.D
+	status    int
+	code      string // the /api/v1 error code, for failures
+}
+
+func found(collection string, documents ...bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "ShareX-Uploader."+collection, mtest.FirstBatch, documents...)
+}
+
+var (
+	testCreated = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testUser = bson.D{
+		{Key: "api_key", Value: testKey},
+		{Key: "admin", Value: false},
+		{Key: "display_name", Value: "Test"},
+		{Key: "created_at", Value: testCreated},
+		{Key: "ip", Value: "127.0.0.1"},
+		{Key: "domain", Value: "i.example.com"},
+		{Key: "usage", Value: bson.D{{Key: "bytes", Value: int64(1024)}, {Key: "files", Value: int64(1)}}},
+	}
+
+	testAlbum = bson.D{
+		{Key: "album_id", Value: "album1"},
+		{Key: "api_key", Value: testKey},
+		{Key: "title", Value: "Holiday"},
+		{Key: "description", Value: ""},
+		{Key: "files", Value: bson.A{"65a1f0c2e4b0a1b2c3d4e5f6"}},
+		{Key: "cover", Value: "65a1f0c2e4b0a1b2c3d4e5f6"},
+		{Key: "created_at", Value: testCreated},
+		{Key: "updated_at", Value: testCreated},
+	}
+
+	foreignAlbum = bson.D{
+		{Key: "album_id", Value: "album2"},
+		{Key: "api_key", Value: "someone-else"},
+		{Key: "title", Value: "Private"},
+		{Key: "files", Value: bson.A{}},
+		{Key: "created_at", Value: testCreated},
+		{Key: "updated_at", Value: testCreated},
+	}
+
+	testDomain = bson.D{
+		{Key: "name", Value: "i.example.com"},
+		{Key: "allowed", Value: bson.A{"*"}},
+	}
+)
+
+var contractCases = []contractCase{
+	{
+		name: "account", method: "get", path: "/api/account", target: "/api/account",
+		responses: []bson.D{found("users", testUser)},
+		status:    fiber.StatusOK,
+	},
+	{
+		name: "account of an unknown key", method: "get", path: "/api/account", target: "/api/account",
+		responses: []bson.D{found("users")},
+		status:    fiber.StatusNotFound, code: "user_not_found",
+	},
+	{
+		name: "albums", method: "get", path: "/api/albums", target: "/api/albums",
+		responses: []bson.D{found("users", testUser), found("albums", testAlbum)},
+		status:    fiber.StatusOK,
+	},
+	{
+		name: "album without a title", method: "post", path: "/api/albums", target: "/api/albums",
+		body:      map[string]interface{}{"description": "no title"},
+		responses: []bson.D{found("users", testUser)},
+		status:    fiber.StatusBadRequest, code: "album_title_required",
+	},
+	{
+		name: "someone else's album", method: "get", path: "/api/albums/{id}", target: "/api/albums/album2",
+		responses: []bson.D{found("users", testUser), found("albums", foreignAlbum)},
+		status:    fiber.StatusForbidden, code: "forbidden",
+	},
+	{
+		name: "missing album", method: "put", path: "/api/albums/{id}", target: "/api/albums/nope",
+		body:      map[string]interface{}{"title": "New"},
+		responses: []bson.D{found("users", testUser), found("albums")},
+		status:    fiber.StatusNotFound, code: "album_not_found",
+	},
+	{
+		name: "album renamed to nothing", method: "put", path: "/api/albums/{id}", target: "/api/albums/album1",
+		body:      map[string]interface{}{"title": ""},
+		responses: []bson.D{found("users", testUser), found("albums", testAlbum)},
+		status:    fiber.StatusBadRequest, code: "album_title_required",
+	},
+	{
+		name: "album cover outside the album", method: "put", path: "/api/albums/{id}", target: "/api/albums/album1",
+		body:      map[string]interface{}{"cover": "elsewhere"},
+		responses: []bson.D{found("users", testUser), found("albums", testAlbum), found("uploads")},
+		status:    fiber.StatusBadRequest, code: "invalid_album_cover",
+	},
+	{
+		name: "domains", method: "get", path: "/api/domains", target: "/api/domains",
+		responses: []bson.D{found("users", testUser), found("domains", testDomain)},
+		status:    fiber.StatusOK,
+	},
+	{
+		name: "search without a query", method: "get", path: "/api/search", target: "/api/search",
+		responses: []bson.D{found("users", testUser)},
+		status:    fiber.StatusBadRequest, code: "search_query_required",
+	},
+	{
+		name: "deleting a missing URL", method: "delete", path: "/api/delete-url/{slug}", target: "/api/delete-url/gone",
+		responses: []bson.D{found("users", testUser), found("urls")},
+		status:    fiber.StatusNotFound, code: "url_not_found",
+	},
+	{
+		name: "malformed job ID", method: "get", path: "/api/jobs/{id}", target: "/api/jobs/not-an-id",
+		status: fiber.StatusNotFound, code: "job_not_found",
+	},
+}
+
+func TestResponsesMatchOpenAPI(t *testing.T) {
+	app, doc := newTestApp(t), loadTestOpenAPI(t)
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	for _, tc := range contractCases {
+		operation, ok := doc.Paths[tc.path][tc.method]
+		if !ok {
+			t.Errorf("%s: %s %s is not documented", tc.name, strings.ToUpper(tc.method), tc.path)
+			continue
+		}
+		documented, ok := doc.resolveResponse(operation.Responses[fmt.Sprint(tc.status)])
+		if !ok || documented.Content[fiber.MIMEApplicationJSON].Schema == nil {
+			t.Errorf("%s: %s %s does not document a JSON %d response", tc.name, strings.ToUpper(tc.method), tc.path, tc.status)
+			continue
+		}
+
+		mt.Run(tc.name, func(mt *mtest.T) {
+			database.Use(mt.Client)
+			mt.AddMockResponses(tc.responses...)
+			status, body := call(mt.T, app, tc.method, tc.target, tc.body, testKey)
+			checkResponse(mt.T, doc, tc.name, status, tc.status, body, documented.Content[fiber.MIMEApplicationJSON].Schema)
+		})
+
+		mt.Run(tc.name+" v1", func(mt *mtest.T) {
+			database.Use(mt.Client)
+			mt.AddMockResponses(tc.responses...)
+			target := v1Prefix + strings.TrimPrefix(tc.target, legacyPrefix)
+			status, body := call(mt.T, app, tc.method, target, tc.body, testKey)
+
+			schema := v1SuccessSchema
+			if tc.status >= 400 {
+				schema = v1ErrorSchema
+			}
+			if !checkResponse(mt.T, doc, tc.name+" v1", status, tc.status, body, schema) || tc.code == "" {
+				return
+			}
+			errorObject, _ := body.(map[string]interface{})["error"].(map[string]interface{})
+			if code := errorObject["code"]; code != tc.code {
+				mt.Errorf("%s v1: error code is %v, want %s", tc.name, code, tc.code)
+			}
+		})
+	}
+}
+
+var (
+	v1SuccessSchema = map[string]interface{}{"$ref": "#/components/schemas/V1Success"}
+	v1ErrorSchema   = map[string]interface{}{"$ref": "#/components/schemas/V1Error"}
+)
+
+// call sends a request, with body as JSON and key as the API key when given,
+// and returns the status and decoded JSON body.
+func call(t *testing.T, app *fiber.App, method, target string, body interface{}, key string) (int, interface{}) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = strings.NewReader(string(raw))
+	}
+
+	request := httptest.NewRequest(strings.ToUpper(method), target, reader)
+	if body != nil {
+		request.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	if key != "" {
+		request.Header.Set("key", key)
+	}
+
+	resp, err := app.Test(request, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", strings.ToUpper(method), target, err)
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(resp.Body)
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Errorf("%s %s: body is not JSON: %s", strings.ToUpper(method), target, raw)
+	}
+	return resp.StatusCode, decoded
+}
+
+// checkResponse reports a status other than want, or a body that does not
+// match schema, and returns whether the response was as expected.
+func checkResponse(t *testing.T, doc openAPIDocument, name string, status, want int, body interface{}, schema map[string]interface{}) bool {
+	t.Helper()
+	if status != want {
+		t.Errorf("%s: answered %d, want %d: %v", name, status, want, body)
+		return false
+	}
+	if problems := doc.validate(schema, body, "body"); len(problems) > 0 {
+		sort.Strings(problems)
+		t.Errorf("%s: %d body does not match the schema: %s", name, status, strings.Join(problems, "; "))
+		return false
+	}
+	return true
+}
+
+// resolveResponse follows a #/components/responses reference.
+func (doc openAPIDocument) resolveResponse(response openAPIResponse) (openAPIResponse, bool) {
+	if response.Ref == "" {
+		return response, true
+	}
+	resolved, ok := doc.Components.Responses[strings.TrimPrefix(response.Ref, "#/components/responses/")]
+	return resolved, ok
+}
+
+// resolveSchema follows a #/components/schemas reference.
+func (doc openAPIDocument) resolveSchema(schema map[string]interface{}) (map[string]interface{}, bool) {
+	ref, ok := schema["$ref"].(string)
+	if !ok {
+		return schema, true
+	}
+	resolved, ok := doc.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]
+	return resolved, ok
+}
+
+// validate checks a decoded JSON value against the subset of JSON Schema used
+// in openapi.json: type, required, properties, items, enum, nullable, allOf,
+// oneOf and $ref.
+func (doc openAPIDocument) validate(schema map[string]interface{}, value interface{}, at string) []string {
+	schema, ok := doc.resolveSchema(schema)
+	if !ok {
+		return []string{at + ": unresolved $ref"}
+	}
+
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable || schema["type"] == nil {
+			return nil
+		}
+		return []string{at + " is null"}
+	}
+
+	var problems []string
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			if sub, ok := sub.(map[string]interface{}); ok {
+				problems = append(problems, doc.validate(sub, value, at)...)
+			}
+		}
+	}
+	if one, ok := schema["oneOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range one {
+			if sub, ok := sub.(map[string]interface{}); ok && len(doc.validate(sub, value, at)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			problems = append(problems, at+" matches none of its oneOf schemas")
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return append(problems, at+" is not an object")
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s is missing %q", at, name))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, field := range object {
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				problems = append(problems, doc.validate(property, field, at+"."+name)...)
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return append(problems, at+" is not an array")
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range array {
+				problems = append(problems, doc.validate(items, item, fmt.Sprintf("%s[%d]", at, i))...)
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			problems = append(problems, at+" is not a string")
+		}
+	case "integer":
+		if number, ok := value.(float64); !ok || number != math.Trunc(number) {
+			problems = append(problems, at+" is not an integer")
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			problems = append(problems, at+" is not a number")
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, at+" is not a boolean")
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if allowed == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s is %v, not one of %v", at, value, enum))
+		}
+	}
+	return problems
+}
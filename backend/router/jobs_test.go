@@ -0,0 +1,46 @@
+package router
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"tritan.dev/image-uploader/database"
+)
+
+// TestJobStatusURLKeepsPrefix queues a job under each API prefix and checks
+// the status_url points back under the same one.
+func TestJobStatusURLKeepsPrefix(t *testing.T) {
+	app := newTestApp(t)
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		prefix string
+		data   func(body map[string]interface{}) map[string]interface{}
+	}{
+		{"/api", func(body map[string]interface{}) map[string]interface{} { return body }},
+		{"/api/v1", func(body map[string]interface{}) map[string]interface{} {
+			data, _ := body["data"].(map[string]interface{})
+			return data
+		}},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.prefix, func(mt *mtest.T) {
+			database.Use(mt.Client)
+			mt.AddMockResponses(found("users", testUser), mtest.CreateSuccessResponse())
+
+			status, body := call(mt.T, app, "put", tt.prefix+"/account/delete", nil, testKey)
+			if status != fiber.StatusAccepted {
+				mt.Fatalf("answered %d, want %d: %v", status, fiber.StatusAccepted, body)
+			}
+
+			response, _ := body.(map[string]interface{})
+			statusURL, _ := tt.data(response)["status_url"].(string)
+			if !strings.HasPrefix(statusURL, tt.prefix+"/jobs/") {
+				mt.Errorf("status_url is %q, want it under %s/jobs/", statusURL, tt.prefix)
+			}
+		})
+	}
+}
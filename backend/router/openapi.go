@@ -0,0 +1,76 @@
+package router
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// OpenAPISpec is the OpenAPI 3 description of every route in SetupRoutes,
+// served at /api/openapi.json. CheckRoutes and the contract tests keep the
+// two in step.
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
+
+const openAPIPath = "/api/openapi.json"
+
+func GetOpenAPISpec(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(OpenAPISpec)
+}
+
+// The parts of an OpenAPI document the contract checks read. Schemas are kept
+// as generic maps so $ref, allOf and the rest can be walked as written.
+type openAPIDocument struct {
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas   map[string]map[string]interface{} `json:"schemas"`
+		Responses map[string]openAPIResponse        `json:"responses"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Parameters  []openAPIParameter         `json:"parameters"`
+	Security    []map[string][]string      `json:"security"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name     string `json:"name"`
+	In       string `json:"in"`
+	Required bool   `json:"required"`
+}
+
+type openAPIResponse struct {
+	Ref     string                      `json:"$ref"`
+	Content map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIMediaType struct {
+	Schema map[string]interface{} `json:"schema"`
+}
+
+func loadOpenAPI() (openAPIDocument, error) {
+	var doc openAPIDocument
+	if err := json.Unmarshal(OpenAPISpec, &doc); err != nil {
+		return doc, fmt.Errorf("parsing openapi.json: %w", err)
+	}
+	return doc, nil
+}
+
+// specPath turns a Fiber route path such as /api/uploads/:id into its
+// OpenAPI form, /api/uploads/{id}.
+func specPath(route string) string {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + strings.TrimSuffix(segment[1:], "?") + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -1,43 +1,37 @@
 package router
 
 import (
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 
 	"tritan.dev/image-uploader/constants"
 	api "tritan.dev/image-uploader/handlers/api"
 	ui "tritan.dev/image-uploader/handlers/ui"
+	"tritan.dev/image-uploader/middleware"
+)
+
+// Password guesses on protected uploads are limited per client, and more
+// tightly over a longer window per client and upload. Keying the second limit
+// on the upload alone would let anyone lock its owner out.
+var (
+	unlockPerIP     = middleware.NewRateLimiter(10, time.Minute, middleware.ByIP)
+	unlockPerUpload = middleware.NewRateLimiter(30, 10*time.Minute, ui.UnlockAttemptKey)
 )
 
 func SetupRoutes(app *fiber.App) error {
 
 	app.Get("/u/:slug", ui.RedirectBySlug)
+	app.Get("/a/:id", ui.DisplayAlbum)
 	app.Get("/i/:file", ui.DisplayImage)
-	app.Get("/api/account", api.GetAccountDataByKey)
-	app.Get("/api/admin/users", api.GetAdminUsers)
-	app.Get("/api/admin/uploads/recent", api.GetAdminRecentUploads)
-	app.Get("/api/admin/uploads/user/:key", api.GetAdminUploadsByUser)
-	app.Get("/api/uploads", api.GetUploadsByToken)
-	app.Get("/api/urls", api.GetURLsByToken)
-	app.Get("/api/domains", api.GetEligableDomains)
-
-	app.Post("/api/account", api.PostNewAccount)
-	app.Post("/api/upload", api.PostUpload)
-	app.Post("/api/config", api.PostShareXConfig)
-	app.Post("/api/url", api.PostNewURL)
-
-	app.Put("/api/url/:slug", api.PutUpdatedURLSlug)
-	app.Put("/api/account/:type", api.PutAccountDetailsByKey)
-	app.Put("/api/domains", api.PutDomainWithAPIKey)
-	app.Put("/api/admin/users/:key/display-name", api.UpdateAdminUserDisplayName)
-	app.Put("/api/admin/users/:key/reroll-key", api.RerollAdminUserKey)
-
-	app.Delete("/api/delete-upload/:id", api.DeleteUpload)
-	app.Delete("/api/delete-url/:slug", api.DeleteURL)
-	app.Delete("/api/admin/uploads/:file", api.DeleteAdminUpload)
-	app.Delete("/api/admin/users/:key", api.DeleteAdminUser)
-	app.Delete("/api/admin/users/:key/uploads", api.DeleteAdminUserUploads)
+	app.Get("/i/:file/raw", ui.ServeRawFile)
+	app.Post("/i/:file/unlock", unlockPerIP.Limit(unlockPerUpload.Limit(ui.UnlockUpload)))
+	app.Get(openAPIPath, GetOpenAPISpec)
+	registerAPIRoutes(app.Group("/api/v1", middleware.APIv1))
+	registerAPIRoutes(app.Group("/api"))
 
 	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(constants.ErrorCodeLocal, constants.CodeMissingContent)
 		return c.Status(constants.StatusNotFound).JSON(fiber.Map{
 			"status":  constants.StatusNotFound,
 			"message": constants.MessageMissingContent,
@@ -46,3 +40,62 @@ func SetupRoutes(app *fiber.App) error {
 
 	return nil
 }
+
+// registerAPIRoutes adds the JSON API to group. It is mounted twice: at /api
+// for existing clients, and at /api/v1 behind the APIv1 envelope.
+func registerAPIRoutes(group fiber.Router) {
+	group.Get("/account", api.GetAccountDataByKey)
+	group.Get("/jobs", api.GetJobs)
+	group.Get("/jobs/:id", api.GetJob)
+	group.Get("/admin/users", api.GetAdminUsers)
+	group.Get("/admin/search", api.GetAdminSearch)
+	group.Get("/admin/jobs", api.GetAdminJobs)
+	group.Get("/admin/uploads/recent", api.GetAdminRecentUploads)
+	group.Get("/admin/uploads/user/:key", api.GetAdminUploadsByUser)
+	group.Get("/admin/users/:key/limits", api.GetAdminUserLimits)
+	group.Get("/uploads", api.GetUploadsByToken)
+	group.Get("/search", api.GetSearch)
+	group.Get("/trash", api.GetTrash)
+	group.Get("/uploads/:id/versions", api.GetUploadVersions)
+	group.Get("/urls", api.GetURLsByToken)
+	group.Get("/domains", api.GetEligibleDomains)
+	group.Get("/albums", api.GetAlbums)
+	group.Get("/albums/:id", api.GetAlbum)
+
+	group.Post("/account", api.PostNewAccount)
+	group.Post("/upload", middleware.Idempotent("upload", api.PostUpload))
+	group.Post("/config", api.PostShareXConfig)
+	group.Post("/url", middleware.Idempotent("url", api.PostNewURL))
+	group.Post("/uploads/:id/share", api.PostUploadShareLink)
+	group.Post("/trash/uploads/:id/restore", api.PostRestoreUpload)
+	group.Post("/uploads/:id/versions/:version/rollback", api.PostUploadRollback)
+	group.Post("/trash/urls/:slug/restore", api.PostRestoreURL)
+	group.Post("/albums", api.PostAlbum)
+	group.Post("/albums/:id/uploads", api.PostAlbumUploads)
+	group.Post("/admin/storage/rotate", api.PostAdminRotateStorageKeys)
+	group.Post("/admin/storage/reconcile", api.PostAdminReconcileStorage)
+
+	group.Put("/url/:slug", api.PutUpdatedURLSlug)
+	group.Put("/account/:type", api.PutAccountDetailsByKey)
+	group.Put("/domains", api.PutDomainWithAPIKey)
+	group.Put("/uploads/:id/visibility", api.PutUploadVisibility)
+	group.Put("/uploads/:id/content", api.PutUploadContent)
+	group.Put("/uploads/:id/name", api.PutUploadName)
+	group.Put("/albums/:id", api.PutAlbum)
+	group.Put("/albums/:id/order", api.PutAlbumOrder)
+	group.Put("/admin/users/:key/display-name", api.UpdateAdminUserDisplayName)
+	group.Put("/admin/users/:key/reroll-key", api.RerollAdminUserKey)
+	group.Put("/admin/users/:key/limits", api.UpdateAdminUserLimits)
+
+	group.Patch("/uploads/:id", api.PatchUploadDetails)
+
+	group.Delete("/delete-upload/:id", api.DeleteUpload)
+	group.Delete("/delete-url/:slug", api.DeleteURL)
+	group.Delete("/trash/uploads/:id", api.DeleteTrashedUpload)
+	group.Delete("/trash/urls/:slug", api.DeleteTrashedURL)
+	group.Delete("/albums/:id", api.DeleteAlbum)
+	group.Delete("/albums/:id/uploads/:upload", api.DeleteAlbumUpload)
+	group.Delete("/admin/uploads/:id", api.DeleteAdminUpload)
+	group.Delete("/admin/users/:key", api.DeleteAdminUser)
+	group.Delete("/admin/users/:key/uploads", api.DeleteAdminUserUploads)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"tritan.dev/image-uploader/database"
+	"tritan.dev/image-uploader/functions"
+)
+
+// runUserCommand manages accounts from the command line:
+//
+//	user create [-admin] [-name NAME] [-domain DOMAIN]
+//	user list
+//	user promote [-demote] KEY
+//	user reroll KEY
+//	user delete KEY
+func runUserCommand(args []string) int {
+	if len(args) == 0 {
+		return fail(errors.New("user needs one of create, list, promote, reroll or delete"))
+	}
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("user create", flag.ContinueOnError)
+		admin := flags.Bool("admin", false, "give the user admin rights")
+		name := flags.String("name", "", "display name")
+		domain := flags.String("domain", "", "upload domain")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+
+		user, err := functions.CreateUser(*name, "cli", *domain, *admin)
+		if err != nil {
+			return fail(err)
+		}
+		return printJSON(user)
+
+	case "list":
+		users, err := database.LoadUsersFromDB()
+		if err != nil {
+			return fail(err)
+		}
+		if users == nil {
+			users = []database.User{}
+		}
+		return printJSON(users)
+
+	case "promote":
+		flags := flag.NewFlagSet("user promote", flag.ContinueOnError)
+		demote := flags.Bool("demote", false, "take admin rights away instead")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+		key, err := keyArg(flags.Args())
+		if err != nil {
+			return fail(err)
+		}
+
+		if err := database.SetUserAdmin(key, !*demote); err != nil {
+			return fail(fmt.Errorf("updating %s: %w", key, err))
+		}
+		return printJSON(map[string]interface{}{"key": key, "admin": !*demote})
+
+	case "reroll":
+		key, err := existingKeyArg(args[1:])
+		if err != nil {
+			return fail(err)
+		}
+
+		newKey, err := functions.RerollUserKey(key)
+		if err != nil {
+			return fail(err)
+		}
+		return printJSON(map[string]string{"old_key": key, "key": newKey})
+
+	case "delete":
+		key, err := existingKeyArg(args[1:])
+		if err != nil {
+			return fail(err)
+		}
+
+		// Deleted objects are normally removed by the server's storage
+		// worker; this process has none, so drain the outbox here.
+		if err := functions.DeleteAccount(key); err != nil {
+			return fail(err)
+		}
+		deleted, err := functions.DrainOutbox()
+		if err != nil {
+			return fail(err)
+		}
+		return printJSON(map[string]interface{}{"key": key, "deleted": true, "objects_deleted": deleted})
+
+	default:
+		return fail(fmt.Errorf("unknown user command %q", args[0]))
+	}
+}
+
+func keyArg(args []string) (string, error) {
+	if len(args) != 1 || args[0] == "" {
+		return "", errors.New("expected exactly one API key")
+	}
+	return args[0], nil
+}
+
+func existingKeyArg(args []string) (string, error) {
+	key, err := keyArg(args)
+	if err != nil {
+		return "", err
+	}
+	if _, err := database.GetUserByKey(key); err != nil {
+		return "", fmt.Errorf("no user with key %s", key)
+	}
+	return key, nil
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ShareX config kinds accepted by ShareXConfig.
+const (
+	ConfigUpload = "upload"
+	ConfigURL    = "url"
+	ConfigText   = "text"
+)
+
+// CreateAccount registers a new user and returns its API key. It needs no
+// key, so it can be called on a client built with an empty one.
+func (c *Client) CreateAccount(ctx context.Context, displayName string) (string, error) {
+	var response struct {
+		Key string `json:"key"`
+	}
+	body := map[string]string{"display_name": displayName}
+	if err := c.do(ctx, http.MethodPost, "/api/account", nil, body, &response); err != nil {
+		return "", err
+	}
+	return response.Key, nil
+}
+
+// Account returns the caller's account, including usage and quota.
+func (c *Client) Account(ctx context.Context) (*Account, error) {
+	var account Account
+	if err := c.do(ctx, http.MethodGet, "/api/account", nil, nil, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (c *Client) putAccount(ctx context.Context, kind string, query url.Values, in, out interface{}) error {
+	return c.do(ctx, http.MethodPut, "/api/account/"+kind, query, in, out)
+}
+
+func (c *Client) SetDisplayName(ctx context.Context, name string) error {
+	return c.putAccount(ctx, "name", nil, map[string]string{"display_name": name}, nil)
+}
+
+// SetDomain picks which domain new upload and short links use.
+func (c *Client) SetDomain(ctx context.Context, domain string) error {
+	return c.putAccount(ctx, "domain", url.Values{"value": {domain}}, nil, nil)
+}
+
+// SetNameStyle sets the default style for generated upload names.
+func (c *Client) SetNameStyle(ctx context.Context, style string) error {
+	return c.putAccount(ctx, "name-style", url.Values{"value": {style}}, nil, nil)
+}
+
+// RerollKey replaces the caller's API key and switches the client to the new
+// one.
+func (c *Client) RerollKey(ctx context.Context) (string, error) {
+	var response struct {
+		Key string `json:"key"`
+	}
+	if err := c.putAccount(ctx, "token", nil, nil, &response); err != nil {
+		return "", err
+	}
+	c.Key = response.Key
+	return response.Key, nil
+}
+
+// DeleteAccount queues deletion of the caller's account and everything it
+// owns. Follow the returned job with Job or WaitJob.
+func (c *Client) DeleteAccount(ctx context.Context) (*Accepted, error) {
+	var accepted Accepted
+	if err := c.putAccount(ctx, "delete", nil, nil, &accepted); err != nil {
+		return nil, err
+	}
+	return &accepted, nil
+}
+
+// Job returns a background job queued by the caller.
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	var response struct {
+		Job Job `json:"job"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/jobs/"+url.PathEscape(id), nil, nil, &response); err != nil {
+		return nil, err
+	}
+	return &response.Job, nil
+}
+
+// WaitJob polls a job every interval until it finishes or ctx is done.
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration) (*Job, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil || job.Done() {
+			return job, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Domains lists the domains the caller may use.
+func (c *Client) Domains(ctx context.Context) ([]Domain, error) {
+	var response struct {
+		Domains []Domain `json:"domains"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/domains", nil, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Domains, nil
+}
+
+// AddDomain registers a domain, shared with every user when public.
+func (c *Client) AddDomain(ctx context.Context, domain string, public bool) error {
+	query := url.Values{"i": {domain}, "p": {strconv.FormatBool(public)}}
+	return c.do(ctx, http.MethodPut, "/api/domains", query, nil, nil)
+}
+
+// ShareXConfig downloads a .sxcu uploader config of the given kind
+// (ConfigUpload, ConfigURL or ConfigText).
+func (c *Client) ShareXConfig(ctx context.Context, kind string) ([]byte, error) {
+	var config []byte
+	if err := c.do(ctx, http.MethodPost, "/api/config", url.Values{"type": {kind}}, nil, &config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
@@ -0,0 +1,141 @@
+// Package client is a Go client for the Tritan ShareX Host API. It only uses
+// the standard library, so it can be vendored into screenshot tools without
+// pulling in the backend's dependencies.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultBaseURL is the public instance used when no base URL is given.
+const DefaultBaseURL = "https://cdn.tritan.gg"
+
+// Client talks to one host with one API key. The zero HTTPClient uses
+// http.DefaultClient.
+type Client struct {
+	BaseURL    string
+	Key        string
+	HTTPClient *http.Client
+	UserAgent  string
+}
+
+// New returns a client for baseURL, or DefaultBaseURL when it is empty.
+func New(baseURL, key string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL:   strings.TrimRight(baseURL, "/"),
+		Key:       key,
+		UserAgent: "tritan-go",
+	}
+}
+
+// Error is a non-2xx answer from the API, carrying the message from its
+// {"status", "message"} body.
+type Error struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("tritan: %d %s", e.Status, e.Message)
+}
+
+// IsStatus reports whether err is an API error with the given status.
+func IsStatus(err error, status int) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.Status == status
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	endpoint := c.BaseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.Key != "" {
+		req.Header.Set("key", c.Key)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// send performs req and decodes a JSON body into out, which may be nil.
+func (c *Client) send(req *http.Request, out interface{}) error {
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if raw, ok := out.(*[]byte); ok {
+		*raw, err = io.ReadAll(resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func decodeError(resp *http.Response) error {
+	apiErr := &Error{Status: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err := json.Unmarshal(body, apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(body))
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+	}
+	apiErr.Status = resp.StatusCode
+	return apiErr
+}
+
+// do sends a request with an optional JSON body and decodes the response
+// into out.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.send(req, out)
+}
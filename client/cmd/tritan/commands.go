@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"tritan.dev/image-uploader/client"
+)
+
+func runLogin(a *app, args []string) error {
+	flags := newFlags("login", a)
+	baseURL := flags.String("url", "", "host URL")
+	key := flags.String("key", "", "API key")
+	create := flags.String("create", "", "create a new account with this display name")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *baseURL != "" {
+		a.client.BaseURL = strings.TrimRight(*baseURL, "/")
+	}
+	if *key != "" {
+		a.client.Key = *key
+	}
+
+	if *create != "" {
+		key, err := a.client.CreateAccount(a.ctx, *create)
+		if err != nil {
+			return err
+		}
+		a.client.Key = key
+	}
+	if err := a.requireKey(); err != nil {
+		return err
+	}
+
+	account, err := a.client.Account(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	a.settings.URL = a.client.BaseURL
+	a.settings.Key = a.client.Key
+	if err := a.settings.save(a.configPath); err != nil {
+		return err
+	}
+
+	a.print(account, func(w io.Writer) {
+		fmt.Fprintf(w, "Logged in as %s on %s; saved to %s\n", account.DisplayName, a.client.BaseURL, a.configPath)
+	})
+	return nil
+}
+
+func runUpload(a *app, args []string) error {
+	flags := newFlags("upload", a)
+	var opts client.UploadOptions
+	flags.StringVar(&opts.Name, "name", "", "name for a single upload")
+	flags.StringVar(&opts.NameStyle, "style", a.settings.NameStyle, "generated name style")
+	flags.StringVar(&opts.Visibility, "visibility", a.settings.Visibility, "public, unlisted or private")
+	flags.StringVar(&opts.Password, "password", "", "password to view the upload")
+	flags.StringVar(&opts.Title, "title", "", "title")
+	flags.StringVar(&opts.Description, "description", "", "description")
+	tags := flags.String("tags", "", "comma-separated tags")
+	flags.StringVar(&opts.Album, "album", "", "add to this album ID")
+	flags.BoolVar(&opts.CreateAlbum, "create-album", false, "collect the files into a new album")
+	flags.StringVar(&opts.AlbumTitle, "album-title", "", "title of the new album")
+	stdinName := flags.String("stdin-name", "screenshot.png", "file name used for stdin")
+	quiet := flags.Bool("quiet", false, "do not show progress")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+	if err := a.requireKey(); err != nil {
+		return err
+	}
+	opts.Tags = splitList(*tags)
+
+	files := make([]client.File, 0, flags.NArg())
+	readStdin := false
+	for _, name := range flags.Args() {
+		if name == "-" {
+			if readStdin {
+				return fmt.Errorf("stdin can only be uploaded once")
+			}
+			readStdin = true
+			files = append(files, stdinFile(*stdinName))
+			continue
+		}
+
+		file, f, err := client.OpenFile(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		files = append(files, file)
+	}
+
+	if !*quiet && isTerminal(os.Stderr) {
+		opts.Progress = progressPrinter(a.stderr)
+	}
+
+	response, err := a.client.Upload(a.ctx, files, opts)
+	if opts.Progress != nil {
+		fmt.Fprint(a.stderr, "\r\033[K")
+	}
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range response.Results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+
+	a.print(response, func(w io.Writer) {
+		if len(response.Results) == 0 {
+			fmt.Fprintln(w, response.URL)
+			return
+		}
+		for _, result := range response.Results {
+			if result.Error != "" {
+				fmt.Fprintf(a.stderr, "tritan: %s: %s\n", result.File, result.Error)
+				continue
+			}
+			fmt.Fprintln(w, result.URL)
+		}
+		if response.Album != "" {
+			fmt.Fprintln(w, response.Album)
+		}
+	})
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(response.Results))
+	}
+	return nil
+}
+
+// stdinFile wraps stdin, using its size when it is redirected from a file so
+// the request need not be chunked.
+func stdinFile(name string) client.File {
+	size := int64(-1)
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode().IsRegular() {
+		size = info.Size()
+	}
+	return client.File{Name: name, Reader: os.Stdin, Size: size}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressPrinter redraws one status line on w, at most once per percent.
+func progressPrinter(w io.Writer) func(sent, total int64) {
+	last := int64(-1)
+	return func(sent, total int64) {
+		if total <= 0 {
+			fmt.Fprintf(w, "\r\033[Kuploading %s", formatBytes(sent))
+			return
+		}
+		percent := sent * 100 / total
+		if percent == last {
+			return
+		}
+		last = percent
+		fmt.Fprintf(w, "\r\033[Kuploading %3d%% %s / %s", percent, formatBytes(sent), formatBytes(total))
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func runShorten(a *app, args []string) error {
+	if len(args) == 0 {
+		newFlags("shorten", a).Usage()
+		return flag.ErrHelp
+	}
+	if err := a.requireKey(); err != nil {
+		return err
+	}
+
+	shortened := make([]*client.ShortURL, 0, len(args))
+	for _, target := range args {
+		short, err := a.client.Shorten(a.ctx, target)
+		if err != nil {
+			return fmt.Errorf("%s: %w", target, err)
+		}
+		shortened = append(shortened, short)
+	}
+
+	a.print(shortened, func(w io.Writer) {
+		for _, short := range shortened {
+			fmt.Fprintln(w, short.FullURL)
+		}
+	})
+	return nil
+}
+
+func listFlags(name string, a *app, opts *client.ListOptions) *flag.FlagSet {
+	flags := newFlags(name, a)
+	flags.IntVar(&opts.Limit, "limit", 50, "results per page (max 100)")
+	flags.StringVar(&opts.Cursor, "cursor", "", "next_cursor from the previous page")
+	flags.StringVar(&opts.Query, "q", "", "search text")
+	flags.StringVar(&opts.Sort, "sort", "", "sort field")
+	flags.StringVar(&opts.Order, "order", "", "asc or desc")
+	flags.StringVar(&opts.Domain, "domain", "", "only this domain")
+	return flags
+}
+
+func runUploads(a *app, args []string) error {
+	var opts client.ListOptions
+	flags := listFlags("uploads", a, &opts)
+	flags.StringVar(&opts.Tag, "tag", "", "only uploads with this tag")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireKey(); err != nil {
+		return err
+	}
+
+	list, err := a.client.ListUploads(a.ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	a.print(list, func(w io.Writer) {
+		for _, upload := range list.Uploads {
+			fmt.Fprintf(w, "%s\t%s\t%d views\t%s\n", uploadURL(upload), formatBytes(upload.Metadata.FileSize), upload.Metadata.Views, upload.Metadata.UploadDate.Format(time.DateTime))
+		}
+		printMore(a, list.HasMore, list.NextCursor)
+	})
+	return nil
+}
+
+func uploadURL(upload client.Upload) string {
+	name := strings.TrimSuffix(upload.FileName, path.Ext(upload.FileName))
+	if upload.Domain == "" {
+		return name
+	}
+	return "https://" + upload.Domain + "/i/" + name
+}
+
+func printMore(a *app, hasMore bool, cursor string) {
+	if hasMore {
+		fmt.Fprintf(a.stderr, "more results: -cursor %s\n", cursor)
+	}
+}
+
+func runURLs(a *app, args []string) error {
+	var opts client.ListOptions
+	flags := listFlags("urls", a, &opts)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := a.requireKey(); err != nil {
+		return err
+	}
+
+	list, err := a.client.ListURLs(a.ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	a.print(list, func(w io.Writer) {
+		for _, short := range list.URLs {
+			link := short.Slug
+			if short.Domain != "" {
+				link = "https://" + short.Domain + "/u/" + short.Slug
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d clicks\n", link, short.URL, short.Clicks)
+		}
+		printMore(a, list.HasMore, list.NextCursor)
+	})
+	return nil
+}
+
+func runDelete(a *app, args []string) error {
+	return deleteEach(a, "delete", args, a.client.DeleteUpload)
+}
+
+func runDeleteURL(a *app, args []string) error {
+	return deleteEach(a, "delete-url", args, a.client.DeleteURL)
+}
+
+func deleteEach(a *app, name string, args []string, remove func(ctx context.Context, slug string) (*client.Deleted, error)) error {
+	if len(args) == 0 {
+		newFlags(name, a).Usage()
+		return flag.ErrHelp
+	}
+	if err := a.requireKey(); err != nil {
+		return err
+	}
+
+	results := map[string]*client.Deleted{}
+	for _, slug := range args {
+		// Accept full links as well as bare names.
+		slug = path.Base(strings.TrimSuffix(slug, "/"))
+		deleted, err := remove(a.ctx, slug)
+		if err != nil {
+			return fmt.Errorf("%s: %w", slug, err)
+		}
+		results[slug] = deleted
+	}
+
+	a.print(results, func(w io.Writer) {
+		for _, slug := range args {
+			slug = path.Base(strings.TrimSuffix(slug, "/"))
+			fmt.Fprintf(w, "%s: %s\n", slug, results[slug].Message)
+		}
+	})
+	return nil
+}
+
+func runAccount(a *app, args []string) error {
+	if err := a.requireKey(); err != nil {
+		return err
+	}
+
+	account, err := a.client.Account(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	a.print(account, func(w io.Writer) {
+		fmt.Fprintf(w, "Name:    %s\n", account.DisplayName)
+		fmt.Fprintf(w, "Domain:  %s\n", account.Domain)
+		fmt.Fprintf(w, "Created: %s\n", account.CreatedAt.Format(time.DateTime))
+		fmt.Fprintf(w, "Usage:   %s in %d files\n", formatBytes(account.Usage.Bytes), account.Usage.Files)
+		if quota := account.Quota; quota != nil && quota.MaxBytes > 0 {
+			fmt.Fprintf(w, "Quota:   %s\n", formatBytes(quota.MaxBytes))
+		}
+		if account.Admin {
+			fmt.Fprintln(w, "Admin:   yes")
+		}
+	})
+	return nil
+}
+
+func runDomains(a *app, args []string) error {
+	if err := a.requireKey(); err != nil {
+		return err
+	}
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "add":
+			flags := newFlags("domains", a)
+			public := flags.Bool("public", false, "let every user pick this domain")
+			if err := flags.Parse(args[1:]); err != nil {
+				return err
+			}
+			if flags.NArg() != 1 {
+				flags.Usage()
+				return flag.ErrHelp
+			}
+			return a.done(a.client.AddDomain(a.ctx, flags.Arg(0), *public), "Added "+flags.Arg(0))
+		case "use":
+			if len(args) != 2 {
+				newFlags("domains", a).Usage()
+				return flag.ErrHelp
+			}
+			return a.done(a.client.SetDomain(a.ctx, args[1]), "Now using "+args[1])
+		default:
+			newFlags("domains", a).Usage()
+			return flag.ErrHelp
+		}
+	}
+
+	domains, err := a.client.Domains(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	a.print(domains, func(w io.Writer) {
+		for _, domain := range domains {
+			fmt.Fprintln(w, domain.Name)
+		}
+	})
+	return nil
+}
+
+// done reports a change that has no response body of its own.
+func (a *app) done(err error, message string) error {
+	if err != nil {
+		return err
+	}
+	a.print(map[string]string{"message": message}, func(w io.Writer) {
+		fmt.Fprintln(w, message)
+	})
+	return nil
+}
+
+func runShareX(a *app, args []string) error {
+	flags := newFlags("sharex", a)
+	out := flags.String("out", "", "write the config here instead of stdout")
+	if len(args) == 0 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+	kind := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if err := a.requireKey(); err != nil {
+		return err
+	}
+
+	config, err := a.client.ShareXConfig(a.ctx, kind)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = a.stdout.Write(config)
+		return err
+	}
+	return os.WriteFile(*out, config, 0o600)
+}
+
+func runJob(a *app, args []string) error {
+	flags := newFlags("job", a)
+	wait := flags.Bool("wait", false, "wait for the job to finish")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+	if err := a.requireKey(); err != nil {
+		return err
+	}
+
+	var job *client.Job
+	var err error
+	if *wait {
+		job, err = a.client.WaitJob(a.ctx, flags.Arg(0), time.Second)
+	} else {
+		job, err = a.client.Job(a.ctx, flags.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+
+	a.print(job, func(w io.Writer) {
+		fmt.Fprintf(w, "%s %s (attempt %d of %d)\n", job.Type, job.Status, job.Attempts, job.MaxAttempts)
+		if job.LastError != "" {
+			fmt.Fprintln(w, "last error:", job.LastError)
+		}
+	})
+	if job.Status == "failed" {
+		return fmt.Errorf("job failed")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// settings is the CLI config file. Flags and the TRITAN_URL and TRITAN_KEY
+// environment variables override it.
+type settings struct {
+	URL        string `json:"url"`
+	Key        string `json:"key"`
+	Output     string `json:"output,omitempty"`
+	NameStyle  string `json:"name_style,omitempty"`
+	Visibility string `json:"visibility,omitempty"`
+}
+
+// defaultConfigPath is tritan/config.json in the user's config directory,
+// e.g. ~/.config/tritan/config.json on Linux.
+func defaultConfigPath() string {
+	if path := os.Getenv("TRITAN_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "tritan.json"
+	}
+	return filepath.Join(dir, "tritan", "config.json")
+}
+
+// loadSettings reads path, treating a missing file as empty settings.
+func loadSettings(path string) (settings, error) {
+	var s settings
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	return s, json.Unmarshal(data, &s)
+}
+
+// save writes the settings readable only by the user, since they hold the
+// API key.
+func (s settings) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
@@ -0,0 +1,189 @@
+// Command tritan uploads files and shortens links on a Tritan ShareX Host
+// from the command line, e.g. "flameshot gui -r | tritan upload -".
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"tritan.dev/image-uploader/client"
+)
+
+type app struct {
+	client     *client.Client
+	settings   settings
+	configPath string
+	json       bool
+	ctx        context.Context
+	stdout     io.Writer
+	stderr     io.Writer
+}
+
+type command struct {
+	usage string
+	run   func(a *app, args []string) error
+}
+
+// commands is filled in by init since the commands read their own usage
+// text from it.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"login":      {"login [-url URL] [-key KEY | -create NAME]", runLogin},
+		"upload":     {"upload [flags] FILE... (- reads stdin)", runUpload},
+		"shorten":    {"shorten URL...", runShorten},
+		"uploads":    {"uploads [-limit N] [-cursor C] [-q TEXT] [-tag TAG] [-sort date|size|views] [-order asc|desc]", runUploads},
+		"urls":       {"urls [-limit N] [-cursor C] [-q TEXT] [-sort date|clicks] [-order asc|desc]", runURLs},
+		"delete":     {"delete NAME...", runDelete},
+		"delete-url": {"delete-url SLUG...", runDeleteURL},
+		"account":    {"account", runAccount},
+		"domains":    {"domains [add [-public] DOMAIN | use DOMAIN]", runDomains},
+		"sharex":     {"sharex upload|url|text [-out FILE]", runShareX},
+		"job":        {"job [-wait] ID", runJob},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	a := &app{stdout: os.Stdout, stderr: os.Stderr}
+
+	flags := flag.NewFlagSet("tritan", flag.ContinueOnError)
+	flags.SetOutput(a.stderr)
+	flags.Usage = func() { usage(a.stderr, flags) }
+	flags.StringVar(&a.configPath, "config", defaultConfigPath(), "config file")
+	baseURL := flags.String("url", "", "host URL (overrides the config file and TRITAN_URL)")
+	key := flags.String("key", "", "API key (overrides the config file and TRITAN_KEY)")
+	flags.BoolVar(&a.json, "json", false, "print JSON instead of plain text")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(a.stderr, "tritan: unknown command %q\n", flags.Arg(0))
+		flags.Usage()
+		return 2
+	}
+
+	var err error
+	if a.settings, err = loadSettings(a.configPath); err != nil {
+		return a.fail(fmt.Errorf("reading %s: %w", a.configPath, err))
+	}
+	a.settings.URL = firstNonEmpty(*baseURL, os.Getenv("TRITAN_URL"), a.settings.URL)
+	a.settings.Key = firstNonEmpty(*key, os.Getenv("TRITAN_KEY"), a.settings.Key)
+	a.json = a.json || a.settings.Output == "json"
+	a.client = client.New(a.settings.URL, a.settings.Key)
+	a.client.UserAgent = "tritan-cli"
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	a.ctx = ctx
+
+	if err := cmd.run(a, flags.Args()[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 2
+		}
+		return a.fail(err)
+	}
+	return 0
+}
+
+func usage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintln(w, "usage: tritan [-config FILE] [-url URL] [-key KEY] [-json] COMMAND [ARGS]")
+	fmt.Fprintln(w, "\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(w, "  "+commands[name].usage)
+	}
+	fmt.Fprintln(w, "\nflags:")
+	flags.PrintDefaults()
+}
+
+// fail reports err on stderr, as JSON in JSON mode, and returns the exit
+// code.
+func (a *app) fail(err error) int {
+	if a.json {
+		body := map[string]interface{}{"error": err.Error()}
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) {
+			body["status"] = apiErr.Status
+			body["error"] = apiErr.Message
+		}
+		writeJSON(a.stderr, body)
+	} else {
+		fmt.Fprintln(a.stderr, "tritan:", err)
+	}
+	return 1
+}
+
+// requireKey fails early with a hint instead of letting the API answer 401.
+func (a *app) requireKey() error {
+	if a.client.Key == "" {
+		return fmt.Errorf("no API key; run \"tritan login -key KEY\" or set TRITAN_KEY")
+	}
+	return nil
+}
+
+// print writes v as JSON in JSON mode, and otherwise the lines from plain.
+func (a *app) print(v interface{}, plain func(w io.Writer)) {
+	if a.json {
+		writeJSON(a.stdout, v)
+		return
+	}
+	plain(a.stdout)
+}
+
+func writeJSON(w io.Writer, v interface{}) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+func newFlags(name string, a *app) *flag.FlagSet {
+	flags := flag.NewFlagSet("tritan "+name, flag.ContinueOnError)
+	flags.SetOutput(a.stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(a.stderr, "usage: tritan "+commands[name].usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
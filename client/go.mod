@@ -0,0 +1,3 @@
+module tritan.dev/image-uploader/client
+
+go 1.21.0
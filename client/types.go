@@ -0,0 +1,176 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Account is the caller's user record as returned by GET /api/account.
+type Account struct {
+	Key         string    `json:"key"`
+	Admin       bool      `json:"admin"`
+	DisplayName string    `json:"displayName"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Domain      string    `json:"domain"`
+	Usage       Usage     `json:"usage"`
+	Limits      *Limits   `json:"limits,omitempty"`
+	Quota       *Limits   `json:"quota,omitempty"`
+	NameStyle   string    `json:"nameStyle,omitempty"`
+}
+
+type Usage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+// Limits are storage limits; zero means unlimited.
+type Limits struct {
+	MaxBytes    int64 `json:"maxBytes"`
+	MaxFiles    int64 `json:"maxFiles"`
+	MaxFileSize int64 `json:"maxFileSize"`
+}
+
+type Upload struct {
+	ID           string     `json:"id"`
+	DisplayName  string     `json:"displayName"`
+	FileName     string     `json:"fileName"`
+	Domain       string     `json:"domain,omitempty"`
+	Metadata     Metadata   `json:"metadata"`
+	Type         string     `json:"type"`
+	Cipher       string     `json:"cipher,omitempty"`
+	Visibility   string     `json:"visibility"`
+	Protected    bool       `json:"protected"`
+	Hash         string     `json:"sha256,omitempty"`
+	OriginalName string     `json:"originalName,omitempty"`
+	Title        string     `json:"title,omitempty"`
+	Description  string     `json:"description,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	Version      int        `json:"version,omitempty"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+	MissingAt    *time.Time `json:"missingAt,omitempty"`
+}
+
+type Metadata struct {
+	FileType   string    `json:"fileType"`
+	FileSize   int64     `json:"fileSize"`
+	UploadDate time.Time `json:"uploadDate"`
+	Views      int       `json:"views"`
+}
+
+type URL struct {
+	ID        string     `json:"id"`
+	URL       string     `json:"url"`
+	CreatedAt time.Time  `json:"createdAt"`
+	Slug      string     `json:"slug"`
+	Clicks    int        `json:"clicks"`
+	Domain    string     `json:"domain,omitempty"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+type Domain struct {
+	Name      string   `json:"name"`
+	Allowed   []string `json:"allowed"`
+	UsedCount int      `json:"count"`
+}
+
+// Job is a background job queued by the API, such as account deletion.
+type Job struct {
+	ID          string                 `json:"id"`
+	Type        string                 `json:"type"`
+	Payload     map[string]string      `json:"payload"`
+	Status      string                 `json:"status"`
+	Attempts    int                    `json:"attempts"`
+	MaxAttempts int                    `json:"maxAttempts"`
+	LastError   string                 `json:"lastError,omitempty"`
+	Result      map[string]interface{} `json:"result,omitempty"`
+	RunAt       time.Time              `json:"runAt"`
+	CreatedAt   time.Time              `json:"createdAt"`
+	FinishedAt  *time.Time             `json:"finishedAt,omitempty"`
+}
+
+// Done reports whether the job has stopped running, either way.
+func (j Job) Done() bool {
+	return j.Status == "succeeded" || j.Status == "failed"
+}
+
+// Accepted is the 202 answer for work that continues as a job.
+type Accepted struct {
+	Status    int    `json:"status"`
+	Message   string `json:"message"`
+	JobID     string `json:"job_id"`
+	StatusURL string `json:"status_url"`
+}
+
+// Deleted is the answer to deleting an upload or URL. ExpiresAt is set when
+// the item went to the trash rather than being removed.
+type Deleted struct {
+	Status    int    `json:"status"`
+	Message   string `json:"message"`
+	URL       string `json:"url,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+// ListOptions filter and page the upload and URL listings. Without Limit or
+// Cursor the server returns every match.
+type ListOptions struct {
+	Limit   int
+	Cursor  string
+	Sort    string
+	Order   string
+	Query   string
+	Domain  string
+	From    time.Time
+	To      time.Time
+	Type    string
+	Tag     string
+	MinSize int64
+	MaxSize int64
+}
+
+func (o ListOptions) values() url.Values {
+	query := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+
+	if o.Limit > 0 {
+		query.Set("limit", strconv.Itoa(o.Limit))
+	}
+	set("cursor", o.Cursor)
+	set("sort", o.Sort)
+	set("order", o.Order)
+	set("q", o.Query)
+	set("domain", o.Domain)
+	if !o.From.IsZero() {
+		query.Set("from", o.From.Format(time.RFC3339))
+	}
+	if !o.To.IsZero() {
+		query.Set("to", o.To.Format(time.RFC3339))
+	}
+	set("type", o.Type)
+	set("tag", o.Tag)
+	if o.MinSize > 0 {
+		query.Set("min_size", strconv.FormatInt(o.MinSize, 10))
+	}
+	if o.MaxSize > 0 {
+		query.Set("max_size", strconv.FormatInt(o.MaxSize, 10))
+	}
+	return query
+}
+
+type UploadList struct {
+	Uploads    []Upload `json:"uploads"`
+	Total      int64    `json:"total"`
+	NextCursor string   `json:"next_cursor"`
+	HasMore    bool     `json:"has_more"`
+}
+
+type URLList struct {
+	URLs       []URL  `json:"urls"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor"`
+	HasMore    bool   `json:"has_more"`
+}
@@ -0,0 +1,261 @@
+package client
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File is one file to upload. Size may be -1 when it is not known up front,
+// such as for stdin; the request is then sent chunked.
+type File struct {
+	Name   string
+	Reader io.Reader
+	Size   int64
+}
+
+// OpenFile opens path for upload. The caller closes the returned file.
+func OpenFile(path string) (File, *os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return File{}, nil, err
+	}
+	return File{Name: filepath.Base(path), Reader: f, Size: info.Size()}, f, nil
+}
+
+// UploadOptions are the optional form fields of POST /api/upload. They apply
+// to every file in the request.
+type UploadOptions struct {
+	Name        string
+	NameStyle   string
+	Visibility  string
+	Password    string
+	Title       string
+	Description string
+	Tags        []string
+	Album       string
+	CreateAlbum bool
+	AlbumTitle  string
+
+	// IdempotencyKey, when set, lets the upload be retried safely: the
+	// server answers a repeat with the first response instead of storing the
+	// files again.
+	IdempotencyKey string
+
+	// Progress, when set, is called as the request body is sent with the
+	// bytes written so far and the total, or -1 if the total is unknown.
+	Progress func(sent, total int64)
+}
+
+func (o UploadOptions) fields() [][2]string {
+	var fields [][2]string
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, [2]string{name, value})
+		}
+	}
+
+	add("name", o.Name)
+	add("name_style", o.NameStyle)
+	add("visibility", o.Visibility)
+	add("password", o.Password)
+	add("title", o.Title)
+	add("description", o.Description)
+	add("tags", strings.Join(o.Tags, ","))
+	add("album", o.Album)
+	if o.CreateAlbum {
+		add("create_album", "true")
+	}
+	add("album_title", o.AlbumTitle)
+	return fields
+}
+
+// UploadResult is the outcome for one file of a batch.
+type UploadResult struct {
+	File      string `json:"file"`
+	URL       string `json:"url,omitempty"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// UploadResponse is the answer to an upload. URL is the link for a single
+// file, or the album or first link for a batch; Results lists each file of a
+// batch.
+type UploadResponse struct {
+	Status    int            `json:"status"`
+	Message   string         `json:"message"`
+	URL       string         `json:"url"`
+	Type      string         `json:"type"`
+	Duplicate bool           `json:"duplicate,omitempty"`
+	Album     string         `json:"album,omitempty"`
+	Results   []UploadResult `json:"results,omitempty"`
+}
+
+// Upload sends files in one multipart request. The body is streamed, so large
+// files are never held in memory.
+func (c *Client) Upload(ctx context.Context, files []File, opts UploadOptions) (*UploadResponse, error) {
+	fields := opts.fields()
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+
+	total := multipartLength(form.Boundary(), fields, files)
+	var body io.Reader = pr
+	if opts.Progress != nil {
+		body = &progressReader{r: pr, total: total, progress: opts.Progress}
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/api/upload", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if opts.IdempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", opts.IdempotencyKey)
+	}
+	req.ContentLength = total
+
+	go func() {
+		pw.CloseWithError(writeMultipart(form, fields, files))
+	}()
+
+	var response UploadResponse
+	err = c.send(req, &response)
+	pr.Close()
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// UploadFile uploads a single file from disk.
+func (c *Client) UploadFile(ctx context.Context, path string, opts UploadOptions) (*UploadResponse, error) {
+	file, f, err := OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return c.Upload(ctx, []File{file}, opts)
+}
+
+func writeMultipart(form *multipart.Writer, fields [][2]string, files []File) error {
+	for _, field := range fields {
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		part, err := form.CreateFormFile("sharex", file.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, file.Reader); err != nil {
+			return err
+		}
+	}
+	return form.Close()
+}
+
+// multipartLength works out the body size by writing the same form with
+// empty files to a counter. It returns -1 when a file size is unknown.
+func multipartLength(boundary string, fields [][2]string, files []File) int64 {
+	var counter countingWriter
+	form := multipart.NewWriter(&counter)
+	form.SetBoundary(boundary)
+
+	size := int64(0)
+	for _, file := range files {
+		if file.Size < 0 {
+			return -1
+		}
+		size += file.Size
+	}
+	empty := make([]File, len(files))
+	for i, file := range files {
+		empty[i] = File{Name: file.Name, Reader: strings.NewReader("")}
+	}
+	if err := writeMultipart(form, fields, empty); err != nil {
+		return -1
+	}
+	return counter.n + size
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+type progressReader struct {
+	r        io.Reader
+	sent     int64
+	total    int64
+	progress func(sent, total int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.sent += int64(n)
+		r.progress(r.sent, r.total)
+	}
+	return n, err
+}
+
+// ListUploads returns one page of the caller's uploads.
+func (c *Client) ListUploads(ctx context.Context, opts ListOptions) (*UploadList, error) {
+	var list UploadList
+	if err := c.do(ctx, http.MethodGet, "/api/uploads", opts.values(), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// DeleteUpload deletes an upload by its name without the extension. With the
+// trash enabled it can be restored until Deleted.ExpiresAt.
+func (c *Client) DeleteUpload(ctx context.Context, slug string) (*Deleted, error) {
+	var deleted Deleted
+	if err := c.do(ctx, http.MethodDelete, "/api/delete-upload/"+url.PathEscape(slug), nil, nil, &deleted); err != nil {
+		return nil, err
+	}
+	return &deleted, nil
+}
+
+// SetUploadVisibility changes an upload to public, unlisted or private.
+func (c *Client) SetUploadVisibility(ctx context.Context, slug, visibility string) error {
+	body := map[string]string{"visibility": visibility}
+	return c.do(ctx, http.MethodPut, "/api/uploads/"+url.PathEscape(slug)+"/visibility", nil, body, nil)
+}
+
+// RenameUpload gives an upload a new name; the old one keeps redirecting.
+func (c *Client) RenameUpload(ctx context.Context, slug, name string) error {
+	body := map[string]string{"name": name}
+	return c.do(ctx, http.MethodPut, "/api/uploads/"+url.PathEscape(slug)+"/name", nil, body, nil)
+}
+
+// ShareUpload creates a share link for a private upload that expires after
+// ttl, or the server default when ttl is zero.
+func (c *Client) ShareUpload(ctx context.Context, slug string, ttl time.Duration) (string, error) {
+	body := map[string]int64{"expires_in": int64(ttl / time.Second)}
+
+	var response struct {
+		URL string `json:"url"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/uploads/"+url.PathEscape(slug)+"/share", nil, body, &response); err != nil {
+		return "", err
+	}
+	return response.URL, nil
+}
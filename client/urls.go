@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ShortURL is a newly created short link. FullURL is the link to share.
+type ShortURL struct {
+	URL     string `json:"url"`
+	Slug    string `json:"slug"`
+	FullURL string `json:"fullUrl"`
+}
+
+// Shorten creates a short link to target on the caller's domain.
+func (c *Client) Shorten(ctx context.Context, target string) (*ShortURL, error) {
+	var short ShortURL
+	if err := c.do(ctx, http.MethodPost, "/api/url", nil, map[string]string{"url": target}, &short); err != nil {
+		return nil, err
+	}
+	return &short, nil
+}
+
+// ListURLs returns one page of the caller's short links.
+func (c *Client) ListURLs(ctx context.Context, opts ListOptions) (*URLList, error) {
+	var list URLList
+	if err := c.do(ctx, http.MethodGet, "/api/urls", opts.values(), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// DeleteURL deletes a short link by its slug.
+func (c *Client) DeleteURL(ctx context.Context, slug string) (*Deleted, error) {
+	var deleted Deleted
+	if err := c.do(ctx, http.MethodDelete, "/api/delete-url/"+url.PathEscape(slug), nil, nil, &deleted); err != nil {
+		return nil, err
+	}
+	return &deleted, nil
+}
+
+// RenameURL changes a short link's slug.
+func (c *Client) RenameURL(ctx context.Context, slug, newSlug string) error {
+	body := map[string]string{"new_slug": newSlug}
+	return c.do(ctx, http.MethodPut, "/api/url/"+url.PathEscape(slug), nil, body, nil)
+}
@@ -1,7 +1,8 @@
 #!/bin/bash
 
-API="https://cdn.tritan.gg/api/upload"
-API_KEY=""
+# Uploads with the tritan CLI (client/cmd/tritan). Run "tritan login -key KEY"
+# once, adding "-url https://your.host" for a self-hosted instance.
+TRITAN="${TRITAN:-tritan}"
 
 screenshot="$(mktemp /tmp/screenshot.XXXXXXXXXX.png)"
 
@@ -52,18 +53,11 @@ upload_image() {
         cleanup
     fi
     
-    response=$(curl -s -H "key: $API_KEY" -F "sharex=@$screenshot" "$API")
+    url=$("$TRITAN" upload -quiet "$screenshot" 2>&1)
     upload_status=$?
     
-    if [ $upload_status -ne 0 ]; then
-        display_error "Failed to upload image."
-        cleanup
-    fi
-    
-    url=$(echo "$response" | grep -oE '"url":"([^"]+)"' | cut -d'"' -f4)
-    
-    if [ -z "$url" ]; then
-        display_error "Failed to get uploaded URL. Response: $response"
+    if [ $upload_status -ne 0 ] || [ -z "$url" ]; then
+        display_error "Failed to upload image: $url"
         cleanup
     fi
     
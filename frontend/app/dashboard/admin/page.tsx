@@ -29,6 +29,7 @@ interface AdminUser {
 }
 
 interface AdminUpload {
+  id: string;
   key: string;
   displayName: string;
   fileName: string;
@@ -287,12 +288,12 @@ const AdminPage: React.FC = () => {
     }
   };
 
-  const deleteUpload = async (fileName: string) => {
-    if (!confirm(`Delete upload ${fileName}?`)) return;
+  const deleteUpload = async (upload: AdminUpload) => {
+    if (!confirm(`Delete upload ${upload.fileName}?`)) return;
 
-    setActionLoading(`upload:${fileName}`);
+    setActionLoading(`upload:${upload.id}`);
     try {
-      const response = await fetch(`/api/admin/uploads/${encodeURIComponent(fileName)}`, {
+      const response = await fetch(`/api/admin/uploads/${encodeURIComponent(upload.id)}`, {
         headers: apiHeaders,
         method: "DELETE",
       });
@@ -326,7 +327,7 @@ const AdminPage: React.FC = () => {
         throw new Error(body.message || "Failed to delete user uploads");
       }
 
-      toast.success("User uploads deleted");
+      toast.success("Deleting user uploads in the background");
       await refreshDashboard();
     } catch (err) {
       toast.error(err instanceof Error ? err.message : "Failed to delete user uploads");
@@ -350,7 +351,7 @@ const AdminPage: React.FC = () => {
         throw new Error(body.message || "Failed to delete user");
       }
 
-      toast.success("User deleted");
+      toast.success("Deleting user in the background");
       if (selectedUserKey === targetKey) {
         setSelectedUserKey("");
         setSelectedUserUploads([]);
@@ -531,13 +532,13 @@ const AdminPage: React.FC = () => {
                 </div>
                 <div className="p-4 grid grid-cols-1 sm:grid-cols-2 xl:grid-cols-3 gap-3">
                   {recentUploads.map((upload) => (
-                    <div key={upload.fileName} className="rounded-sm overflow-hidden" style={{ border: "1px solid rgba(99,102,241,0.15)", backgroundColor: "#0b0b14" }}>
+                    <div key={upload.id} className="rounded-sm overflow-hidden" style={{ border: "1px solid rgba(99,102,241,0.15)", backgroundColor: "#0b0b14" }}>
                       <img src={`https://s3.tritan.gg/images/${upload.fileName}`} alt={upload.fileName} className="h-36 w-full object-cover" />
                       <div className="p-3 space-y-1.5">
                         <p className="font-mono text-xs truncate" style={{ color: "#f4f4f5" }}>{upload.fileName}</p>
                         <p className="font-mono text-[10px]" style={{ color: "#a1a1aa" }}>{upload.displayName} · {upload.ip}</p>
                         <p className="font-mono text-[10px]" style={{ color: "#71717a" }}>{new Date(upload.metadata.uploadDate).toLocaleString()} · {upload.metadata.views} views</p>
-                        <button onClick={() => deleteUpload(upload.fileName)} disabled={actionLoading === `upload:${upload.fileName}`} className="mt-1 inline-flex items-center gap-1 px-2.5 py-1 rounded-sm font-mono text-[10px] disabled:opacity-50" style={{ border: "1px solid rgba(239,68,68,0.35)", color: "#f87171" }}><Trash2 className="w-3 h-3" />Delete Upload</button>
+                        <button onClick={() => deleteUpload(upload)} disabled={actionLoading === `upload:${upload.id}`} className="mt-1 inline-flex items-center gap-1 px-2.5 py-1 rounded-sm font-mono text-[10px] disabled:opacity-50" style={{ border: "1px solid rgba(239,68,68,0.35)", color: "#f87171" }}><Trash2 className="w-3 h-3" />Delete Upload</button>
                       </div>
                     </div>
                   ))}
@@ -561,12 +562,12 @@ const AdminPage: React.FC = () => {
                   </div>
                   <div className="p-4 grid grid-cols-1 sm:grid-cols-2 xl:grid-cols-3 gap-3">
                     {selectedUserUploads.map((upload) => (
-                      <div key={upload.fileName} className="rounded-sm overflow-hidden" style={{ border: "1px solid rgba(139,92,246,0.14)", backgroundColor: "#0b0b14" }}>
+                      <div key={upload.id} className="rounded-sm overflow-hidden" style={{ border: "1px solid rgba(139,92,246,0.14)", backgroundColor: "#0b0b14" }}>
                         <img src={`https://s3.tritan.gg/images/${upload.fileName}`} alt={upload.fileName} className="h-36 w-full object-cover" />
                         <div className="p-3 space-y-1.5">
                           <p className="font-mono text-xs truncate" style={{ color: "#f4f4f5" }}>{upload.fileName}</p>
                           <p className="font-mono text-[10px]" style={{ color: "#71717a" }}>{new Date(upload.metadata.uploadDate).toLocaleString()} · {upload.metadata.views} views</p>
-                          <button onClick={() => deleteUpload(upload.fileName)} disabled={actionLoading === `upload:${upload.fileName}`} className="mt-1 inline-flex items-center gap-1 px-2.5 py-1 rounded-sm font-mono text-[10px] disabled:opacity-50" style={{ border: "1px solid rgba(239,68,68,0.35)", color: "#f87171" }}><Trash2 className="w-3 h-3" />Delete Upload</button>
+                          <button onClick={() => deleteUpload(upload)} disabled={actionLoading === `upload:${upload.id}`} className="mt-1 inline-flex items-center gap-1 px-2.5 py-1 rounded-sm font-mono text-[10px] disabled:opacity-50" style={{ border: "1px solid rgba(239,68,68,0.35)", color: "#f87171" }}><Trash2 className="w-3 h-3" />Delete Upload</button>
                         </div>
                       </div>
                     ))}